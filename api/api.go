@@ -2,14 +2,70 @@ package api
 
 import (
 	"encoding/json"
+	"time"
 )
 
+// RandomQuiz is configured as quiz name to play a quiz picked at random
+// among the lobby quizzes. The picked quiz is broadcasted.
+const RandomQuiz = "__random__"
+
+// Subprotocol is the websocket subprotocol negotiated by the lobby
+// endpoint. Clients offer it alongside the bearer token so the server
+// has a protocol to echo back, as required by strict browsers.
+const Subprotocol = "sevenquiz"
+
 type Response[T ResponseData] struct {
+	// ID echoes the id of the request answered, if set by the client.
+	// Broadcasts carry no id.
+	ID string `json:"id,omitempty"`
+
+	// Seq numbers the broadcasts of a lobby, starting at 1. It is zero
+	// for responses to a request.
+	Seq uint64 `json:"seq,omitempty"`
+
 	Type    ResponseType `json:"type"`
 	Message string       `json:"message,omitempty"`
 	Data    T            `json:"data,omitempty"`
 }
 
+// WithSeq returns a copy of the response numbered as broadcast seq.
+func (r Response[T]) WithSeq(seq uint64) any {
+	r.Seq = seq
+	return r
+}
+
+// ResponseType returns the type of a response held as any.
+func (r Response[T]) ResponseType() ResponseType {
+	return r.Type
+}
+
+// MarshalJSON encodes a response, omitting the data key entirely for
+// responses without data, whatever their EmptyResponseData value.
+func (r Response[T]) MarshalJSON() ([]byte, error) {
+	res := struct {
+		ID      string          `json:"id,omitempty"`
+		Seq     uint64          `json:"seq,omitempty"`
+		Type    ResponseType    `json:"type"`
+		Message string          `json:"message,omitempty"`
+		Data    json.RawMessage `json:"data,omitempty"`
+	}{
+		ID:      r.ID,
+		Seq:     r.Seq,
+		Type:    r.Type,
+		Message: r.Message,
+	}
+	if _, empty := any(r.Data).(EmptyResponseData); !empty {
+		data, err := json.Marshal(r.Data)
+		if err != nil {
+			return nil, err
+		}
+		if string(data) != "null" {
+			res.Data = data
+		}
+	}
+	return json.Marshal(res)
+}
+
 type ResponseType string
 
 const (
@@ -17,13 +73,23 @@ const (
 	ResponseTypeRegister     ResponseType = "register"
 	ResponseTypeLobby        ResponseType = "lobby"
 	ResponseTypeKick         ResponseType = "kick"
+	ResponseTypeKicked       ResponseType = "kicked"
 	ResponseTypePlayerUpdate ResponseType = "playerUpdate"
 	ResponseTypeConfigure    ResponseType = "configure"
 	ResponseTypeStart        ResponseType = "start"
+	ResponseTypeCountdown    ResponseType = "countdown"
 	ResponseTypeQuestion     ResponseType = "question"
 	ResponseTypeAnswer       ResponseType = "answer"
+	ResponseTypeQuizEnd      ResponseType = "quizEnd"
 	ResponseTypeReview       ResponseType = "review"
 	ResponseTypeResults      ResponseType = "results"
+	ResponseTypeLobbyClosed  ResponseType = "lobbyClosed"
+	ResponseTypePlayerList   ResponseType = "playerList"
+	ResponseTypeAnswerReveal ResponseType = "answerReveal"
+	ResponseTypePause        ResponseType = "pause"
+	ResponseTypeResume       ResponseType = "resume"
+	ResponseTypeLogin        ResponseType = "login"
+	ResponseTypeReset        ResponseType = "reset"
 )
 
 func (r ResponseType) String() string {
@@ -31,6 +97,9 @@ func (r ResponseType) String() string {
 }
 
 type Request[T RequestData] struct {
+	// ID optionally identifies a request, echoed in its response so
+	// clients can match them over the websocket.
+	ID   string      `json:"id,omitempty"`
 	Type RequestType `json:"type"`
 	Data T           `json:"data,omitempty"`
 }
@@ -45,6 +114,10 @@ const (
 	RequestTypeStart     RequestType = "start"
 	RequestTypeAnswer    RequestType = "answer"
 	RequestTypeReview    RequestType = "review"
+	RequestTypePause     RequestType = "pause"
+	RequestTypeResume    RequestType = "resume"
+	RequestTypeLogin     RequestType = "login"
+	RequestTypeReset     RequestType = "reset"
 	RequestTypeUnknown   RequestType = "unknown"
 )
 
@@ -56,18 +129,34 @@ type RequestData interface {
 	LobbyConfigureRequestData |
 		RegisterRequestData |
 		KickRequestData |
+		LoginRequestData |
+		AnswerRequestData |
+		ReviewRequestData |
 		EmptyRequestData | json.RawMessage
 }
 
 type ResponseData interface {
 	LobbyResponseData |
 		CreateLobbyResponseData |
+		LobbyStatusResponseData |
 		PlayerUpdateResponseData |
+		KickedResponseData |
+		PlayerListResponseData |
 		LobbyUpdateResponseData |
 		StartResponseData |
+		CountdownResponseData |
 		QuestionResponseData |
+		AnswerResponseData |
+		QuizEndResponseData |
 		ReviewResponseData |
+		AnswerRevealResponseData |
 		ResultsResponseData |
+		LobbyResultsResponseData |
+		LobbyClosedResponseData |
+		AdminLobbiesResponseData |
+		AdminLobbyResponseData |
+		QuizzesResponseData |
+		QuizResponseData |
 		HTTPErrorData | WebsocketErrorData |
 		EmptyResponseData | json.RawMessage
 }
@@ -77,52 +166,140 @@ type (
 	EmptyResponseData *struct{}
 
 	LobbyResponseData struct {
-		ID              string    `json:"id"`
-		Owner           *string   `json:"owner"`
-		MaxPlayers      int       `json:"maxPlayers"`
-		PlayerList      []string  `json:"playerList"`
-		Quizzes         []string  `json:"quizzes"`
-		CurrentQuiz     string    `json:"currentQuiz"`
-		CurrentQuestion *Question `json:"currentQuestion"`
-		Created         string    `json:"created"`
+		ID              string              `json:"id"`
+		State           string              `json:"state"`
+		Owner           *string             `json:"owner"`
+		MaxPlayers      int                 `json:"maxPlayers"`
+		PlayerList      []string            `json:"playerList"`
+		Scores          map[string]float64  `json:"scores"`
+		Teams           map[string]string   `json:"teams,omitempty"`
+		Quizzes         []string            `json:"quizzes"`
+		QuizInfo        map[string]QuizInfo `json:"quizInfo"`
+		CurrentQuiz     string              `json:"currentQuiz"`
+		CurrentQuestion *Question           `json:"currentQuestion"`
+		Created         string              `json:"created"`
+
+		// OwnerClaimed is set for the conn which presented the owner
+		// token on connect, it becomes the owner once registered.
+		OwnerClaimed bool `json:"ownerClaimed,omitempty"`
 	}
 
 	LobbyConfigureRequestData struct {
-		Quiz     string `json:"quiz"`
-		Password string `json:"password"`
+		Quiz            string `json:"quiz"` // RandomQuiz picks any of the lobby quizzes.
+		Password        string `json:"password"`
+		ClearPassword   bool   `json:"clearPassword,omitempty"` // Removes the password, Password must be empty.
+		Shuffle         *bool  `json:"shuffle,omitempty"`
+		ShuffleChoices  *bool  `json:"shuffleChoices,omitempty"`
+		RevealAfterEach *bool  `json:"revealAfterEach,omitempty"`
+		MaxPlayers      *int   `json:"maxPlayers,omitempty"`
 	}
 
+	// LobbyUpdateResponseData holds the lobby settings changed, others
+	// are omitted.
 	LobbyUpdateResponseData struct {
-		Quiz string `json:"quiz"`
+		Quiz             string `json:"quiz,omitempty"`
+		MaxPlayers       int    `json:"maxPlayers,omitempty"`
+		PasswordRequired *bool  `json:"passwordRequired,omitempty"`
+
+		// QuestionCount and EstimatedDuration preview the quiz selected,
+		// set along Quiz.
+		QuestionCount     int           `json:"questionCount,omitempty"`
+		EstimatedDuration time.Duration `json:"estimatedDuration,omitempty"`
+	}
+
+	CreateLobbyRequestData struct {
+		Quiz       string `json:"quiz,omitempty"`
+		MaxPlayers int    `json:"maxPlayers,omitempty"`
+		Password   string `json:"password,omitempty"`
 	}
 
 	CreateLobbyResponseData struct {
 		LobbyID string `json:"id"`
+		Token   string `json:"token"`
+	}
+
+	LobbyStatusResponseData struct {
+		Exists           bool   `json:"exists"`
+		State            string `json:"state"`
+		Full             bool   `json:"full"`
+		PasswordRequired bool   `json:"passwordRequired"`
+		PlayerCount      int    `json:"playerCount"`
 	}
 
 	RegisterRequestData struct {
 		Username string `json:"username"`
+		Team     string `json:"team,omitempty"`
+		Token    string `json:"token,omitempty"`
 	}
 
 	KickRequestData struct {
 		Username string `json:"username"`
+		Reason   string `json:"reason,omitempty"`
+		Ban      bool   `json:"ban,omitempty"` // Prevents the username from registering again.
+	}
+
+	// KickedResponseData is sent to a kicked player before its conn closes.
+	KickedResponseData struct {
+		Reason string `json:"reason,omitempty"`
+		Banned bool   `json:"banned"`
+	}
+
+	LoginRequestData struct {
+		Token string `json:"token"`
+		// LastSeq is the seq of the last broadcast received. The recorded
+		// broadcasts following it are replayed after the login, zero
+		// skips the replay.
+		LastSeq uint64 `json:"lastSeq,omitempty"`
 	}
 
 	PlayerUpdateResponseData struct {
 		Username string `json:"username,omitempty"`
+		Team     string `json:"team,omitempty"`
 		Action   string `json:"action"`
+		Reason   string `json:"reason,omitempty"`
+	}
+
+	PlayerListResponseData struct {
+		PlayerList []string           `json:"playerList"`
+		Scores     map[string]float64 `json:"scores"`
+		Alive      map[string]bool    `json:"alive"`
+	}
+
+	AnswerRequestData struct {
+		QuestionID *int   `json:"questionId,omitempty"`
+		Answer     Answer `json:"answer"`
 	}
 
 	AnswerResponseData struct {
-		Answer Answer `json:"answer"`
+		QuestionID int    `json:"questionId"`
+		Answer     Answer `json:"answer"`
 	}
 
 	StartResponseData struct {
 		Token string `json:"token"`
 	}
 
+	CountdownResponseData struct {
+		Remaining int `json:"remaining"` // Seconds before the first question.
+	}
+
 	QuestionResponseData struct {
 		Question Question `json:"question"`
+
+		// Index is the position of the question in the played order,
+		// starting at 0, out of Total questions.
+		Index int `json:"index"`
+		Total int `json:"total"`
+
+		// Remaining is the time left to answer, only set when greeting
+		// a conn joining during the question.
+		Remaining time.Duration `json:"remaining,omitempty"`
+	}
+
+	// QuizEndResponseData is broadcast once the last question closed.
+	QuizEndResponseData struct {
+		Questions int    `json:"questions"` // Number of questions played.
+		Next      string `json:"next"`      // Phase following the quiz, "review".
 	}
 
 	ReviewRequestData struct {
@@ -130,17 +307,96 @@ type (
 	}
 
 	ReviewResponseData struct {
-		Question Question `json:"question"`
-		Player   string   `json:"player"`
-		Answer   Answer   `json:"answer"`
+		Question  Question `json:"question"`
+		Player    string   `json:"player"`
+		Answer    Answer   `json:"answer"`
+		Validated bool     `json:"validated"`
+	}
+
+	AnswerRevealResponseData struct {
+		QuestionID int             `json:"questionId"`
+		Answer     Answer          `json:"answer"`
+		Correct    map[string]bool `json:"correct"`
 	}
 
 	ResultsResponseData struct {
-		Results map[string]int `json:"results"`
+		Results     map[string]float64 `json:"results"`
+		Teams       map[string]float64 `json:"teams,omitempty"`
+		Leaderboard []LeaderboardEntry `json:"leaderboard"`
+	}
+
+	// LeaderboardEntry ranks a player. Tied players share the same rank.
+	LeaderboardEntry struct {
+		Username string  `json:"username"`
+		Score    float64 `json:"score"`
+		Rank     int     `json:"rank"`
+	}
+
+	// LobbyResultsResponseData exports the results of a finished quiz.
+	LobbyResultsResponseData struct {
+		ResultsResponseData
+		Quiz      string           `json:"quiz"`
+		Questions []QuestionResult `json:"questions"`
+	}
+
+	// QuestionResult reports whether each player answered a question
+	// correctly, answers credited during the review excluded.
+	QuestionResult struct {
+		ID      int             `json:"id"`
+		Title   string          `json:"title"`
+		Correct map[string]bool `json:"correct"`
+	}
+
+	LobbyClosedResponseData struct {
+		Reason string `json:"reason"`
+	}
+
+	AdminLobbiesResponseData struct {
+		Lobbies []AdminLobbyResponseData `json:"lobbies"`
+	}
+
+	AdminLobbyResponseData struct {
+		ID          string               `json:"id"`
+		State       string               `json:"state"`
+		Owner       string               `json:"owner"`
+		NumPlayers  int                  `json:"numPlayers"`
+		Created     string               `json:"created"`
+		CurrentQuiz string               `json:"currentQuiz"`
+		Players     []AdminPlayerDetails `json:"players,omitempty"`
+	}
+
+	AdminPlayerDetails struct {
+		Username string `json:"username"`
+		Score    int    `json:"score"`
+		Alive    bool   `json:"alive"`
+	}
+
+	QuizzesResponseData struct {
+		Quizzes []QuizSummary `json:"quizzes"`
+	}
+
+	QuizSummary struct {
+		Name string `json:"name"`
+		QuizInfo
+	}
+
+	QuizResponseData struct {
+		QuizSummary
+		Questions []QuestionPreview `json:"questions"`
+	}
+
+	QuestionPreview struct {
+		Title string       `json:"title"`
+		Type  QuestionType `json:"type"`
 	}
 )
 
+// DecodeJSON decodes data into T. Empty data, as sent for requests
+// without payload, decodes to the zero value of T.
 func DecodeJSON[T any](data json.RawMessage) (res T, err error) {
+	if len(data) == 0 {
+		return res, nil
+	}
 	if err := json.Unmarshal(data, &res); err != nil {
 		return res, err
 	}
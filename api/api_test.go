@@ -0,0 +1,53 @@
+package api_test
+
+import (
+	"encoding/json"
+	"sevenquiz-backend/api"
+	"testing"
+)
+
+func TestResponseEmptyData(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		res  any
+		want string
+	}{
+		"nil empty data": {
+			res:  api.Response[api.EmptyResponseData]{Type: api.ResponseTypeRegister},
+			want: `{"type":"register"}`,
+		},
+		"non nil empty data": {
+			res:  api.Response[api.EmptyResponseData]{Type: api.ResponseTypeKick, Data: &struct{}{}},
+			want: `{"type":"kick"}`,
+		},
+		"pointer response": {
+			res:  &api.Response[api.EmptyResponseData]{Type: api.ResponseTypeConfigure},
+			want: `{"type":"configure"}`,
+		},
+		"nil raw data": {
+			res:  api.Response[json.RawMessage]{Type: api.ResponseTypeLogin},
+			want: `{"type":"login"}`,
+		},
+		"struct data": {
+			res: api.Response[api.LobbyClosedResponseData]{
+				Type: api.ResponseTypeLobbyClosed,
+				Data: api.LobbyClosedResponseData{Reason: "deleted"},
+			},
+			want: `{"type":"lobbyClosed","data":{"reason":"deleted"}}`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := json.Marshal(tc.res)
+			if err != nil {
+				t.Fatalf("Could not marshal response: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("Unexpected response json: got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
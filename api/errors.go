@@ -1,26 +1,48 @@
 package api
 
+import (
+	"math"
+	"time"
+)
+
 type HTTPErrorData struct {
-	Code    HTTPErrorCode `json:"code"`
-	Message string        `json:"message,omitempty"`
-	Extra   any           `json:"extra,omitempty"`
+	Code       HTTPErrorCode `json:"code"`
+	Message    string        `json:"message,omitempty"`
+	Extra      any           `json:"extra,omitempty"`
+	Retryable  bool          `json:"retryable"`
+	RetryAfter int           `json:"retryAfter,omitempty"` // Seconds.
 }
 
 type HTTPErrorCode uint8
 
 const (
-	MissingURLQueryHTTPCode     HTTPErrorCode = 101
-	InternalServerErrorHTTPCode HTTPErrorCode = 102
-	InvalidTokenErrorHTTPCode   HTTPErrorCode = 103
-	InvalidTokenClaimHTTPCode   HTTPErrorCode = 104
-	UnauthorizedErrorHTTPCode   HTTPErrorCode = 105
+	MissingURLQueryHTTPCode      HTTPErrorCode = 101
+	InternalServerErrorHTTPCode  HTTPErrorCode = 102
+	InvalidTokenErrorHTTPCode    HTTPErrorCode = 103
+	InvalidTokenClaimHTTPCode    HTTPErrorCode = 104
+	UnauthorizedErrorHTTPCode    HTTPErrorCode = 105
+	NoLobbySlotAvailableHTTPCode HTTPErrorCode = 106
+	LobbyNotFoundHTTPCode        HTTPErrorCode = 107
+	MediaNotFoundHTTPCode        HTTPErrorCode = 108
+	QuizNotFoundHTTPCode         HTTPErrorCode = 109
+	InvalidInputHTTPCode         HTTPErrorCode = 110
+	TooManyPlayersHTTPCode       HTTPErrorCode = 111
+	RateLimitedHTTPCode          HTTPErrorCode = 112
+	ForbiddenOriginHTTPCode      HTTPErrorCode = 113
+	TooManyLobbiesHTTPCode       HTTPErrorCode = 114
+	ResultsNotReadyHTTPCode      HTTPErrorCode = 115
+	TooManyRequestsHTTPCode      HTTPErrorCode = 116
+	QuestionClosedHTTPCode       HTTPErrorCode = 117
+	DrainingHTTPCode             HTTPErrorCode = 118
 )
 
 type WebsocketErrorData struct {
-	Request RequestType        `json:"request,omitempty"`
-	Code    WebsocketErrorCode `json:"code"`
-	Message string             `json:"message,omitempty"`
-	Extra   any                `json:"extra,omitempty"`
+	Request    RequestType        `json:"request,omitempty"`
+	Code       WebsocketErrorCode `json:"code"`
+	Message    string             `json:"message,omitempty"`
+	Extra      any                `json:"extra,omitempty"`
+	Retryable  bool               `json:"retryable"`
+	RetryAfter int                `json:"retryAfter,omitempty"` // Seconds.
 }
 
 type WebsocketErrorCode uint8
@@ -37,6 +59,11 @@ const (
 	UnauthorizedErrorCode       WebsocketErrorCode = 209
 	PlayerNotFoundErrorCode     WebsocketErrorCode = 210
 	QuizNotFoundErrorCode       WebsocketErrorCode = 211
+	NoReviewPendingErrorCode    WebsocketErrorCode = 212
+	NotEnoughPlayersCode        WebsocketErrorCode = 213
+	UsernameBannedCode          WebsocketErrorCode = 214
+	WrongLobbyStateCode         WebsocketErrorCode = 215
+	NotRegisteredCode           WebsocketErrorCode = 216
 )
 
 type ErrorCode interface {
@@ -49,6 +76,18 @@ type ErrorData[T ErrorCode] struct { //nolint: errname
 	Message string      `json:"message,omitempty"`
 	Extra   any         `json:"extra,omitempty"`
 	Err     error       `json:"error,omitempty"`
+
+	// Retryable reports if the same request may succeed later.
+	Retryable bool `json:"retryable,omitempty"`
+
+	// RetryAfter optionally hints how long to wait before retrying.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// RetryAfterSeconds returns RetryAfter rounded up to the second,
+// as expected by the Retry-After header.
+func (e ErrorData[T]) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
 }
 
 func (e ErrorData[T]) Error() string {
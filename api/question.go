@@ -1,18 +1,234 @@
 package api
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
 
 type Question struct {
 	ID         int           `json:"id"                   yaml:"ID"`
 	Title      string        `json:"title"                yaml:"Title"`
-	Type       string        `json:"type"                 yaml:"Type"`
+	Type       QuestionType  `json:"type"                 yaml:"Type"`
 	Time       time.Duration `json:"time"                 yaml:"Time"`
 	Medias     []Media       `json:"medias,omitempty"     yaml:"Medias"`
 	Choices    []string      `json:"choices,omitempty"    yaml:"Choices"`
 	OrderItems []OrderItem   `json:"orderItems,omitempty" yaml:"OrderItems"`
-	Categories []string      `json:"categories,omitempty" yaml:"Categories"`
+	Categories []string      `json:"categories,omitempty" yaml:"Categories"` // Categories the choices of a categories question are placed in.
 	Options    any           `json:"options,omitempty"    yaml:"Options"`
+	Map        *MapOptions   `json:"map,omitempty"        yaml:"Map"`
 	Answer     *Answer       `json:"answer,omitempty"     yaml:"Answer"`
+	Answers    []Answer      `json:"answers,omitempty"    yaml:"Answers"` // Variants also accepted, such as other valid orders.
+	Scoring    Scoring       `json:"scoring,omitempty"    yaml:"Scoring"`
+	Match      TextMatch     `json:"match,omitempty"      yaml:"Match"`
+}
+
+// Sanitized returns a copy of the question safe to be sent to players
+// during the quiz. The answers are removed and order items are sorted by
+// name so their authored order does not reveal the expected order.
+// Boolean questions are given their fixed choices. The choices of
+// categories questions are sorted too, as they are often authored
+// grouped by category.
+func (q Question) Sanitized() Question {
+	q.Answer, q.Answers = nil, nil
+	switch q.Type {
+	case QuestionTypeBoolean:
+		q.Choices = BooleanChoices()
+	case QuestionTypeCategories:
+		q.Choices = slices.Clone(q.Choices)
+		slices.Sort(q.Choices)
+	}
+	q.OrderItems = slices.Clone(q.OrderItems)
+	slices.SortFunc(q.OrderItems, func(a, b OrderItem) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return q
+}
+
+// Clone returns a deep copy of the question. Options are shared as
+// they are never modified once loaded.
+func (q Question) Clone() Question {
+	q.Medias = slices.Clone(q.Medias)
+	q.Choices = slices.Clone(q.Choices)
+	q.OrderItems = slices.Clone(q.OrderItems)
+	q.Categories = slices.Clone(q.Categories)
+	if q.Map != nil {
+		m := *q.Map
+		q.Map = &m
+	}
+	if q.Answer != nil {
+		answer := q.Answer.Clone()
+		q.Answer = &answer
+	}
+	if q.Answers != nil {
+		answers := make([]Answer, 0, len(q.Answers))
+		for _, answer := range q.Answers {
+			answers = append(answers, answer.Clone())
+		}
+		q.Answers = answers
+	}
+	return q
+}
+
+// AcceptedAnswers returns the answer followed by its accepted variants.
+func (q Question) AcceptedAnswers() []Answer {
+	if q.Answer == nil {
+		return q.Answers
+	}
+	return append([]Answer{*q.Answer}, q.Answers...)
+}
+
+// UnmarshalYAML decodes a question, interpreting a bare integer Time
+// as seconds. Duration strings such as "30s" or "1m" are decoded as is.
+//
+// Questions authored with Answers only get the first one as Answer, the
+// others being its variants, so that Answer is always the main answer.
+//
+// Alternative texts listed in Answer.Accept are a shorthand for text
+// variants and are moved to Answers. Both cannot be set at once, and the
+// shorthand is refused within Answers entries.
+func (q *Question) UnmarshalYAML(value *yaml.Node) error {
+	type rawQuestion Question // Avoid UnmarshalYAML recursion.
+
+	node := *value
+	node.Content = slices.Clone(value.Content)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		if key.Value != "Time" || val.ShortTag() != "!!int" {
+			continue
+		}
+		seconds := *val
+		seconds.Tag = "!!str"
+		seconds.Value += "s"
+		node.Content[i+1] = &seconds
+	}
+
+	if err := node.Decode((*rawQuestion)(q)); err != nil {
+		return err
+	}
+
+	var shorthand struct {
+		Answer struct {
+			Accept []string `yaml:"Accept"`
+		} `yaml:"Answer"`
+		Answers []struct {
+			Accept []string `yaml:"Accept"`
+		} `yaml:"Answers"`
+	}
+	if err := node.Decode(&shorthand); err != nil {
+		return err
+	}
+	for i, answer := range shorthand.Answers {
+		if len(answer.Accept) > 0 {
+			return fmt.Errorf("answers %d: accept is only allowed in answer, list alternatives as answers", i)
+		}
+	}
+	if accept := shorthand.Answer.Accept; len(accept) > 0 {
+		if len(q.Answers) > 0 {
+			return errors.New("answer accept and answers cannot be both set")
+		}
+		for _, text := range accept {
+			q.Answers = append(q.Answers, Answer{Text: text})
+		}
+	}
+
+	if q.Answer == nil && len(q.Answers) > 0 {
+		q.Answer, q.Answers = &q.Answers[0], q.Answers[1:]
+	}
+	return nil
+}
+
+// Scoring selects how answers to a question are scored.
+type Scoring string
+
+const (
+	// ScoringExact credits a point to exactly correct answers only.
+	ScoringExact Scoring = "exact"
+
+	// ScoringPartial credits a fraction of the point to partially correct
+	// choices and order answers.
+	ScoringPartial Scoring = "partial"
+)
+
+// IsValid reports whether s is a known scoring, empty meaning exact.
+func (s Scoring) IsValid() bool {
+	switch s {
+	case "", ScoringExact, ScoringPartial:
+		return true
+	default:
+		return false
+	}
+}
+
+// TextMatch selects how text answers are compared to the expected ones.
+type TextMatch string
+
+const (
+	// MatchExact accepts answers identical to an expected text, surrounding
+	// spaces aside.
+	MatchExact TextMatch = "exact"
+
+	// MatchNormalized compares texts regardless of case, accents,
+	// punctuation and extra spaces.
+	MatchNormalized TextMatch = "normalized"
+
+	// MatchFuzzy compares normalized texts tolerating a typo every five
+	// characters of the expected text.
+	MatchFuzzy TextMatch = "fuzzy"
+)
+
+// IsValid reports whether m is a known text match, empty meaning normalized.
+func (m TextMatch) IsValid() bool {
+	switch m {
+	case "", MatchExact, MatchNormalized, MatchFuzzy:
+		return true
+	default:
+		return false
+	}
+}
+
+type QuestionType string
+
+const (
+	QuestionTypeChoices    QuestionType = "choices"
+	QuestionTypeText       QuestionType = "text"
+	QuestionTypeOrder      QuestionType = "order"
+	QuestionTypeCategories QuestionType = "categories"
+	QuestionTypeMap        QuestionType = "map"
+	QuestionTypeBlind      QuestionType = "blind"
+
+	// QuestionTypeBoolean is a choices question answered by a single
+	// choice out of BooleanChoices.
+	QuestionTypeBoolean QuestionType = "boolean"
+)
+
+var questionTypes = map[QuestionType]struct{}{
+	QuestionTypeChoices:    {},
+	QuestionTypeText:       {},
+	QuestionTypeOrder:      {},
+	QuestionTypeCategories: {},
+	QuestionTypeMap:        {},
+	QuestionTypeBlind:      {},
+	QuestionTypeBoolean:    {},
+}
+
+// BooleanChoices returns the fixed choices of boolean questions.
+func BooleanChoices() []string {
+	return []string{"true", "false"}
+}
+
+func (t QuestionType) String() string {
+	return string(t)
+}
+
+// IsValid reports whether t is a known question type.
+func (t QuestionType) IsValid() bool {
+	_, ok := questionTypes[t]
+	return ok
 }
 
 type Answer struct {
@@ -21,6 +237,23 @@ type Answer struct {
 	Text    string   `json:"text,omitempty"    yaml:"Text"`
 	Choices []string `json:"choices,omitempty" yaml:"Choices"`
 	Order   []string `json:"order,omitempty"   yaml:"Order"`
+
+	// Categories places the choices of a categories question, by category.
+	Categories map[string][]string `json:"categories,omitempty" yaml:"Categories"`
+}
+
+// Clone returns a deep copy of the answer.
+func (a Answer) Clone() Answer {
+	a.Choices = slices.Clone(a.Choices)
+	a.Order = slices.Clone(a.Order)
+	if a.Categories != nil {
+		categories := make(map[string][]string, len(a.Categories))
+		for category, choices := range a.Categories {
+			categories[category] = slices.Clone(choices)
+		}
+		a.Categories = categories
+	}
+	return a
 }
 
 type Media struct {
@@ -33,6 +266,22 @@ type OrderItem struct {
 	Media Media  `json:"media,omitempty" yaml:"Media"`
 }
 
+// MapOptions describes the map of a map question, answered by the X and
+// Y coordinates of a point of the map from its top left corner.
+type MapOptions struct {
+	Width  int `json:"width"  yaml:"Width"`
+	Height int `json:"height" yaml:"Height"`
+
+	// Radius is the distance from the expected point within which
+	// answers earn the whole point.
+	Radius int `json:"radius,omitempty" yaml:"Radius"`
+
+	// MaxDistance is the distance from the expected point beyond which
+	// answers earn nothing, the points decreasing linearly from Radius.
+	// Zero earns nothing beyond Radius.
+	MaxDistance int `json:"maxDistance,omitempty" yaml:"MaxDistance"`
+}
+
 type ChoicesOptions struct {
 	MinChoices uint `json:"minChoices,omitempty" yaml:"MinChoices"`
 	MaxChoices uint `json:"maxChoices,omitempty" yaml:"MaxChoices"`
@@ -0,0 +1,283 @@
+package api_test
+
+import (
+	"encoding/json"
+	"sevenquiz-backend/api"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gopkg.in/yaml.v3"
+)
+
+func TestQuestionTypeIsValid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		typ  api.QuestionType
+		want bool
+	}{
+		{typ: api.QuestionTypeChoices, want: true},
+		{typ: api.QuestionTypeText, want: true},
+		{typ: api.QuestionTypeOrder, want: true},
+		{typ: api.QuestionTypeCategories, want: true},
+		{typ: api.QuestionTypeMap, want: true},
+		{typ: api.QuestionTypeBlind, want: true},
+		{typ: api.QuestionTypeBoolean, want: true},
+		{typ: "txet", want: false},
+		{typ: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.typ.String(), func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.typ.IsValid(); got != tt.want {
+				t.Errorf("Unexpected validity for type %q: got %t, want %t", tt.typ, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuestionTypeWireFormat(t *testing.T) {
+	t.Parallel()
+
+	q := api.Question{}
+	if err := yaml.Unmarshal([]byte("Type: order\n"), &q); err != nil {
+		t.Fatalf("Could not decode yaml question: %v", err)
+	}
+	if got, want := q.Type, api.QuestionTypeOrder; got != want {
+		t.Errorf("Unexpected decoded type: got %s, want %s", got, want)
+	}
+
+	data, err := json.Marshal(api.Question{Type: api.QuestionTypeChoices})
+	if err != nil {
+		t.Fatalf("Could not encode json question: %v", err)
+	}
+	got := map[string]any{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Could not decode json question: %v", err)
+	}
+	if got, want := got["type"], "choices"; got != want {
+		t.Errorf("Unexpected encoded type: got %v, want %s", got, want)
+	}
+}
+
+func TestQuestionTimeYAML(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		yaml string
+		want time.Duration
+	}{
+		{name: "Duration string", yaml: "Title: q\nTime: 30s\n", want: 30 * time.Second},
+		{name: "Minutes string", yaml: "Title: q\nTime: 1m\n", want: time.Minute},
+		{name: "Bare integer as seconds", yaml: "Title: q\nTime: 45\n", want: 45 * time.Second},
+		{name: "Missing field", yaml: "Title: q\n", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			q := api.Question{}
+			if err := yaml.Unmarshal([]byte(tt.yaml), &q); err != nil {
+				t.Fatalf("Could not decode yaml question: %v", err)
+			}
+			if got := q.Time; got != tt.want {
+				t.Errorf("Unexpected question time: got %s, want %s", got, tt.want)
+			}
+			if got, want := q.Title, "q"; got != want {
+				t.Errorf("Unexpected question title: got %s, want %s", got, want)
+			}
+		})
+	}
+
+	data, err := json.Marshal(api.Question{Time: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("Could not encode json question: %v", err)
+	}
+	got := map[string]any{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Could not decode json question: %v", err)
+	}
+	if got, want := got["time"], float64(30*time.Second); got != want {
+		t.Errorf("Unexpected json question time: got %v, want %v", got, want)
+	}
+}
+
+func TestQuestionSanitized(t *testing.T) {
+	t.Parallel()
+
+	question := api.Question{
+		Title: "Order these cars by top speed",
+		Type:  api.QuestionTypeOrder,
+		OrderItems: []api.OrderItem{
+			{Name: "Bugatti Chiron"},
+			{Name: "Ferrari F40"},
+			{Name: "Citroen 2CV"},
+		},
+		Answer: &api.Answer{Order: []string{"Bugatti Chiron", "Ferrari F40", "Citroen 2CV"}},
+	}
+
+	got := question.Sanitized()
+
+	if got.Answer != nil {
+		t.Errorf("Sanitized question has an answer: %+v", got.Answer)
+	}
+	names := []string{}
+	for _, item := range got.OrderItems {
+		names = append(names, item.Name)
+	}
+	if diff := cmp.Diff([]string{"Bugatti Chiron", "Citroen 2CV", "Ferrari F40"}, names); diff != "" {
+		t.Errorf("Unexpected sanitized order items (-want+got):\n%v", diff)
+	}
+	if question.Answer == nil || question.OrderItems[1].Name != "Ferrari F40" {
+		t.Error("Original question was modified")
+	}
+
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("Could not encode sanitized question: %v", err)
+	}
+	if strings.Contains(string(data), `"answer"`) {
+		t.Errorf("Sanitized question json contains an answer: %s", data)
+	}
+}
+
+func TestQuestionSanitizedBoolean(t *testing.T) {
+	t.Parallel()
+
+	question := api.Question{
+		Title:  "The Ferrari F40 is faster than the 2CV",
+		Type:   api.QuestionTypeBoolean,
+		Answer: &api.Answer{Choices: []string{"true"}},
+	}
+
+	if diff := cmp.Diff(api.BooleanChoices(), question.Sanitized().Choices); diff != "" {
+		t.Errorf("Unexpected sanitized boolean choices (-want+got):\n%v", diff)
+	}
+}
+
+func TestQuestionCategories(t *testing.T) {
+	t.Parallel()
+
+	const authored = `
+Title: Fruits or vegetables ?
+Type: categories
+Choices: [apple, pear, carrot]
+Categories: [fruits, vegetables]
+Answer:
+  Categories:
+    fruits: [apple, pear]
+    vegetables: [carrot]
+`
+	question := api.Question{}
+	if err := yaml.Unmarshal([]byte(authored), &question); err != nil {
+		t.Fatalf("Could not decode yaml question: %v", err)
+	}
+	want := map[string][]string{"fruits": {"apple", "pear"}, "vegetables": {"carrot"}}
+	if question.Answer == nil {
+		t.Fatal("Categories question has no answer")
+	}
+	if diff := cmp.Diff(want, question.Answer.Categories); diff != "" {
+		t.Errorf("Unexpected answer categories (-want+got):\n%v", diff)
+	}
+
+	// The choices are no longer grouped by category once sanitized.
+	got := question.Sanitized()
+	if got.Answer != nil {
+		t.Errorf("Sanitized question has an answer: %+v", got.Answer)
+	}
+	if diff := cmp.Diff([]string{"apple", "carrot", "pear"}, got.Choices); diff != "" {
+		t.Errorf("Unexpected sanitized choices (-want+got):\n%v", diff)
+	}
+	if diff := cmp.Diff([]string{"apple", "pear", "carrot"}, question.Choices); diff != "" {
+		t.Errorf("Original choices were modified (-want+got):\n%v", diff)
+	}
+
+	clone := question.Clone()
+	clone.Answer.Categories["fruits"][0] = "banana"
+	if got := question.Answer.Categories["fruits"][0]; got != "apple" {
+		t.Errorf("Clone shares the answer categories: got %q, want %q", got, "apple")
+	}
+}
+
+func TestQuestionAnswersYAML(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		yaml         string
+		wantAnswer   api.Answer
+		wantVariants []api.Answer
+		wantErr      bool
+	}{
+		{
+			name:       "Single answer",
+			yaml:       "Title: q\nAnswer:\n  Text: Paris\n",
+			wantAnswer: api.Answer{Text: "Paris"},
+		},
+		{
+			name:         "Answers only",
+			yaml:         "Title: q\nAnswers:\n  - Text: Paris\n  - Text: Lutece\n",
+			wantAnswer:   api.Answer{Text: "Paris"},
+			wantVariants: []api.Answer{{Text: "Lutece"}},
+		},
+		{
+			name:         "Answer and variants",
+			yaml:         "Title: q\nAnswer:\n  Text: Paris\nAnswers:\n  - Text: Lutece\n",
+			wantAnswer:   api.Answer{Text: "Paris"},
+			wantVariants: []api.Answer{{Text: "Lutece"}},
+		},
+		{
+			name:         "Accept shorthand",
+			yaml:         "Title: q\nAnswer:\n  Text: Paris\n  Accept: [Lutece]\n",
+			wantAnswer:   api.Answer{Text: "Paris"},
+			wantVariants: []api.Answer{{Text: "Lutece"}},
+		},
+		{
+			name:    "Accept in variants",
+			yaml:    "Title: q\nAnswer:\n  Text: Paris\nAnswers:\n  - Text: Lutece\n    Accept: [Lutetia]\n",
+			wantErr: true,
+		},
+		{
+			name:    "Accept and variants",
+			yaml:    "Title: q\nAnswer:\n  Text: Paris\n  Accept: [Lutece]\nAnswers:\n  - Text: Lutetia\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			q := api.Question{}
+			err := yaml.Unmarshal([]byte(tt.yaml), &q)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Question decoding did not fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Could not decode yaml question: %v", err)
+			}
+			if q.Answer == nil {
+				t.Fatal("Question has no answer")
+			}
+			if diff := cmp.Diff(tt.wantAnswer, *q.Answer); diff != "" {
+				t.Errorf("Unexpected answer (-want+got):\n%v", diff)
+			}
+			if diff := cmp.Diff(tt.wantVariants, q.Answers, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Unexpected answer variants (-want+got):\n%v", diff)
+			}
+			if got := q.Sanitized(); got.Answer != nil || got.Answers != nil {
+				t.Errorf("Sanitized question has answers: %+v, %+v", got.Answer, got.Answers)
+			}
+		})
+	}
+}
@@ -1,6 +1,37 @@
 package api
 
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// QuizInfo holds a quiz metadata shown before playing it.
+// All fields are optional except QuestionCount, computed at load.
+type QuizInfo struct {
+	Title         string `json:"title,omitempty"       yaml:"Title"`
+	Description   string `json:"description,omitempty" yaml:"Description"`
+	Author        string `json:"author,omitempty"      yaml:"Author"`
+	Difficulty    string `json:"difficulty,omitempty"  yaml:"Difficulty"`
+	QuestionCount int    `json:"questionCount"         yaml:"-"`
+
+	// Durations sets the time of the quiz questions omitting it, by type.
+	Durations map[QuestionType]time.Duration `json:"durations,omitempty" yaml:"Durations"`
+}
+
 type Quiz struct {
+	QuizInfo
 	Name      string     `json:"name"`
 	Questions []Question `json:"questions"`
 }
+
+// Clone returns a deep copy of the quiz so that lobbies playing the
+// same quiz never share questions.
+func (q Quiz) Clone() Quiz {
+	q.Durations = maps.Clone(q.Durations)
+	q.Questions = slices.Clone(q.Questions)
+	for i, question := range q.Questions {
+		q.Questions[i] = question.Clone()
+	}
+	return q
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// requestSchemas lists the data sent along each request type.
+// A nil data means the request carries no data.
+var requestSchemas = []struct {
+	Type RequestType
+	Data any
+}{
+	{RequestTypeLobby, nil},
+	{RequestTypeRegister, RegisterRequestData{}},
+	{RequestTypeKick, KickRequestData{}},
+	{RequestTypeConfigure, LobbyConfigureRequestData{}},
+	{RequestTypeStart, nil},
+	{RequestTypeAnswer, AnswerRequestData{}},
+	{RequestTypeReview, ReviewRequestData{}},
+	{RequestTypePause, nil},
+	{RequestTypeResume, nil},
+	{RequestTypeLogin, LoginRequestData{}},
+	{RequestTypeReset, nil},
+}
+
+// Known reports if r is a request type handled by the server, in any
+// lobby state.
+func (r RequestType) Known() bool {
+	for _, s := range requestSchemas {
+		if s.Type == r {
+			return true
+		}
+	}
+	return false
+}
+
+// responseSchemas lists the data sent along each response type.
+// A nil data means the response carries no data.
+var responseSchemas = []struct {
+	Type ResponseType
+	Data any
+}{
+	{ResponseTypeError, WebsocketErrorData{}},
+	{ResponseTypeRegister, nil},
+	{ResponseTypeLobby, LobbyResponseData{}},
+	{ResponseTypeKick, nil},
+	{ResponseTypeKicked, KickedResponseData{}},
+	{ResponseTypePlayerUpdate, PlayerUpdateResponseData{}},
+	{ResponseTypePlayerList, PlayerListResponseData{}},
+	// Empty when acknowledging the owner, the quiz is set when broadcast.
+	{ResponseTypeConfigure, LobbyUpdateResponseData{}},
+	{ResponseTypeStart, StartResponseData{}},
+	{ResponseTypeCountdown, CountdownResponseData{}},
+	{ResponseTypeQuestion, QuestionResponseData{}},
+	{ResponseTypeAnswer, AnswerResponseData{}},
+	{ResponseTypeAnswerReveal, AnswerRevealResponseData{}},
+	{ResponseTypeQuizEnd, QuizEndResponseData{}},
+	{ResponseTypeReview, ReviewResponseData{}},
+	{ResponseTypeResults, ResultsResponseData{}},
+	{ResponseTypePause, nil},
+	{ResponseTypeResume, nil},
+	{ResponseTypeLogin, nil},
+	{ResponseTypeReset, nil},
+	{ResponseTypeLobbyClosed, LobbyClosedResponseData{}},
+}
+
+// Schema returns a JSON schema describing all websocket requests and
+// responses. Each message is a variant of the Request or Response
+// definitions, discriminated by its type.
+func Schema() ([]byte, error) {
+	g := schemaGenerator{defs: map[string]any{}}
+
+	requests := []any{}
+	for _, s := range requestSchemas {
+		requests = append(requests, g.message(string(s.Type), s.Data))
+	}
+	responses := []any{}
+	for _, s := range responseSchemas {
+		responses = append(responses, g.message(string(s.Type), s.Data))
+	}
+	g.defs["Request"] = map[string]any{"oneOf": requests}
+	g.defs["Response"] = map[string]any{"oneOf": responses}
+
+	return json.MarshalIndent(map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "SevenQuiz websocket API",
+		"$defs":   g.defs,
+	}, "", "  ")
+}
+
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+// message describes a request or response of a given type.
+func (g schemaGenerator) message(typ string, data any) map[string]any {
+	props := map[string]any{
+		"id":   map[string]any{"type": "string"},
+		"type": map[string]any{"const": typ},
+	}
+	if data != nil {
+		props["data"] = g.schema(reflect.TypeOf(data))
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": props,
+		"required":   []string{"type"},
+	}
+}
+
+// schema describes t, registering named structs in the definitions.
+func (g schemaGenerator) schema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return map[string]any{
+			"anyOf": []any{g.schema(t.Elem()), map[string]any{"type": "null"}},
+		}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil // Guard against recursive types.
+			g.defs[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 { // json.RawMessage or []byte.
+			return map[string]any{}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default: // Interfaces accept any value.
+		return map[string]any{}
+	}
+}
+
+// object describes a struct following the encoding/json field rules.
+// Embedded structs fields are promoted, omitempty fields are optional.
+func (g schemaGenerator) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	required := []string{}
+
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := range t.NumField() {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				walk(field.Type)
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			props[name] = g.schema(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	walk(t)
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": props,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,39 @@
+package api_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"sevenquiz-backend/api"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+const schemaGoldenFile = "testdata/schema.json"
+
+// TestSchema compares the generated schema with the checked-in one.
+// Run with -update after changing the API types.
+func TestSchema(t *testing.T) {
+	t.Parallel()
+
+	got, err := api.Schema()
+	if err != nil {
+		t.Fatalf("Could not generate schema: %v", err)
+	}
+	got = append(got, '\n')
+
+	if *update {
+		if err := os.WriteFile(schemaGoldenFile, got, 0o600); err != nil {
+			t.Fatalf("Could not update golden file: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(schemaGoldenFile)
+	if err != nil {
+		t.Fatalf("Could not read golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Generated schema differs from %s, run go test ./api -update", schemaGoldenFile)
+	}
+}
@@ -0,0 +1,24 @@
+// Command apischema prints the JSON schema of the websocket API
+// requests and responses.
+//
+// Usage:
+//
+//	go run ./cmd/apischema > schema.json
+package main
+
+import (
+	"log"
+	"os"
+
+	"sevenquiz-backend/api"
+)
+
+func main() {
+	schema, err := api.Schema()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := os.Stdout.Write(append(schema, '\n')); err != nil {
+		log.Fatal(err)
+	}
+}
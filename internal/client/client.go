@@ -3,8 +3,11 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"sevenquiz-backend/api"
+	"sync/atomic"
 	"time"
 
 	"github.com/coder/websocket"
@@ -15,14 +18,15 @@ var defaultTimeout = 5 * time.Second
 
 type Client struct {
 	conn    *websocket.Conn
-	timeout time.Duration
+	timeout atomic.Int64 // time.Duration
 }
 
 func NewClient(conn *websocket.Conn, timeout time.Duration) *Client {
-	return &Client{
-		conn:    conn,
-		timeout: timeout,
+	c := &Client{
+		conn: conn,
 	}
+	c.SetTimeout(timeout)
+	return c
 }
 
 func Dial(ctx context.Context, u string, opts *websocket.DialOptions) (*Client, *http.Response, error) {
@@ -30,66 +34,278 @@ func Dial(ctx context.Context, u string, opts *websocket.DialOptions) (*Client,
 	if err != nil {
 		return nil, res, err
 	}
-	return &Client{
-		conn:    conn,
-		timeout: defaultTimeout,
-	}, res, nil
+	return NewClient(conn, defaultTimeout), res, nil
+}
+
+// DialWithToken dials a lobby with the token smuggled in the
+// Sec-WebSocket-Protocol header, as expected by the server's
+// Subprotocols middleware. The sevenquiz subprotocol is offered first
+// for the server to select.
+func DialWithToken(ctx context.Context, u, token string) (*Client, *http.Response, error) {
+	return Dial(ctx, u, &websocket.DialOptions{
+		Subprotocols: []string{api.Subprotocol, "Bearer " + token},
+	})
+}
+
+// WithCompression returns a copy of opts negotiating permessage-deflate
+// compression, used if the lobby enables it. A nil opts is valid.
+func WithCompression(opts *websocket.DialOptions) *websocket.DialOptions {
+	o := websocket.DialOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.CompressionMode = websocket.CompressionContextTakeover
+	return &o
+}
+
+// SetTimeout sets the timeout applied to each command and read.
+// It is safe to call while commands are in flight, which keep their
+// original timeout.
+func (c *Client) SetTimeout(d time.Duration) {
+	c.timeout.Store(int64(d))
+}
+
+// Timeout returns the timeout applied to each command and read.
+func (c *Client) Timeout() time.Duration {
+	return time.Duration(c.timeout.Load())
 }
 
 func (c *Client) Close() {
 	c.conn.Close(websocket.StatusNormalClosure, "client closure")
 }
 
-func sendCmd[T any](c *Client, req T) (api.Response[json.RawMessage], error) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
-	if err := wsjson.Write(ctx, c.conn, req); err != nil {
+// withTimeout derives a context bounded by the client timeout.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, c.Timeout())
+}
+
+func sendCmd[T any](ctx context.Context, c *Client, req T) (api.Response[json.RawMessage], error) {
+	if err := writeCmd(ctx, c, req); err != nil {
 		return api.Response[json.RawMessage]{}, err
 	}
-	return c.ReadResponse()
+	return c.ReadResponseContext(ctx)
+}
+
+// sendAckCmd sends a request and reads its response, discarding the
+// broadcasts received meanwhile. Unlike sendCmd, it suits requests
+// acknowledged while the lobby keeps broadcasting, such as answers.
+func sendAckCmd[T any](ctx context.Context, c *Client, req T) (api.Response[json.RawMessage], error) {
+	if err := writeCmd(ctx, c, req); err != nil {
+		return api.Response[json.RawMessage]{}, err
+	}
+	for {
+		res, err := c.ReadResponseContext(ctx)
+		if err != nil || res.Seq == 0 {
+			return res, err
+		}
+	}
+}
+
+// writeCmd sends a request without waiting for a response, for requests
+// the server does not acknowledge.
+func writeCmd[T any](ctx context.Context, c *Client, req T) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return wsjson.Write(ctx, c.conn, req)
 }
 
 func (c *Client) ReadResponse() (api.Response[json.RawMessage], error) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	return c.ReadResponseContext(context.Background())
+}
+
+// ReadResponseContext reads the next response until ctx is done or the
+// client timeout expires.
+//
+// As with any read, a cancelled ctx closes the underlying conn.
+func (c *Client) ReadResponseContext(ctx context.Context) (api.Response[json.RawMessage], error) {
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 	res := api.Response[json.RawMessage]{}
-	err := wsjson.Read(ctx, c.conn, &res)
+	err := c.read(ctx, &res)
 	return res, err
 }
 
+// read reads a message, reporting the ctx error if ctx ended the read
+// as the conn may fail first while being closed.
+func (c *Client) read(ctx context.Context, v any) error {
+	err := wsjson.Read(ctx, c.conn, v)
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		return fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+	return err
+}
+
+// WaitFor reads responses until one of type want arrives, discarding
+// the others. The client timeout applies if ctx has no deadline.
+//
+// As with any read, a cancelled ctx closes the underlying conn.
+func (c *Client) WaitFor(ctx context.Context, want api.ResponseType) (api.Response[json.RawMessage], error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = c.withTimeout(ctx)
+		defer cancel()
+	}
+	for {
+		res := api.Response[json.RawMessage]{}
+		if err := c.read(ctx, &res); err != nil {
+			return res, err
+		}
+		if res.Type == want {
+			return res, nil
+		}
+	}
+}
+
+// Events streams all responses read from the conn. The channel is closed
+// once ctx is done or the conn is closed.
+//
+// Reads are owned by the stream, so the client must not be used to send
+// commands or read responses while it runs.
+func (c *Client) Events(ctx context.Context) <-chan api.Response[json.RawMessage] {
+	events := make(chan api.Response[json.RawMessage])
+	go func() {
+		defer close(events)
+		for {
+			res := api.Response[json.RawMessage]{}
+			if err := wsjson.Read(ctx, c.conn, &res); err != nil {
+				return
+			}
+			select {
+			case events <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+
 func (c *Client) Lobby() (api.Response[json.RawMessage], error) {
+	return c.LobbyContext(context.Background())
+}
+
+func (c *Client) LobbyContext(ctx context.Context) (api.Response[json.RawMessage], error) {
 	req := api.Request[api.EmptyRequestData]{
 		Type: api.RequestTypeLobby,
 	}
-	return sendCmd(c, req)
+	return sendCmd(ctx, c, req)
 }
 
 func (c *Client) Register(username string) (api.Response[json.RawMessage], error) {
+	return c.RegisterContext(context.Background(), username)
+}
+
+func (c *Client) RegisterContext(ctx context.Context, username string) (api.Response[json.RawMessage], error) {
 	req := api.Request[api.RegisterRequestData]{
 		Type: api.RequestTypeRegister,
 		Data: api.RegisterRequestData{
 			Username: username,
 		},
 	}
-	return sendCmd(c, req)
+	return sendCmd(ctx, c, req)
+}
+
+func (c *Client) Login(token string) (api.Response[json.RawMessage], error) {
+	return c.LoginContext(context.Background(), token)
+}
+
+func (c *Client) LoginContext(ctx context.Context, token string) (api.Response[json.RawMessage], error) {
+	req := api.Request[api.LoginRequestData]{
+		Type: api.RequestTypeLogin,
+		Data: api.LoginRequestData{
+			Token: token,
+		},
+	}
+	return sendCmd(ctx, c, req)
 }
 
 func (c *Client) Kick(username string) (api.Response[json.RawMessage], error) {
+	return c.KickContext(context.Background(), username)
+}
+
+func (c *Client) KickContext(ctx context.Context, username string) (api.Response[json.RawMessage], error) {
 	req := api.Request[api.KickRequestData]{
 		Type: api.RequestTypeKick,
 		Data: api.KickRequestData{
 			Username: username,
 		},
 	}
-	return sendCmd(c, req)
+	return sendCmd(ctx, c, req)
 }
 
 func (c *Client) Configure(quiz string) (api.Response[json.RawMessage], error) {
+	return c.ConfigureContext(context.Background(), quiz)
+}
+
+func (c *Client) ConfigureContext(ctx context.Context, quiz string) (api.Response[json.RawMessage], error) {
 	req := api.Request[api.LobbyConfigureRequestData]{
 		Type: api.RequestTypeConfigure,
 		Data: api.LobbyConfigureRequestData{
 			Quiz: quiz,
 		},
 	}
-	return sendCmd(c, req)
+	return sendCmd(ctx, c, req)
+}
+
+func (c *Client) Start() (api.Response[json.RawMessage], error) {
+	return c.StartContext(context.Background())
+}
+
+func (c *Client) StartContext(ctx context.Context) (api.Response[json.RawMessage], error) {
+	req := api.Request[api.EmptyRequestData]{
+		Type: api.RequestTypeStart,
+	}
+	return sendCmd(ctx, c, req)
+}
+
+// Answer submits an answer to the question questionID and returns the
+// answer recorded by the server, read from its acknowledgement.
+// An error response is returned as an error.
+func (c *Client) Answer(questionID int, a api.Answer) (api.AnswerResponseData, error) {
+	return c.AnswerContext(context.Background(), questionID, a)
+}
+
+func (c *Client) AnswerContext(ctx context.Context, questionID int, a api.Answer) (api.AnswerResponseData, error) {
+	req := api.Request[api.AnswerRequestData]{
+		Type: api.RequestTypeAnswer,
+		Data: api.AnswerRequestData{
+			QuestionID: &questionID,
+			Answer:     a,
+		},
+	}
+	res, err := sendAckCmd(ctx, c, req)
+	if err != nil {
+		return api.AnswerResponseData{}, err
+	}
+	if res.Type != api.ResponseTypeAnswer {
+		return api.AnswerResponseData{}, fmt.Errorf("answer not acknowledged: %s response: %s", res.Type, res.Message)
+	}
+	return api.DecodeJSON[api.AnswerResponseData](res.Data)
+}
+
+func (c *Client) Review(validate bool) (api.Response[json.RawMessage], error) {
+	return c.ReviewContext(context.Background(), validate)
+}
+
+func (c *Client) ReviewContext(ctx context.Context, validate bool) (api.Response[json.RawMessage], error) {
+	req := api.Request[api.ReviewRequestData]{
+		Type: api.RequestTypeReview,
+		Data: api.ReviewRequestData{
+			Validate: validate,
+		},
+	}
+	return sendCmd(ctx, c, req)
+}
+
+// Reset sets a lobby whose quiz is over back to registration, keeping
+// its players. The reset is broadcasted, no response is sent.
+func (c *Client) Reset() error {
+	return c.ResetContext(context.Background())
+}
+
+func (c *Client) ResetContext(ctx context.Context) error {
+	req := api.Request[api.EmptyRequestData]{
+		Type: api.RequestTypeReset,
+	}
+	return writeCmd(ctx, c, req)
 }
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sevenquiz-backend/api"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// Backoff configures the delays between reconnection attempts.
+// The delay doubles after each failed attempt.
+type Backoff struct {
+	// Min is the delay before the first reconnection attempt.
+	//
+	// Default is 100ms.
+	Min time.Duration
+
+	// Max caps the delay between two attempts.
+	//
+	// Default is 10s.
+	Max time.Duration
+}
+
+func (b Backoff) delay(attempt int) time.Duration {
+	if b.Min <= 0 {
+		b.Min = 100 * time.Millisecond
+	}
+	if b.Max <= 0 {
+		b.Max = 10 * time.Second
+	}
+	d := b.Min
+	for range attempt {
+		if d >= b.Max/2 {
+			return b.Max
+		}
+		d *= 2
+	}
+	return min(d, b.Max)
+}
+
+// errFatal marks errors on which reconnecting is pointless.
+var errFatal = errors.New("fatal")
+
+// DialReconnecting dials a lobby with token and logs in, then streams all
+// responses on the returned channel.
+//
+// On a dropped conn, the lobby is redialed with backoff and the login is
+// replayed along the seq of the last broadcast received, so the lobby
+// replays the broadcasts missed. Broadcasts already received are dropped.
+// The channel is closed once ctx is done or on a fatal error:
+// the lobby closed the conn, rejected the token or does not exist anymore.
+func DialReconnecting(ctx context.Context, u, token string, backoff Backoff) (<-chan api.Response[json.RawMessage], error) {
+	cli, err := dialLogin(ctx, u, token, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan api.Response[json.RawMessage])
+	go func() {
+		defer close(events)
+		var lastSeq uint64
+		for {
+			err := cli.forward(ctx, events, &lastSeq)
+			cli.conn.CloseNow()
+			if ctx.Err() != nil || errors.Is(err, errFatal) {
+				return
+			}
+			if cli, err = redial(ctx, u, token, lastSeq, backoff); err != nil {
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// redial dials the lobby until success, ctx is done or a fatal error occurs.
+func redial(ctx context.Context, u, token string, lastSeq uint64, backoff Backoff) (*Client, error) {
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff.delay(attempt)):
+		}
+		cli, err := dialLogin(ctx, u, token, lastSeq)
+		if err == nil || errors.Is(err, errFatal) {
+			return cli, err
+		}
+	}
+}
+
+// dialLogin dials the lobby and sends a login request. The login response
+// is read along with other responses.
+func dialLogin(ctx context.Context, u, token string, lastSeq uint64) (*Client, error) {
+	cli, res, err := DialWithToken(ctx, u, token)
+	if err != nil {
+		// The lobby answered the handshake, retrying will not help.
+		if res != nil && res.StatusCode >= http.StatusBadRequest && res.StatusCode < http.StatusInternalServerError {
+			return nil, fmt.Errorf("%w: dial: %w", errFatal, err)
+		}
+		return nil, err
+	}
+	req := api.Request[api.LoginRequestData]{
+		Type: api.RequestTypeLogin,
+		Data: api.LoginRequestData{
+			Token:   token,
+			LastSeq: lastSeq,
+		},
+	}
+	if err := writeCmd(ctx, cli, req); err != nil {
+		cli.conn.CloseNow()
+		return nil, err
+	}
+	return cli, nil
+}
+
+// forward sends all responses read to events until the conn fails.
+// Broadcasts numbered up to lastSeq were already sent and are dropped,
+// lastSeq being updated with each broadcast sent.
+func (c *Client) forward(ctx context.Context, events chan<- api.Response[json.RawMessage], lastSeq *uint64) error {
+	for {
+		res := api.Response[json.RawMessage]{}
+		if err := wsjson.Read(ctx, c.conn, &res); err != nil {
+			switch websocket.CloseStatus(err) {
+			case websocket.StatusNormalClosure, websocket.StatusPolicyViolation:
+				// Closed on purpose by the lobby.
+				return fmt.Errorf("%w: %w", errFatal, err)
+			}
+			return err
+		}
+
+		if res.Seq > 0 {
+			if res.Seq <= *lastSeq {
+				continue
+			}
+			*lastSeq = res.Seq
+		}
+
+		select {
+		case events <- res:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if res.Type == api.ResponseTypeError {
+			data, err := api.DecodeJSON[api.WebsocketErrorData](res.Data)
+			if err == nil && data.Request == api.RequestTypeLogin {
+				return fmt.Errorf("%w: login: %s", errFatal, data.Message)
+			}
+		}
+	}
+}
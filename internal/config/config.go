@@ -1,8 +1,11 @@
 package config
 
 import (
+	"fmt"
+	"log/slog"
 	"os"
 	"reflect"
+	"sevenquiz-backend/api"
 	"time"
 
 	env "github.com/caarlos0/env/v11"
@@ -10,20 +13,117 @@ import (
 )
 
 type LobbyConf struct {
-	MaxPlayers         int           `env:"MAX_PLAYERS"          envDefault:"25"`
-	RegisterTimeout    time.Duration `env:"REGISTER_TIMEOUT"     envDefault:"15m"`
-	WebsocketReadLimit int64         `env:"WEBSOCKET_READ_LIMIT" envDefault:"512"`
+	IDLength        int           `env:"ID_LENGTH"        envDefault:"5"`
+	MaxPlayers      int           `env:"MAX_PLAYERS"      envDefault:"25"`
+	MinPlayers      int           `env:"MIN_PLAYERS"      envDefault:"1"`
+	MaxLobbies      int           `env:"MAX_LOBBIES"      envDefault:"1000"`
+	RegisterTimeout time.Duration `env:"REGISTER_TIMEOUT" envDefault:"15m"`
+	WriteTimeout    time.Duration `env:"WRITE_TIMEOUT"    envDefault:"2s"`
+	QueueSize       int           `env:"QUEUE_SIZE"       envDefault:"64"`
+	HistorySize     int           `env:"HISTORY_SIZE"     envDefault:"256"`
+	StartCountdown  time.Duration `env:"START_COUNTDOWN"  envDefault:"0s"`
+
+	// InterQuestionDelay pauses the quiz between two questions, leaving
+	// players time to see the reveal. Zero chains the questions.
+	InterQuestionDelay time.Duration `env:"INTER_QUESTION_DELAY" envDefault:"0s"`
+
+	// ResultsHold keeps a lobby open once its results are broadcasted so
+	// the owner may reset the game and play again with the same players.
+	ResultsHold time.Duration `env:"RESULTS_HOLD" envDefault:"1m"`
+
+	// RegisterGracePeriod is how long a conn may stay in a lobby without
+	// registering before being closed. Zero disables it.
+	RegisterGracePeriod time.Duration `env:"REGISTER_GRACE_PERIOD" envDefault:"30s"`
+
+	// CountRegisteredOnly applies MAX_PLAYERS to the registered players
+	// instead of all the conns of a lobby, so that conns which never
+	// register cannot fill it.
+	CountRegisteredOnly bool `env:"COUNT_REGISTERED_ONLY" envDefault:"false"`
+
+	// QuestionDurations sets the time of questions omitting it by type,
+	// such as "map:1m,order:45s". Quizzes may set their own in quiz.yml.
+	QuestionDurations map[api.QuestionType]time.Duration `env:"QUESTION_DURATIONS"`
+
+	// IdempotencyTTL is how long an Idempotency-Key of a lobby creation
+	// is remembered, a retry within it gets the same lobby back.
+	IdempotencyTTL time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"1m"`
+
+	// WebsocketReadLimit caps the size of messages read from conns which
+	// did not register yet. A message over the limit closes the conn.
+	WebsocketReadLimit int64 `env:"WEBSOCKET_READ_LIMIT" envDefault:"512"`
+
+	// PlayerReadLimit raises the read limit once a conn registered or
+	// logged in, as 512 bytes is too small for some answers such as
+	// order or categories ones. Zero keeps WebsocketReadLimit.
+	PlayerReadLimit int64 `env:"PLAYER_READ_LIMIT" envDefault:"8192"`
+
+	// Compression negotiates permessage-deflate with clients supporting it.
+	// Context takeover is used as most messages are small but alike, which
+	// halves the size of the question broadcasts of the bundled quizzes at
+	// the cost of a compression context kept per conn.
+	Compression bool `env:"COMPRESSION" envDefault:"false"`
+
+	// HTTPAnswers serves POST /lobby/{id}/answer for clients behind
+	// networks blocking websockets during the quiz.
+	HTTPAnswers bool `env:"HTTP_ANSWERS" envDefault:"false"`
 }
 
 type CORSConf struct {
 	AllowedOrigins []string `env:"ALLOWED_ORIGINS" envDefault:"*"`
 }
 
+type QuizzesConf struct {
+	Dir                 string `env:"DIR"`
+	MaxQuizzes          int    `env:"MAX"                    envDefault:"100"`
+	MaxQuestionsPerQuiz int    `env:"MAX_QUESTIONS_PER_QUIZ" envDefault:"200"`
+}
+
+// LogFormat selects the encoding of the log records.
+type LogFormat string
+
+const (
+	LogFormatJSON LogFormat = "json"
+	LogFormatText LogFormat = "text"
+)
+
+func (f *LogFormat) UnmarshalText(text []byte) error {
+	switch format := LogFormat(text); format {
+	case LogFormatJSON, LogFormatText:
+		*f = format
+		return nil
+	default:
+		return fmt.Errorf("invalid log format %q, want json or text", text)
+	}
+}
+
+type LogConf struct {
+	// Level drops the records below it, one of debug, info, warn or
+	// error with an optional offset such as warn+2.
+	Level  slog.Level `env:"LEVEL"  envDefault:"info"`
+	Format LogFormat  `env:"FORMAT" envDefault:"json"`
+}
+
 type Config struct {
-	JWTSecret         []byte    `env:"JWT_SECRET"`
-	CORS              CORSConf  `envPrefix:"CORS_"`
-	Lobby             LobbyConf `envPrefix:"LOBBY_"`
-	RequestsRateLimit int       `env:"REQUESTS_RATE_LIMIT" envDefault:"30"`
+	JWTSecret         []byte      `env:"JWT_SECRET"`
+	AdminToken        []byte      `env:"ADMIN_TOKEN"`
+	MediaBaseURL      string      `env:"MEDIA_BASE_URL"`
+	CORS              CORSConf    `envPrefix:"CORS_"`
+	Lobby             LobbyConf   `envPrefix:"LOBBY_"`
+	Quizzes           QuizzesConf `envPrefix:"QUIZZES_"`
+	Log               LogConf     `envPrefix:"LOG_"`
+	RequestsRateLimit int         `env:"REQUESTS_RATE_LIMIT" envDefault:"30"`
+
+	// TrustProxy takes the client IP rate limited from X-Forwarded-For,
+	// only to enable behind a proxy setting it.
+	TrustProxy bool `env:"TRUST_PROXY" envDefault:"false"`
+
+	// CreateLobbyRateLimit caps the lobbies created per second by all
+	// clients, over which the server answers 429. Zero disables it.
+	CreateLobbyRateLimit int `env:"CREATE_LOBBY_RATE_LIMIT" envDefault:"10"`
+
+	// CreateLobbyIPRateLimit caps the lobbies created per second by a
+	// single client IP. Zero disables it.
+	CreateLobbyIPRateLimit int `env:"CREATE_LOBBY_IP_RATE_LIMIT" envDefault:"1"`
 }
 
 func LoadConfig(path string) (Config, error) {
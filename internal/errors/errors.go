@@ -4,20 +4,36 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"sevenquiz-backend/api"
+	"strconv"
+	"time"
 
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
 )
 
 var errorCodeHTTPStatusCode = map[api.HTTPErrorCode]int{
-	api.MissingURLQueryHTTPCode:     http.StatusBadRequest,
-	api.InternalServerErrorHTTPCode: http.StatusInternalServerError,
-	api.InvalidTokenErrorHTTPCode:   http.StatusForbidden,
-	api.InvalidTokenClaimHTTPCode:   http.StatusForbidden,
-	api.UnauthorizedErrorHTTPCode:   http.StatusUnauthorized,
+	api.MissingURLQueryHTTPCode:      http.StatusBadRequest,
+	api.InternalServerErrorHTTPCode:  http.StatusInternalServerError,
+	api.InvalidTokenErrorHTTPCode:    http.StatusForbidden,
+	api.InvalidTokenClaimHTTPCode:    http.StatusForbidden,
+	api.UnauthorizedErrorHTTPCode:    http.StatusUnauthorized,
+	api.NoLobbySlotAvailableHTTPCode: http.StatusServiceUnavailable,
+	api.LobbyNotFoundHTTPCode:        http.StatusNotFound,
+	api.MediaNotFoundHTTPCode:        http.StatusNotFound,
+	api.QuizNotFoundHTTPCode:         http.StatusNotFound,
+	api.InvalidInputHTTPCode:         http.StatusBadRequest,
+	api.TooManyPlayersHTTPCode:       http.StatusServiceUnavailable,
+	api.RateLimitedHTTPCode:          http.StatusTooManyRequests,
+	api.ForbiddenOriginHTTPCode:      http.StatusForbidden,
+	api.TooManyLobbiesHTTPCode:       http.StatusServiceUnavailable,
+	api.ResultsNotReadyHTTPCode:      http.StatusConflict,
+	api.TooManyRequestsHTTPCode:      http.StatusTooManyRequests,
+	api.QuestionClosedHTTPCode:       http.StatusConflict,
+	api.DrainingHTTPCode:             http.StatusServiceUnavailable,
 }
 
 func WriteHTTPError(ctx context.Context, w http.ResponseWriter, err error) {
@@ -43,6 +59,8 @@ func WriteHTTPError(ctx context.Context, w http.ResponseWriter, err error) {
 		res.Code = apiErr.Code
 		res.Message = apiErr.Message
 		res.Extra = apiErr.Extra
+		res.Retryable = apiErr.Retryable
+		res.RetryAfter = apiErr.RetryAfterSeconds()
 		if code, ok := errorCodeHTTPStatusCode[apiErr.Code]; ok {
 			statusCode = code
 		}
@@ -50,12 +68,16 @@ func WriteHTTPError(ctx context.Context, w http.ResponseWriter, err error) {
 		res.Code = api.InternalServerErrorHTTPCode
 		res.Message = "unexpected error"
 	}
+	res.Message = HTTPMessage(Locale(ctx), res.Code, res.Message)
 
 	slog.ErrorContext(ctx, "http error",
 		slog.Any("error", err),
 		slog.Any("error_code", res.Code),
 		slog.Int("status_code", statusCode))
 
+	if res.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(res.RetryAfter))
+	}
 	w.WriteHeader(statusCode)
 
 	if err := json.NewEncoder(w).Encode(res); err != nil {
@@ -63,8 +85,29 @@ func WriteHTTPError(ctx context.Context, w http.ResponseWriter, err error) {
 	}
 }
 
+type ctxKey int
+
+const (
+	// RequestIDKey holds the slog.Attr of the id of the request being
+	// handled, echoed in the websocket responses written with the context.
+	RequestIDKey ctxKey = iota
+
+	// localeKey holds the locale of the client being served.
+	localeKey
+)
+
+// RequestID returns the id of the request being handled, if any.
+func RequestID(ctx context.Context) string {
+	a, ok := ctx.Value(RequestIDKey).(slog.Attr)
+	if !ok {
+		return ""
+	}
+	return a.Value.String()
+}
+
 func WriteWebsocketError(ctx context.Context, conn *websocket.Conn, err error) {
 	res := api.Response[api.WebsocketErrorData]{
+		ID:   RequestID(ctx),
 		Type: api.ResponseTypeError,
 	}
 
@@ -81,13 +124,17 @@ func WriteWebsocketError(ctx context.Context, conn *websocket.Conn, err error) {
 
 	apiErr := &api.ErrorData[api.WebsocketErrorCode]{}
 	if errors.As(err, apiErr) {
+		res.Data.Request = apiErr.Request
 		res.Data.Code = apiErr.Code
 		res.Data.Message = apiErr.Message
 		res.Data.Extra = apiErr.Extra
+		res.Data.Retryable = apiErr.Retryable
+		res.Data.RetryAfter = apiErr.RetryAfterSeconds()
 	} else {
 		res.Data.Code = api.InternalServerErrorCode
 		res.Data.Message = "unexpected error"
 	}
+	res.Data.Message = WebsocketMessage(Locale(ctx), res.Data.Code, res.Data.Message)
 
 	slog.ErrorContext(ctx, "ws error",
 		slog.Any("error", err),
@@ -161,6 +208,56 @@ func LobbyNotFoundError(lobbyID string) api.ErrorData[api.WebsocketErrorCode] {
 	}
 }
 
+func HTTPLobbyNotFoundError(lobbyID string) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:    api.LobbyNotFoundHTTPCode,
+		Message: "lobby not found",
+		Extra: struct {
+			LobbyID string `json:"lobbyID"`
+		}{
+			LobbyID: lobbyID,
+		},
+	}
+}
+
+func ForbiddenOriginError(origin string) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:    api.ForbiddenOriginHTTPCode,
+		Message: "origin not allowed",
+		Extra: struct {
+			Origin string `json:"origin"`
+		}{
+			Origin: origin,
+		},
+	}
+}
+
+func MediaNotFoundError(quiz, file string) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:    api.MediaNotFoundHTTPCode,
+		Message: "media not found",
+		Extra: struct {
+			Quiz string `json:"quiz"`
+			File string `json:"file"`
+		}{
+			Quiz: quiz,
+			File: file,
+		},
+	}
+}
+
+func HTTPQuizNotFoundError(quiz string) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:    api.QuizNotFoundHTTPCode,
+		Message: "quiz not found",
+		Extra: struct {
+			Quiz string `json:"quiz"`
+		}{
+			Quiz: quiz,
+		},
+	}
+}
+
 func PlayerFoundError(req api.RequestType, username string) api.ErrorData[api.WebsocketErrorCode] {
 	return api.ErrorData[api.WebsocketErrorCode]{
 		Request: req,
@@ -187,10 +284,33 @@ func QuizNotFoundError(req api.RequestType, quiz string) api.ErrorData[api.Webso
 	}
 }
 
+func NoReviewPendingError(req api.RequestType) api.ErrorData[api.WebsocketErrorCode] {
+	return api.ErrorData[api.WebsocketErrorCode]{
+		Request: req,
+		Code:    api.NoReviewPendingErrorCode,
+		Message: "no review pending",
+	}
+}
+
+func NotEnoughPlayersError(req api.RequestType, minPlayers int) api.ErrorData[api.WebsocketErrorCode] {
+	return api.ErrorData[api.WebsocketErrorCode]{
+		Request:   req,
+		Code:      api.NotEnoughPlayersCode,
+		Message:   "not enough players",
+		Retryable: true,
+		Extra: struct {
+			MinPlayers int `json:"minPlayers"`
+		}{
+			MinPlayers: minPlayers,
+		},
+	}
+}
+
 func TooManyPlayersError(maxPlayers int) api.ErrorData[api.WebsocketErrorCode] {
 	return api.ErrorData[api.WebsocketErrorCode]{
-		Code:    api.TooManyPlayersCode,
-		Message: "too many players",
+		Code:      api.TooManyPlayersCode,
+		Message:   "too many players",
+		Retryable: true,
 		Extra: struct {
 			MaxPlayers int `json:"maxPlayers"`
 		}{
@@ -225,20 +345,154 @@ func UsernameAlreadyExistsError(req api.RequestType, username string) api.ErrorD
 	}
 }
 
+func UsernameBannedError(req api.RequestType, username string) api.ErrorData[api.WebsocketErrorCode] {
+	return api.ErrorData[api.WebsocketErrorCode]{
+		Request: req,
+		Code:    api.UsernameBannedCode,
+		Message: "username is banned from the lobby",
+		Extra: struct {
+			Username string `json:"username"`
+		}{
+			Username: username,
+		},
+	}
+}
+
+// WrongLobbyStateError is returned when a known request is sent while
+// the lobby state does not allow it, such as an answer while registering.
+func WrongLobbyStateError(req api.RequestType, state string) api.ErrorData[api.WebsocketErrorCode] {
+	return api.ErrorData[api.WebsocketErrorCode]{
+		Request: req,
+		Code:    api.WrongLobbyStateCode,
+		Message: fmt.Sprintf("%s is not allowed in state %s", req, state),
+		Extra: struct {
+			State string `json:"state"`
+		}{
+			State: state,
+		},
+	}
+}
+
+// NotRegisteredError is returned when a conn sends a game command
+// before registering or logging in as a player.
+func NotRegisteredError(req api.RequestType) api.ErrorData[api.WebsocketErrorCode] {
+	return api.ErrorData[api.WebsocketErrorCode]{
+		Request: req,
+		Code:    api.NotRegisteredCode,
+		Message: "must register first",
+	}
+}
+
+func HTTPTooManyPlayersError(maxPlayers int) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:    api.TooManyPlayersHTTPCode,
+		Message: "too many players",
+		Extra: struct {
+			MaxPlayers int `json:"maxPlayers"`
+		}{
+			MaxPlayers: maxPlayers,
+		},
+		Retryable: true,
+	}
+}
+
+func RateLimitedError(retryAfter time.Duration) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:       api.RateLimitedHTTPCode,
+		Message:    "too many requests",
+		Retryable:  true,
+		RetryAfter: retryAfter,
+	}
+}
+
+// TooManyRequestsError is returned when the server as a whole receives
+// more requests than it accepts, unlike RateLimitedError which is bound
+// to a single client.
+func TooManyRequestsError(retryAfter time.Duration) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:       api.TooManyRequestsHTTPCode,
+		Message:    "server overloaded, too many requests",
+		Retryable:  true,
+		RetryAfter: retryAfter,
+	}
+}
+
+// DrainingError is returned for new lobbies while the server drains
+// ahead of a shutdown, another instance being expected to take them.
+func DrainingError() api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:      api.DrainingHTTPCode,
+		Message:   "server draining, please retry later",
+		Retryable: true,
+	}
+}
+
 func HTTPInternalServerError(err error) api.ErrorData[api.HTTPErrorCode] {
 	return api.ErrorData[api.HTTPErrorCode]{
-		Code:    api.InternalServerErrorHTTPCode,
-		Message: "internal server error",
-		Err:     err,
+		Code:      api.InternalServerErrorHTTPCode,
+		Message:   "internal server error",
+		Err:       err,
+		Retryable: true,
+	}
+}
+
+func NoLobbySlotAvailableError(err error) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:      api.NoLobbySlotAvailableHTTPCode,
+		Message:   "no lobby slot available, please retry later",
+		Err:       err,
+		Retryable: true,
+	}
+}
+
+func TooManyLobbiesError(maxLobbies int) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:    api.TooManyLobbiesHTTPCode,
+		Message: "too many lobbies, please retry later",
+		Extra: struct {
+			MaxLobbies int `json:"maxLobbies"`
+		}{
+			MaxLobbies: maxLobbies,
+		},
+		Retryable: true,
+	}
+}
+
+func ResultsNotReadyError(state string) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:    api.ResultsNotReadyHTTPCode,
+		Message: "results are not available until the quiz ends",
+		Extra: struct {
+			State string `json:"state"`
+		}{
+			State: state,
+		},
+	}
+}
+
+// QuestionClosedError is returned when answering over HTTP while no
+// question is open for answers.
+func QuestionClosedError(err error) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Request: api.RequestTypeAnswer,
+		Code:    api.QuestionClosedHTTPCode,
+		Message: "no question in progress",
+		Extra: struct {
+			Cause string `json:"cause"`
+		}{
+			Cause: err.Error(),
+		},
+		Err: err,
 	}
 }
 
 func InternalServerError(err error, req api.RequestType) api.ErrorData[api.WebsocketErrorCode] {
 	return api.ErrorData[api.WebsocketErrorCode]{
-		Request: req,
-		Code:    api.InternalServerErrorCode,
-		Message: "internal server error",
-		Err:     err,
+		Request:   req,
+		Code:      api.InternalServerErrorCode,
+		Message:   "internal server error",
+		Err:       err,
+		Retryable: true,
 	}
 }
 
@@ -288,3 +542,12 @@ func InputValidationError(err error, req api.RequestType, fields map[string]stri
 		Err:     err,
 	}
 }
+
+func HTTPInputValidationError(err error, fields map[string]string) api.ErrorData[api.HTTPErrorCode] {
+	return api.ErrorData[api.HTTPErrorCode]{
+		Code:    api.InvalidInputHTTPCode,
+		Message: "invalid input",
+		Extra:   fields,
+		Err:     err,
+	}
+}
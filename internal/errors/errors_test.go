@@ -0,0 +1,69 @@
+package errors_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sevenquiz-backend/api"
+	errs "sevenquiz-backend/internal/errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteHTTPErrorRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		err            error
+		wantStatus     int
+		wantRetryAfter string
+		want           api.HTTPErrorData
+	}{
+		"rate limited": {
+			err:            errs.RateLimitedError(1500 * time.Millisecond),
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: "2",
+			want: api.HTTPErrorData{
+				Code:       api.RateLimitedHTTPCode,
+				Message:    "too many requests",
+				Retryable:  true,
+				RetryAfter: 2,
+			},
+		},
+		"invalid token": {
+			err:        errs.InvalidTokenError(errors.New("bad signature"), api.RequestTypeLogin),
+			wantStatus: http.StatusForbidden,
+			want: api.HTTPErrorData{
+				Code:    api.InvalidTokenErrorHTTPCode,
+				Message: "invalid token",
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			errs.WriteHTTPError(context.Background(), rec, tc.err)
+
+			if got := rec.Code; got != tc.wantStatus {
+				t.Errorf("Unexpected status code: got %d, want %d", got, tc.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tc.wantRetryAfter {
+				t.Errorf("Unexpected Retry-After header: got %q, want %q", got, tc.wantRetryAfter)
+			}
+
+			got := api.HTTPErrorData{}
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("Could not decode error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected error (-want+got):\n%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package errors
+
+import (
+	"cmp"
+	"context"
+	"sevenquiz-backend/api"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is the locale of the messages set by the error
+// constructors, used when no catalog matches the requested locale.
+const DefaultLocale = "en"
+
+// WithLocale returns a copy of ctx in which error messages are localized
+// to locale.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey, locale)
+}
+
+// Locale returns the locale set with WithLocale, or DefaultLocale.
+func Locale(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey).(string); ok && locale != "" {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// catalog holds the localized messages of each error code.
+type catalog struct {
+	http      map[api.HTTPErrorCode]string
+	websocket map[api.WebsocketErrorCode]string
+}
+
+// catalogs holds the translations of the english messages of the error
+// constructors, by locale.
+var catalogs = map[string]catalog{
+	"fr": {
+		http: map[api.HTTPErrorCode]string{
+			api.MissingURLQueryHTTPCode:      "paramètre d'url manquant",
+			api.InternalServerErrorHTTPCode:  "erreur interne du serveur",
+			api.InvalidTokenErrorHTTPCode:    "jeton invalide",
+			api.InvalidTokenClaimHTTPCode:    "contenu du jeton invalide",
+			api.UnauthorizedErrorHTTPCode:    "non autorisé",
+			api.NoLobbySlotAvailableHTTPCode: "aucun salon disponible, veuillez réessayer plus tard",
+			api.LobbyNotFoundHTTPCode:        "salon introuvable",
+			api.MediaNotFoundHTTPCode:        "média introuvable",
+			api.QuizNotFoundHTTPCode:         "quiz introuvable",
+			api.InvalidInputHTTPCode:         "saisie invalide",
+			api.TooManyPlayersHTTPCode:       "trop de joueurs",
+			api.RateLimitedHTTPCode:          "trop de requêtes",
+			api.ForbiddenOriginHTTPCode:      "origine non autorisée",
+			api.TooManyLobbiesHTTPCode:       "trop de salons, veuillez réessayer plus tard",
+			api.ResultsNotReadyHTTPCode:      "les résultats ne sont pas disponibles avant la fin du quiz",
+			api.TooManyRequestsHTTPCode:      "serveur surchargé, veuillez réessayer plus tard",
+			api.QuestionClosedHTTPCode:       "aucune question en cours",
+			api.DrainingHTTPCode:             "serveur en cours d'arrêt, veuillez réessayer plus tard",
+		},
+		websocket: map[api.WebsocketErrorCode]string{
+			api.InvalidRequestCode:          "requête invalide",
+			api.LobbyNotFoundCode:           "salon introuvable",
+			api.TooManyPlayersCode:          "trop de joueurs",
+			api.PlayerAlreadyRegisteredCode: "joueur déjà inscrit",
+			api.UsernameAlreadyExistsCode:   "nom d'utilisateur déjà pris",
+			api.ClientRestituteCode:         "impossible de restaurer le joueur",
+			api.InvalidInputCode:            "saisie invalide",
+			api.InternalServerErrorCode:     "erreur interne du serveur",
+			api.UnauthorizedErrorCode:       "requête non autorisée",
+			api.PlayerNotFoundErrorCode:     "joueur introuvable",
+			api.QuizNotFoundErrorCode:       "quiz introuvable",
+			api.NoReviewPendingErrorCode:    "aucune correction en attente",
+			api.NotEnoughPlayersCode:        "pas assez de joueurs",
+			api.UsernameBannedCode:          "nom d'utilisateur banni du salon",
+			api.WrongLobbyStateCode:         "requête non autorisée dans l'état actuel du salon",
+			api.NotRegisteredCode:           "inscription requise",
+		},
+	},
+}
+
+// HTTPMessage returns the message of code in locale, or fallback if
+// it has no translation.
+func HTTPMessage(locale string, code api.HTTPErrorCode, fallback string) string {
+	if msg, ok := catalogs[locale].http[code]; ok {
+		return msg
+	}
+	return fallback
+}
+
+// WebsocketMessage returns the message of code in locale, or fallback
+// if it has no translation.
+func WebsocketMessage(locale string, code api.WebsocketErrorCode, fallback string) string {
+	if msg, ok := catalogs[locale].websocket[code]; ok {
+		return msg
+	}
+	return fallback
+}
+
+// ParseAcceptLanguage returns the preferred locale of an Accept-Language
+// header having a catalog, or DefaultLocale.
+func ParseAcceptLanguage(header string) string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+
+	var locales []weighted
+	for _, lang := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(lang), ";")
+		base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if _, ok := catalogs[base]; (ok || base == DefaultLocale) && q > 0 {
+			locales = append(locales, weighted{locale: base, q: q})
+		}
+	}
+
+	// Stable so equally weighted locales keep the header order.
+	slices.SortStableFunc(locales, func(a, b weighted) int {
+		return cmp.Compare(b.q, a.q)
+	})
+	if len(locales) == 0 {
+		return DefaultLocale
+	}
+	return locales[0].locale
+}
@@ -0,0 +1,79 @@
+package errors_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sevenquiz-backend/api"
+	errs "sevenquiz-backend/internal/errors"
+	"testing"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"":                         "en",
+		"fr":                       "fr",
+		"fr-FR,fr;q=0.9,en;q=0.8":  "fr",
+		"en-US,en;q=0.9,fr;q=0.8":  "en",
+		"de-DE,fr;q=0.5":           "fr",
+		"de,es":                    "en",
+		"en;q=0.5,fr;q=0.7":        "fr",
+		"fr;q=0,en":                "en",
+		"fr;q=invalid,en;q=0.1":    "en",
+		" FR-ca ; q=0.8 , de ":     "fr",
+		"en;q=0.5, fr;q=0.5, de;q": "en",
+	}
+	for header, want := range tests {
+		t.Run(header, func(t *testing.T) {
+			t.Parallel()
+
+			if got := errs.ParseAcceptLanguage(header); got != want {
+				t.Errorf("Unexpected locale: got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestMessagesTranslated(t *testing.T) {
+	t.Parallel()
+
+	for code := api.MissingURLQueryHTTPCode; code <= api.DrainingHTTPCode; code++ {
+		if errs.HTTPMessage("fr", code, "") == "" {
+			t.Errorf("Missing fr translation of http error code %d", code)
+		}
+	}
+	for code := api.InvalidRequestCode; code <= api.NotRegisteredCode; code++ {
+		if errs.WebsocketMessage("fr", code, "") == "" {
+			t.Errorf("Missing fr translation of websocket error code %d", code)
+		}
+	}
+}
+
+func TestWriteHTTPErrorLocalized(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"fr": "salon introuvable",
+		"en": "lobby not found",
+		"de": "lobby not found",
+	}
+	for locale, want := range tests {
+		t.Run(locale, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			ctx := errs.WithLocale(context.Background(), locale)
+			errs.WriteHTTPError(ctx, rec, errs.HTTPLobbyNotFoundError("abcde"))
+
+			got := api.HTTPErrorData{}
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("Could not decode error: %v", err)
+			}
+			if got.Message != want {
+				t.Errorf("Unexpected error message: got %q, want %q", got.Message, want)
+			}
+		})
+	}
+}
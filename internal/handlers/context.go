@@ -2,9 +2,32 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"sevenquiz-backend/internal/config"
+	mws "sevenquiz-backend/internal/middlewares"
 )
 
+// NewLogger returns a logger writing the records of cfg level and above
+// to w in cfg format, redacting secrets and adding the attributes of
+// keys found in the record context.
+func NewLogger(w io.Writer, cfg config.LogConf, keys ...any) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       cfg.Level,
+		ReplaceAttr: mws.DefaultLogRedactor.ReplaceAttr,
+	}
+
+	var h slog.Handler
+	switch cfg.Format {
+	case config.LogFormatText:
+		h = slog.NewTextHandler(w, opts)
+	default:
+		h = slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.New(ContextHandler{Handler: h, Keys: keys})
+}
+
 type ContextHandler struct {
 	slog.Handler
 	Keys []any
@@ -4,48 +4,192 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"sevenquiz-backend/api"
 	"sevenquiz-backend/internal/config"
 	errs "sevenquiz-backend/internal/errors"
 	mws "sevenquiz-backend/internal/middlewares"
 	"sevenquiz-backend/internal/quiz"
 	"sevenquiz-backend/internal/rate"
+	"strings"
 	"time"
 	"unicode/utf8"
 
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // CreateLobbyHandler returns a handler capable of creating new lobbies
 // and storing them in the lobbies container.
-func CreateLobbyHandler(cfg config.Config, lobbies quiz.LobbyRepository, quizzes map[string]api.Quiz) http.HandlerFunc {
+//
+// Lobbies are created with a snapshot of the quizzes available at creation.
+// Requests sharing an Idempotency-Key header within the configured TTL get
+// the same lobby back as long as it exists.
+func CreateLobbyHandler(cfg config.Config, lobbies quiz.LobbyRepository, quizzes *quiz.QuizStore) http.HandlerFunc {
+	idempotency := newIdempotencyKeys(cfg.Lobby.IdempotencyTTL)
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		lobby, err := lobbies.Register(quiz.LobbyOptions{
-			MaxPlayers:      cfg.Lobby.MaxPlayers,
-			Quizzes:         quizzes, // TODO: open on system instead of embed ?
-			RegisterTimeout: cfg.Lobby.RegisterTimeout,
+		// All parameters are optional, an empty body uses config defaults.
+		req := api.CreateLobbyRequestData{}
+		body := http.MaxBytesReader(w, r.Body, maxCreateLobbyBodySize)
+		if err := json.NewDecoder(body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			fields := map[string]string{"body": "invalid json body"}
+			errs.WriteHTTPError(r.Context(), w, errs.HTTPInputValidationError(err, fields))
+			return
+		}
+
+		key := r.Header.Get(idempotencyKeyHeader)
+		if len(key) > maxIdempotencyKeyLength {
+			fields := map[string]string{idempotencyKeyHeader: fmt.Sprintf("must be at most %d characters", maxIdempotencyKeyLength)}
+			errs.WriteHTTPError(r.Context(), w, errs.HTTPInputValidationError(errors.New("invalid idempotency key"), fields))
+			return
+		}
+
+		available := quizzes.All()
+		if err := validateCreateLobby(cfg, req, available); err != nil {
+			errs.WriteHTTPError(r.Context(), w, err)
+			return
+		}
+
+		res, err := idempotency.do(key, lobbies, func() (api.CreateLobbyResponseData, error) {
+			return createLobby(cfg, lobbies, available, req)
 		})
 		if err != nil {
-			errs.WriteHTTPError(r.Context(), w, errs.HTTPInternalServerError(err))
+			errs.WriteHTTPError(r.Context(), w, err)
+			return
 		}
 
-		res := api.CreateLobbyResponseData{
-			LobbyID: lobby.ID(),
-		}
 		if err := json.NewEncoder(w).Encode(res); err != nil {
 			slog.ErrorContext(r.Context(), "lobby response encoding", slog.Any("error", err))
 		}
 	}
 }
 
+// createLobby registers a lobby with the validated request parameters
+// and returns its id along with the owner token.
+func createLobby(cfg config.Config, lobbies quiz.LobbyRepository, quizzes map[string]api.Quiz, req api.CreateLobbyRequestData) (api.CreateLobbyResponseData, error) {
+	maxPlayers := cfg.Lobby.MaxPlayers
+	if req.MaxPlayers > 0 {
+		maxPlayers = req.MaxPlayers
+	}
+
+	lobby, err := lobbies.Register(quiz.LobbyOptions{
+		IDLength:        cfg.Lobby.IDLength,
+		MaxPlayers:      maxPlayers,
+		MinPlayers:      cfg.Lobby.MinPlayers,
+		MaxLobbies:      cfg.Lobby.MaxLobbies,
+		Quizzes:         quizzes,
+		Quiz:            req.Quiz,
+		Password:        req.Password,
+		JWTSalt:         cfg.JWTSecret,
+		RegisterTimeout: cfg.Lobby.RegisterTimeout,
+		WriteTimeout:    cfg.Lobby.WriteTimeout,
+		QueueSize:       cfg.Lobby.QueueSize,
+		HistorySize:     cfg.Lobby.HistorySize,
+		StartCountdown:  cfg.Lobby.StartCountdown,
+		MediaBaseURL:    cfg.MediaBaseURL,
+
+		QuestionDurations:   cfg.Lobby.QuestionDurations,
+		CountRegisteredOnly: cfg.Lobby.CountRegisteredOnly,
+		InterQuestionDelay:  cfg.Lobby.InterQuestionDelay,
+		ResultsHold:         cfg.Lobby.ResultsHold,
+	})
+	if errors.Is(err, quiz.ErrNoLobbySlotAvailable) {
+		return api.CreateLobbyResponseData{}, errs.NoLobbySlotAvailableError(err)
+	}
+	if errors.Is(err, quiz.ErrTooManyLobbies) {
+		return api.CreateLobbyResponseData{}, errs.TooManyLobbiesError(cfg.Lobby.MaxLobbies)
+	}
+	if err != nil {
+		return api.CreateLobbyResponseData{}, errs.HTTPInternalServerError(err)
+	}
+
+	// The creator is the only one able to claim the ownership.
+	token, err := lobby.NewOwnerToken()
+	if err != nil {
+		lobbies.Delete(lobby.ID())
+		return api.CreateLobbyResponseData{}, errs.HTTPInternalServerError(err)
+	}
+
+	return api.CreateLobbyResponseData{
+		LobbyID: lobby.ID(),
+		Token:   token,
+	}, nil
+}
+
+// LobbyStatusHandler returns a handler reporting if a lobby exists and
+// can be joined, without upgrading to a websocket.
+func LobbyStatusHandler(lobbies quiz.LobbyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		lobby, ok := lobbies.Get(id)
+		if !ok || lobby == nil {
+			errs.WriteHTTPError(r.Context(), w, errs.HTTPLobbyNotFoundError(id))
+			return
+		}
+
+		res := api.LobbyStatusResponseData{
+			Exists:           true,
+			State:            lobby.State().String(),
+			Full:             lobby.IsFull(),
+			PasswordRequired: lobby.HasPassword(),
+			PlayerCount:      len(lobby.GetPlayerList()),
+		}
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			slog.ErrorContext(r.Context(), "lobby status response encoding", slog.Any("error", err))
+		}
+	}
+}
+
+const (
+	maxCreateLobbyBodySize = 1 << 12
+	maxPasswordLength      = 64
+)
+
+// validateCreateLobby checks the optional lobby creation parameters.
+// MaxPlayers may only lower the configured limit, unless it is disabled.
+func validateCreateLobby(cfg config.Config, req api.CreateLobbyRequestData, quizzes map[string]api.Quiz) error {
+	fields := map[string]string{}
+	if _, ok := quizzes[req.Quiz]; req.Quiz != "" && !ok {
+		fields["quiz"] = "quiz does not exist"
+	}
+	if req.MaxPlayers < 0 || (cfg.Lobby.MaxPlayers > 0 && req.MaxPlayers > cfg.Lobby.MaxPlayers) {
+		fields["maxPlayers"] = fmt.Sprintf("must be between 1 and %d", cfg.Lobby.MaxPlayers)
+		if cfg.Lobby.MaxPlayers <= 0 {
+			fields["maxPlayers"] = "must be positive"
+		}
+	}
+	if utf8.RuneCountInString(req.Password) > maxPasswordLength {
+		fields["password"] = fmt.Sprintf("must be at most %d characters", maxPasswordLength)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return errs.HTTPInputValidationError(errors.New("invalid lobby parameters"), fields)
+}
+
+// tracer starts a span per websocket request, a no-op until a tracer
+// provider is registered with otel.SetTracerProvider.
+var tracer = otel.Tracer("sevenquiz-backend/internal/handlers")
+
+const attributeRequestType = attribute.Key("request.type")
+
 type LobbyHandler struct {
 	Config        config.Config
 	Lobbies       quiz.LobbyRepository
 	AcceptOptions websocket.AcceptOptions
-	Limiter       *rate.Limiter
+
+	// Limiters rate limits the requests read from conns by client IP.
+	Limiters *rate.KeyedLimiter
 }
 
 func (h LobbyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -59,6 +203,12 @@ func (h LobbyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Checked ahead of Accept to answer with an API error.
+	if !allowedOrigin(r, h.AcceptOptions) {
+		errs.WriteHTTPError(ctx, w, errs.ForbiddenOriginError(r.Header.Get("Origin")))
+		return
+	}
+
 	// Transition to the registration state only after a first call to the handler.
 	if lobby.State() == quiz.LobbyStateCreated && lobby.NumConns() == 0 {
 		lobby.SetState(quiz.LobbyStateRegister)
@@ -73,18 +223,41 @@ func (h LobbyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	conn.SetReadLimit(h.Config.Lobby.WebsocketReadLimit)
 
-	go ping(ctx, conn, 5*time.Second) // Detect timed out connection.
-	defer h.handleDisconnect(ctx, lobby, conn)
+	// Detect timed out connection, until the conn is done.
+	pingCtx, stopPing := context.WithCancel(ctx)
+	defer stopPing()
+	go ping(pingCtx, conn, 5*time.Second)
+
+	lobby.StartWriter(conn) // Stopped on disconnect.
+
+	if spectator, _ := ctx.Value(mws.LobbySpectatorKey).(bool); spectator {
+		h.serveSpectator(ctx, lobby, conn)
+		return
+	}
+
+	// ctx is enriched with the username once registered.
+	defer func() { h.handleDisconnect(ctx, lobby, conn) }()
 
 	switch lobby.State() {
 	case quiz.LobbyStateRegister:
 		lobby.AddConn(conn)
+		if grace := h.Config.Lobby.RegisterGracePeriod; grace > 0 {
+			reapCtx := ctx // ctx is reassigned by the read loop.
+			reaper := time.AfterFunc(grace, func() { reapUnregistered(reapCtx, lobby, conn) })
+			defer reaper.Stop()
+		}
+		// The creator is recognized on connect, ahead of other joiners.
+		if token, _ := ctx.Value(mws.LobbyTokenKey).(string); token != "" {
+			lobby.ClaimOwnerConn(conn, token)
+		}
 		// Send banner on websocket upgrade with lobby details.
 		timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 		handleLobbyRequest(timeoutCtx, lobby, conn, true)
 		cancel()
 	case quiz.LobbyStateQuiz:
-		// TODO: greet with current question
+		timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		greetQuiz(timeoutCtx, lobby, conn)
+		cancel()
 	}
 
 	for {
@@ -93,7 +266,16 @@ func (h LobbyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		timeoutCtx, cancel := contextTimeoutWithRequest(ctx, req.Type)
+		reqCtx, span := tracer.Start(ctx, "lobby.request", trace.WithAttributes(lobby.SpanAttributes()...))
+		span.SetAttributes(attributeRequestType.String(string(req.Type)))
+		timeoutCtx, cancel := contextTimeoutWithRequest(reqCtx, req)
+
+		if err := registrationError(lobby, conn, req.Type); err != nil {
+			errs.WriteWebsocketError(timeoutCtx, conn, err)
+			cancel()
+			span.End()
+			continue
+		}
 
 		switch lobby.State() {
 		case quiz.LobbyStateRegister:
@@ -102,16 +284,82 @@ func (h LobbyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			h.handleQuizState(timeoutCtx, req, lobby, conn)
 		case quiz.LobbyStateAnswers:
 			h.handleReviewState(timeoutCtx, req, lobby, conn)
+		default:
+			handleUnexpectedRequest(timeoutCtx, lobby, conn, req.Type)
 		}
 
 		cancel()
+		span.End()
+
+		ctx = h.onRegistered(ctx, lobby, conn)
 	}
 }
 
+// allowedOrigin reports if the request origin is allowed by the accept
+// options, following the websocket.Accept rules: requests without origin
+// or from the same host are always allowed.
+func allowedOrigin(r *http.Request, opts websocket.AcceptOptions) bool {
+	origin := r.Header.Get("Origin")
+	if opts.InsecureSkipVerify || origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(r.Host, u.Host) {
+		return true
+	}
+	for _, pattern := range opts.OriginPatterns {
+		matched, err := filepath.Match(strings.ToLower(pattern), strings.ToLower(u.Host))
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// serveSpectator handles a websocket watching the lobby without playing.
+// Spectators receive all broadcasts but may only request lobby details.
+func (h LobbyHandler) serveSpectator(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn) {
+	lobby.AddSpectator(conn)
+	defer func() {
+		lobby.DeleteSpectator(conn)
+		conn.CloseNow()
+		lobby.StopWriter(conn)
+	}()
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	handleLobbyRequest(timeoutCtx, lobby, conn, true)
+	cancel()
+
+	for {
+		req, err := h.readRequest(ctx, conn)
+		if err != nil {
+			return
+		}
+
+		timeoutCtx, cancel := contextTimeoutWithRequest(ctx, req)
+
+		if req.Type == api.RequestTypeLobby {
+			handleLobbyRequest(timeoutCtx, lobby, conn, false)
+		} else {
+			apiErr := errs.UnauthorizedRequestError(req.Type, "spectators can only request lobby details")
+			errs.WriteWebsocketError(timeoutCtx, conn, apiErr)
+		}
+
+		cancel()
+	}
+}
+
+// ping pings conn at each interval until ctx is done or a ping fails.
 func ping(ctx context.Context, conn *websocket.Conn, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-time.Tick(interval):
+		case <-ticker.C:
 			if conn == nil {
 				return
 			}
@@ -131,14 +379,15 @@ func ping(ctx context.Context, conn *websocket.Conn, interval time.Duration) {
 
 func (h LobbyHandler) handleDisconnect(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn) {
 	conn.CloseNow()
+	lobby.StopWriter(conn)
 
 	switch lobby.State() {
 	/*
 		In the first stages we expect a first conn to be registered as owner.
 		If there is none at defer execution, the lobby will keep waiting for
 		one or ultimately be deleted by the lobby's register timeout.
-		If there was one and other players are in lobby, the next player will
-		be designated as owner. Otherwise the lobby is deleted.
+		If there was one and other players are in lobby, the earliest joined
+		player will be designated as owner. Otherwise the lobby is deleted.
 	*/
 	case quiz.LobbyStateCreated, quiz.LobbyStateRegister:
 		// Capture client before deletion.
@@ -157,6 +406,12 @@ func (h LobbyHandler) handleDisconnect(ctx context.Context, lobby *quiz.Lobby, c
 
 		username := player.Username()
 
+		if err := lobby.BroadcastPlayerList(timeoutCtx); err != nil {
+			slog.ErrorContext(ctx, "broadcast player list",
+				slog.String("username", username),
+				slog.Any("error", err))
+		}
+
 		err := lobby.BroadcastPlayerUpdate(timeoutCtx, username, "disconnect")
 		if err != nil {
 			slog.ErrorContext(ctx, "broadcast player update: disconnect",
@@ -169,15 +424,15 @@ func (h LobbyHandler) handleDisconnect(ctx context.Context, lobby *quiz.Lobby, c
 			return
 		}
 
-		players := lobby.GetPlayerList()
+		// Ownership goes to the longest present player.
+		newOwner, ok := lobby.NextOwnerCandidate()
 
 		// No other players in lobby and owner has left so discard lobby.
-		if len(players) == 0 {
+		if !ok {
 			h.Lobbies.Delete(lobby.ID())
 			return
 		}
 
-		newOwner := players[0]
 		lobby.SetOwner(newOwner)
 
 		err = lobby.BroadcastPlayerUpdate(timeoutCtx, newOwner, "new owner")
@@ -199,21 +454,113 @@ func (h LobbyHandler) handleDisconnect(ctx context.Context, lobby *quiz.Lobby, c
 			h.Lobbies.Delete(lobby.ID())
 			return
 		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		username := player.Username()
+
+		if err := lobby.BroadcastPlayerList(timeoutCtx); err != nil {
+			slog.ErrorContext(ctx, "broadcast player list",
+				slog.String("username", username),
+				slog.Any("error", err))
+		}
+
+		// Player is kept in lobby but marked away for the other players.
+		if err := lobby.BroadcastPlayerUpdate(timeoutCtx, username, "away"); err != nil {
+			slog.ErrorContext(ctx, "broadcast player update: away",
+				slog.String("username", username),
+				slog.Any("error", err))
+		}
+	case quiz.LobbyStateAnswers:
+		// Kept for the results but dropped if the game is reset.
+		if player, ok := lobby.GetPlayerByConn(conn); ok && player != nil {
+			player.Disconnect()
+		}
 	default:
 		// TODO: next stages
 		// Client's connect/disconnect/login/broadcast
 	}
 }
 
-func contextTimeoutWithRequest(ctx context.Context, reqType api.RequestType) (context.Context, context.CancelFunc) {
-	reqCtx := context.WithValue(ctx, mws.LobbyRequestKey, slog.Any("request", reqType))
+// onRegistered sets up conn once it registered or logged in as a player.
+// The username is added to ctx so that all following logs of the conn
+// carry it, and the read limit is raised to accept larger answers.
+func (h LobbyHandler) onRegistered(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn) context.Context {
+	if _, ok := ctx.Value(mws.LobbyUsernameKey).(slog.Attr); ok {
+		return ctx
+	}
+	player, ok := lobby.GetPlayerByConn(conn)
+	if !ok || player == nil {
+		return ctx
+	}
+	if limit := h.Config.Lobby.PlayerReadLimit; limit > 0 {
+		conn.SetReadLimit(limit)
+	}
+	return context.WithValue(ctx, mws.LobbyUsernameKey, slog.String("username", player.Username()))
+}
+
+// reapUnregistered closes conn if it did not register yet, so that it
+// does not hold a lobby slot until the register timeout.
+func reapUnregistered(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn) {
+	if player, _ := lobby.GetPlayerByConn(conn); player != nil || lobby.State() != quiz.LobbyStateRegister {
+		return
+	}
+	slog.InfoContext(ctx, "closing unregistered conn")
+	conn.Close(websocket.StatusPolicyViolation, "registration timeout")
+}
+
+// registrationError returns the error of a request conflicting with the
+// conn registration, whatever the lobby state: game commands require a
+// player and a player may not register again.
+func registrationError(lobby *quiz.Lobby, conn *websocket.Conn, reqType api.RequestType) error {
+	player, _ := lobby.GetPlayerByConn(conn)
+	switch {
+	case player == nil && requiresPlayer(reqType):
+		return errs.NotRegisteredError(reqType)
+	case player != nil && reqType == api.RequestTypeRegister:
+		return errs.UserAlreadyRegisteredError(reqType, player.Username())
+	}
+	return nil
+}
+
+// requiresPlayer reports if a request may only be sent by a conn
+// registered or logged in as a player. Unknown requests are left to
+// the state handlers to report.
+func requiresPlayer(reqType api.RequestType) bool {
+	switch reqType {
+	case api.RequestTypeLobby, api.RequestTypeRegister, api.RequestTypeLogin:
+		return false
+	}
+	return reqType.Known()
+}
+
+// handleUnexpectedRequest answers a request the lobby state does not
+// handle, telling apart unknown requests from those sent in the wrong state.
+func handleUnexpectedRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn, reqType api.RequestType) {
+	if reqType.Known() {
+		errs.WriteWebsocketError(ctx, conn, errs.WrongLobbyStateError(reqType, lobby.State().String()))
+		return
+	}
+	err := fmt.Errorf("unknown request: %s", reqType)
+	errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(err, api.RequestTypeUnknown, err.Error()))
+}
+
+func contextTimeoutWithRequest(ctx context.Context, req api.Request[json.RawMessage]) (context.Context, context.CancelFunc) {
+	reqCtx := context.WithValue(ctx, mws.LobbyRequestKey, slog.Any("request", req.Type))
+	if req.ID != "" { // Echoed in responses.
+		reqCtx = context.WithValue(reqCtx, errs.RequestIDKey, slog.String("request_id", req.ID))
+	}
 	return context.WithTimeout(reqCtx, 5*time.Second)
 }
 
 func (h LobbyHandler) readRequest(ctx context.Context, conn *websocket.Conn) (api.Request[json.RawMessage], error) {
-	if h.Limiter != nil && !h.Limiter.Allow() {
-		if err := h.Limiter.Wait(ctx); err != nil { // Block reading until request is permitted.
-			slog.ErrorContext(ctx, "limiter wait", slog.Any("error", err))
+	if h.Limiters != nil {
+		limiter := h.Limiters.Get(mws.ClientIP(ctx))
+		if !limiter.Allow() {
+			if err := limiter.Wait(ctx); err != nil { // Block reading until request is permitted.
+				slog.ErrorContext(ctx, "limiter wait", slog.Any("error", err))
+			}
 		}
 	}
 	req := api.Request[json.RawMessage]{}
@@ -234,15 +581,23 @@ func (h LobbyHandler) readRequest(ctx context.Context, conn *websocket.Conn) (ap
 func LobbyToAPIResponse(lobby *quiz.Lobby) (api.LobbyResponseData, error) {
 	data := api.LobbyResponseData{
 		ID:          lobby.ID(),
+		State:       lobby.State().String(),
 		MaxPlayers:  lobby.MaxPlayers(),
 		PlayerList:  lobby.GetPlayerList(),
+		Scores:      lobby.GetPlayerScores(),
+		Teams:       lobby.GetPlayerTeams(),
 		Created:     lobby.CreationDate().Format(time.RFC3339),
 		Quizzes:     lobby.ListQuizzes(),
+		QuizInfo:    lobby.ListQuizInfo(),
 		CurrentQuiz: lobby.Quiz().Name,
 	}
 	if owner := lobby.Owner(); owner != "" {
 		data.Owner = &owner
 	}
+	if question := lobby.CurrentQuestion(); question != nil {
+		sanitized := question.Sanitized()
+		data.CurrentQuestion = &sanitized
+	}
 	return data, nil
 }
 
@@ -256,3 +611,11 @@ func validateUsername(username string) error {
 	}
 	return nil
 }
+
+// validateTeam checks a team name, an empty team meaning solo play.
+func validateTeam(team string) error {
+	if utf8.RuneCountInString(team) > 25 {
+		return errors.New("team name too long")
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sevenquiz-backend/api"
+	errs "sevenquiz-backend/internal/errors"
+	mws "sevenquiz-backend/internal/middlewares"
+	"sevenquiz-backend/internal/quiz"
+	"sort"
+	"time"
+)
+
+// AdminLobbiesHandler returns a handler listing all active lobbies.
+func AdminLobbiesHandler(lobbies quiz.LobbyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := api.AdminLobbiesResponseData{
+			Lobbies: []api.AdminLobbyResponseData{},
+		}
+		for _, lobby := range lobbies.All() {
+			res.Lobbies = append(res.Lobbies, LobbyToAdminAPIResponse(lobby, false))
+		}
+		sort.Slice(res.Lobbies, func(i, j int) bool {
+			return res.Lobbies[i].ID < res.Lobbies[j].ID
+		})
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			slog.ErrorContext(r.Context(), "admin lobbies response encoding", slog.Any("error", err))
+		}
+	}
+}
+
+// AdminLobbyHandler returns a handler detailing a lobby and its players.
+func AdminLobbyHandler(lobbies quiz.LobbyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		lobby, ok := lobbies.Get(id)
+		if !ok || lobby == nil {
+			errs.WriteHTTPError(r.Context(), w, errs.HTTPLobbyNotFoundError(id))
+			return
+		}
+
+		res := LobbyToAdminAPIResponse(lobby, true)
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			slog.ErrorContext(r.Context(), "admin lobby response encoding", slog.Any("error", err))
+		}
+	}
+}
+
+// AdminDeleteLobbyHandler returns a handler force closing a lobby.
+// Players are notified before their websockets are closed.
+func AdminDeleteLobbyHandler(lobbies quiz.LobbyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id := r.PathValue("id")
+
+		lobby, ok := lobbies.Get(id)
+		if !ok || lobby == nil {
+			errs.WriteHTTPError(ctx, w, errs.HTTPLobbyNotFoundError(id))
+			return
+		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := lobby.BroadcastClosed(timeoutCtx, "ended by admin"); err != nil {
+			slog.ErrorContext(ctx, "broadcast lobby closed", slog.Any("error", err))
+		}
+		cancel()
+
+		lobbies.Delete(id)
+
+		slog.InfoContext(ctx, "lobby deleted by admin", slog.String("lobby_id", id))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AdminDrainHandler returns a handler starting or stopping the drain of
+// the server, new lobbies being refused while draining.
+func AdminDrainHandler(drain *mws.Drain, draining bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		drain.Set(draining)
+
+		slog.InfoContext(r.Context(), "drain set by admin", slog.Bool("draining", draining))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// LobbyToAdminAPIResponse converts a lobby to an admin API representation.
+// Players details are only filled if withPlayers is set.
+func LobbyToAdminAPIResponse(lobby *quiz.Lobby, withPlayers bool) api.AdminLobbyResponseData {
+	data := api.AdminLobbyResponseData{
+		ID:          lobby.ID(),
+		State:       lobby.State().String(),
+		Owner:       lobby.Owner(),
+		NumPlayers:  len(lobby.GetPlayerList()),
+		Created:     lobby.CreationDate().Format(time.RFC3339),
+		CurrentQuiz: lobby.Quiz().Name,
+	}
+	if !withPlayers {
+		return data
+	}
+
+	data.Players = []api.AdminPlayerDetails{}
+	for _, player := range lobby.AllPlayers() {
+		if player == nil {
+			continue
+		}
+		data.Players = append(data.Players, api.AdminPlayerDetails{
+			Username: player.Username(),
+			Score:    player.Score(),
+			Alive:    player.Alive(),
+		})
+	}
+	sort.Slice(data.Players, func(i, j int) bool {
+		return data.Players[i].Username < data.Players[j].Username
+	})
+
+	return data
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/config"
+	errs "sevenquiz-backend/internal/errors"
+	"sevenquiz-backend/internal/quiz"
+	"strings"
+)
+
+// AnswerHandler returns a handler recording a player answer to the
+// current question, as the websocket answer request does, for clients
+// unable to keep a websocket open during the quiz.
+//
+// The player is authenticated by the token delivered at quiz start in
+// the Authorization header. Questions are still read from the websocket
+// or by polling the lobby status.
+func AnswerHandler(cfg config.Config, lobbies quiz.LobbyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id := r.PathValue("id")
+
+		lobby, ok := lobbies.Get(id)
+		if !ok || lobby == nil {
+			errs.WriteHTTPError(ctx, w, errs.HTTPLobbyNotFoundError(id))
+			return
+		}
+
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims, err := lobby.CheckToken(token)
+		if err != nil {
+			errs.WriteHTTPError(ctx, w, errs.InvalidTokenError(err, api.RequestTypeAnswer))
+			return
+		}
+		username, ok := claims["username"].(string)
+		if !ok || username == "" {
+			err := errors.New("token has no username claim")
+			errs.WriteHTTPError(ctx, w, errs.InvalidTokenClaimError(err, api.RequestTypeAnswer, "username"))
+			return
+		}
+		_, player, ok := lobby.GetPlayer(username)
+		if !ok || player == nil || lobby.IsBanned(username) {
+			errs.WriteHTTPError(ctx, w, errs.UnauthorizedError("user is not a player"))
+			return
+		}
+
+		var body io.Reader = r.Body
+		if limit := cfg.Lobby.PlayerReadLimit; limit > 0 {
+			body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		req := api.AnswerRequestData{}
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			fields := map[string]string{"body": "invalid json body"}
+			errs.WriteHTTPError(ctx, w, errs.HTTPInputValidationError(err, fields))
+			return
+		}
+
+		question := lobby.CurrentQuestion()
+		switch {
+		case lobby.State() != quiz.LobbyStateQuiz || question == nil:
+			errs.WriteHTTPError(ctx, w, errs.QuestionClosedError(errors.New("no question in progress")))
+			return
+		case req.QuestionID != nil && *req.QuestionID != question.ID:
+			// Late answers targeting a previous question are dropped.
+			errs.WriteHTTPError(ctx, w, errs.QuestionClosedError(fmt.Errorf("question %d is over", *req.QuestionID)))
+			return
+		case lobby.QuestionRemaining() <= 0:
+			errs.WriteHTTPError(ctx, w, errs.QuestionClosedError(fmt.Errorf("question %d is over", question.ID)))
+			return
+		}
+
+		if field, err := quiz.ValidateAnswerInput(*question, req.Answer); err != nil {
+			fields := map[string]string{field: err.Error()}
+			errs.WriteHTTPError(ctx, w, errs.HTTPInputValidationError(err, fields))
+			return
+		}
+
+		player.RegisterAnswer(question.ID, req.Answer)
+
+		res := api.AnswerResponseData{
+			QuestionID: question.ID,
+			Answer:     req.Answer,
+		}
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			slog.ErrorContext(ctx, "answer response encoding",
+				slog.String("username", username),
+				slog.Int("question", question.ID),
+				slog.Any("error", err))
+		}
+	}
+}
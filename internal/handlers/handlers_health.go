@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+	mws "sevenquiz-backend/internal/middlewares"
+)
+
+// ReadyzHandler returns a handler reporting if the server accepts new
+// lobbies, answering 503 while draining so that load balancers route
+// them elsewhere. Existing lobbies keep being served.
+func ReadyzHandler(drain *mws.Drain) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if drain.Draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
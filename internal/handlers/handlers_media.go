@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	errs "sevenquiz-backend/internal/errors"
+	"sevenquiz-backend/internal/quiz"
+	"strings"
+)
+
+// MediaHandler returns a handler serving quizzes media files from fsys.
+//
+// Only files inside a quiz media directory are served so questions
+// and their answers can never be retrieved.
+func MediaHandler(fsys fs.FS) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quizName, file := r.PathValue("quiz"), r.PathValue("file")
+
+		if !fs.ValidPath(quizName) || strings.Contains(quizName, "/") || !fs.ValidPath(file) {
+			errs.WriteHTTPError(r.Context(), w, errs.MediaNotFoundError(quizName, file))
+			return
+		}
+
+		name := path.Join(quizName, quiz.MediaDir, file)
+		if info, err := fs.Stat(fsys, name); err != nil || info.IsDir() {
+			errs.WriteHTTPError(r.Context(), w, errs.MediaNotFoundError(quizName, file))
+			return
+		}
+
+		http.ServeFileFS(w, r, fsys, name)
+	}
+}
@@ -3,37 +3,197 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"sevenquiz-backend/api"
 	errs "sevenquiz-backend/internal/errors"
 	"sevenquiz-backend/internal/quiz"
 
 	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
 )
 
 func (h LobbyHandler) handleQuizState(ctx context.Context, req api.Request[json.RawMessage], lobby *quiz.Lobby, conn *websocket.Conn) {
 	switch req.Type {
+	case api.RequestTypeLobby:
+		handleLobbyRequest(ctx, lobby, conn, false)
 	case api.RequestTypeAnswer:
 		handleAnswerRequest(ctx, lobby, conn, req.Data)
+	case api.RequestTypePause:
+		handlePauseRequest(ctx, lobby, conn, true)
+	case api.RequestTypeResume:
+		handlePauseRequest(ctx, lobby, conn, false)
+	case api.RequestTypeLogin:
+		handleLoginRequest(ctx, lobby, conn, req.Data)
 	default:
-		err := fmt.Errorf("unknown request: %s", req.Type)
-		apiErr := errs.InvalidRequestError(err, api.RequestTypeUnknown, err.Error())
-		errs.WriteWebsocketError(ctx, conn, apiErr)
+		handleUnexpectedRequest(ctx, lobby, conn, req.Type)
+	}
+}
+
+// greetQuiz greets a conn joining during the quiz with the question in
+// progress and its remaining time, or the lobby details between questions.
+func greetQuiz(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn) {
+	question := lobby.CurrentQuestion()
+	if question == nil {
+		handleLobbyRequest(ctx, lobby, conn, true)
+		return
+	}
+
+	res := api.Response[api.QuestionResponseData]{
+		Type: api.ResponseTypeQuestion,
+		Data: api.QuestionResponseData{
+			Question:  question.Sanitized(),
+			Index:     question.ID,
+			Total:     len(lobby.Quiz().Questions),
+			Remaining: lobby.QuestionRemaining(),
+		},
+	}
+	if err := wsjson.Write(ctx, conn, res); err != nil {
+		slog.ErrorContext(ctx, "quiz greeting write", slog.Any("error", err))
 	}
 }
 
 func handleAnswerRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn, data json.RawMessage) {
-	req, err := api.DecodeJSON[api.AnswerResponseData](data)
+	req, err := api.DecodeJSON[api.AnswerRequestData](data)
 	if err != nil {
 		apiErr := errs.InvalidRequestError(err, api.RequestTypeAnswer, "invalid answer request")
 		errs.WriteWebsocketError(ctx, conn, apiErr)
 		return
 	}
 	question := lobby.CurrentQuestion()
-	if question != nil {
-		player, ok := lobby.GetPlayerByConn(conn)
-		if player != nil && ok {
-			player.RegisterAnswer(question.ID, req.Answer)
+	if question != nil && req.QuestionID != nil && *req.QuestionID != question.ID {
+		// Late answers targeting a previous question are dropped.
+		err := fmt.Errorf("question %d is over", *req.QuestionID)
+		errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(err, api.RequestTypeAnswer, err.Error()))
+		return
+	}
+	if question == nil {
+		err := errors.New("no question in progress")
+		errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(err, api.RequestTypeAnswer, err.Error()))
+		return
+	}
+	if lobby.QuestionRemaining() <= 0 {
+		err := fmt.Errorf("question %d is over", question.ID)
+		errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(err, api.RequestTypeAnswer, err.Error()))
+		return
+	}
+	player, ok := lobby.GetPlayerByConn(conn)
+	if !ok || player == nil {
+		errs.WriteWebsocketError(ctx, conn, errs.UnauthorizedRequestError(api.RequestTypeAnswer, "user is not a player"))
+		return
+	}
+	if field, err := quiz.ValidateAnswerInput(*question, req.Answer); err != nil {
+		fields := map[string]string{field: err.Error()}
+		errs.WriteWebsocketError(ctx, conn, errs.InputValidationError(err, api.RequestTypeAnswer, fields))
+		return
+	}
+	player.RegisterAnswer(question.ID, req.Answer)
+
+	// Acknowledged to the submitting conn only, answers are never broadcasted.
+	res := &api.Response[api.AnswerResponseData]{
+		ID:   errs.RequestID(ctx),
+		Type: api.ResponseTypeAnswer,
+		Data: api.AnswerResponseData{
+			QuestionID: question.ID,
+			Answer:     req.Answer,
+		},
+	}
+	if err := wsjson.Write(ctx, conn, res); err != nil {
+		slog.ErrorContext(ctx, "answer response write",
+			slog.String("username", player.Username()),
+			slog.Int("question", question.ID),
+			slog.Any("error", err))
+	}
+}
+
+func handlePauseRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn, pause bool) {
+	reqType, cause := api.RequestTypeResume, "quiz is not paused"
+	if pause {
+		reqType, cause = api.RequestTypePause, "quiz is already paused"
+	}
+
+	client, ok := lobby.GetPlayerByConn(conn)
+	if !ok || client == nil || client.Username() != lobby.Owner() {
+		errs.WriteWebsocketError(ctx, conn, errs.UnauthorizedRequestError(reqType, "user is not lobby owner"))
+		return
+	}
+
+	if !lobby.SetPaused(pause) {
+		err := errors.New(cause)
+		errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(err, reqType, cause))
+		return
+	}
+
+	if err := lobby.BroadcastPause(ctx, pause); err != nil {
+		slog.ErrorContext(ctx, "broadcast pause",
+			slog.String("username", client.Username()),
+			slog.Bool("paused", pause),
+			slog.Any("error", err))
+	}
+
+	slog.InfoContext(ctx, "successful request")
+}
+
+// handleLoginRequest restitutes a player on a new conn using the token
+// delivered at quiz start. The broadcasts missed since the last one the
+// player received are replayed.
+func handleLoginRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn, data json.RawMessage) {
+	req, err := api.DecodeJSON[api.LoginRequestData](data)
+	if err != nil {
+		apiErr := errs.InvalidRequestError(err, api.RequestTypeLogin, "invalid login request")
+		errs.WriteWebsocketError(ctx, conn, apiErr)
+		return
+	}
+
+	claims, err := lobby.CheckToken(req.Token)
+	if err != nil {
+		errs.WriteWebsocketError(ctx, conn, errs.ClientRestituteError(err, api.RequestTypeLogin, "invalid token"))
+		return
+	}
+	username, ok := claims["username"].(string)
+	if !ok || username == "" {
+		err := errors.New("token has no username claim")
+		errs.WriteWebsocketError(ctx, conn, errs.ClientRestituteError(err, api.RequestTypeLogin, err.Error()))
+		return
+	}
+
+	if lobby.IsBanned(username) {
+		errs.WriteWebsocketError(ctx, conn, errs.UsernameBannedError(api.RequestTypeLogin, username))
+		return
+	}
+
+	if _, ok := lobby.ReplacePlayerConn(username, conn); !ok {
+		errs.WriteWebsocketError(ctx, conn, errs.PlayerFoundError(api.RequestTypeLogin, username))
+		return
+	}
+
+	res := api.Response[api.EmptyResponseData]{
+		ID:   errs.RequestID(ctx),
+		Type: api.ResponseTypeLogin,
+	}
+	if err := wsjson.Write(ctx, conn, res); err != nil {
+		slog.ErrorContext(ctx, "login response", slog.Any("error", err))
+		return
+	}
+
+	if req.LastSeq > 0 {
+		if err := lobby.Replay(ctx, conn, req.LastSeq); err != nil {
+			slog.ErrorContext(ctx, "replay history", slog.Any("error", err))
+			return
 		}
 	}
+
+	if err := lobby.BroadcastPlayerList(ctx); err != nil {
+		slog.ErrorContext(ctx, "broadcast player list",
+			slog.String("username", username),
+			slog.Any("error", err))
+	}
+	if err := lobby.BroadcastPlayerUpdate(ctx, username, "back"); err != nil {
+		slog.ErrorContext(ctx, "broadcast player update: back",
+			slog.String("username", username),
+			slog.Any("error", err))
+	}
+
+	slog.InfoContext(ctx, "successful request")
 }
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sevenquiz-backend/api"
+	errs "sevenquiz-backend/internal/errors"
+	"sevenquiz-backend/internal/quiz"
+	"sort"
+)
+
+// QuizzesHandler returns a handler listing all available quizzes.
+func QuizzesHandler(quizzes *quiz.QuizStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := api.QuizzesResponseData{
+			Quizzes: []api.QuizSummary{},
+		}
+		for _, q := range quizzes.All() {
+			res.Quizzes = append(res.Quizzes, QuizToAPISummary(q))
+		}
+		sort.Slice(res.Quizzes, func(i, j int) bool {
+			return res.Quizzes[i].Name < res.Quizzes[j].Name
+		})
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			slog.ErrorContext(r.Context(), "quizzes response encoding", slog.Any("error", err))
+		}
+	}
+}
+
+// QuizHandler returns a handler previewing a quiz questions.
+// Only questions titles and types are returned, never their answers.
+func QuizHandler(quizzes *quiz.QuizStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		q, ok := quizzes.All()[name]
+		if !ok {
+			errs.WriteHTTPError(r.Context(), w, errs.HTTPQuizNotFoundError(name))
+			return
+		}
+
+		res := api.QuizResponseData{
+			QuizSummary: QuizToAPISummary(q),
+			Questions:   make([]api.QuestionPreview, 0, len(q.Questions)),
+		}
+		for _, question := range q.Questions {
+			res.Questions = append(res.Questions, api.QuestionPreview{
+				Title: question.Title,
+				Type:  question.Type,
+			})
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			slog.ErrorContext(r.Context(), "quiz response encoding", slog.Any("error", err))
+		}
+	}
+}
+
+// QuizToAPISummary converts a quiz to its API summary.
+func QuizToAPISummary(q api.Quiz) api.QuizSummary {
+	info := q.QuizInfo
+	info.QuestionCount = len(q.Questions)
+	return api.QuizSummary{
+		Name:     q.Name,
+		QuizInfo: info,
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"sevenquiz-backend/api"
 	errs "sevenquiz-backend/internal/errors"
+	mws "sevenquiz-backend/internal/middlewares"
 	"sevenquiz-backend/internal/quiz"
 	"time"
 
@@ -24,13 +25,11 @@ func (h LobbyHandler) handleRegisterState(ctx context.Context, req api.Request[j
 	case api.RequestTypeKick:
 		handleKickRequest(ctx, lobby, conn, req.Data)
 	case api.RequestTypeConfigure:
-		handleConfigureRequest(ctx, lobby, conn, req.Data)
+		handleConfigureRequest(ctx, lobby, conn, req.Data, h.Config.Lobby.MaxPlayers)
 	case api.RequestTypeStart:
 		handleStartRequest(ctx, lobby, conn, req.Data)
 	default:
-		err := fmt.Errorf("unknown request: %s", req.Type)
-		apiErr := errs.InvalidRequestError(err, api.RequestTypeUnknown, err.Error())
-		errs.WriteWebsocketError(ctx, conn, apiErr)
+		handleUnexpectedRequest(ctx, lobby, conn, req.Type)
 	}
 }
 
@@ -42,7 +41,10 @@ func handleLobbyRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.
 		return
 	}
 
+	data.OwnerClaimed = lobby.IsOwnerConn(conn)
+
 	res := &api.Response[api.LobbyResponseData]{
+		ID:   errs.RequestID(ctx),
 		Type: api.ResponseTypeLobby,
 		Data: data,
 	}
@@ -81,15 +83,34 @@ func handleRegisterRequest(ctx context.Context, lobby *quiz.Lobby, conn *websock
 		return
 	}
 
+	if err := validateTeam(req.Team); err != nil {
+		fields := map[string]string{"team": err.Error()}
+		apiErr := errs.InputValidationError(err, api.RequestTypeRegister, fields)
+		errs.WriteWebsocketError(ctx, conn, apiErr)
+		return
+	}
+
+	if lobby.IsBanned(req.Username) {
+		errs.WriteWebsocketError(ctx, conn, errs.UsernameBannedError(api.RequestTypeRegister, req.Username))
+		return
+	}
+
+	// Conns beyond MaxPlayers may be accepted when only players count.
+	if !lobby.CanRegister() {
+		errs.WriteWebsocketError(ctx, conn, errs.TooManyPlayersError(lobby.MaxPlayers()))
+		return
+	}
+
 	if _, _, exist := lobby.GetPlayer(req.Username); exist {
 		apiErr := errs.UsernameAlreadyExistsError(api.RequestTypeRegister, req.Username)
 		errs.WriteWebsocketError(ctx, conn, apiErr)
 		return
 	}
 
-	lobby.AddPlayerWithConn(conn, req.Username)
+	lobby.AddPlayerWithTeam(conn, req.Username, req.Team)
 
 	res := &api.Response[api.EmptyResponseData]{
+		ID:   errs.RequestID(ctx),
 		Type: api.ResponseTypeRegister,
 	}
 	if err := wsjson.Write(ctx, conn, res); err != nil {
@@ -98,15 +119,25 @@ func handleRegisterRequest(ctx context.Context, lobby *quiz.Lobby, conn *websock
 			slog.Any("error", err))
 	}
 
-	if err := lobby.BroadcastPlayerUpdate(ctx, req.Username, "join"); err != nil {
+	if err := lobby.BroadcastPlayerList(ctx); err != nil {
+		slog.Error("broadcast player list",
+			slog.String("username", req.Username),
+			slog.Any("error", err))
+	}
+
+	if err := lobby.BroadcastPlayerJoin(ctx, req.Username, req.Team); err != nil {
 		slog.Error("broadcast player update: join",
 			slog.String("username", req.Username),
 			slog.Any("error", err))
 	}
 
-	// Grant first user to join lobby owner permission.
-	if lobby.Owner() == "" {
-		lobby.SetOwner(req.Username)
+	// Grant first user to join lobby owner permission, unless the
+	// ownership was reserved to the bearer of the owner token.
+	token := req.Token
+	if token == "" {
+		token, _ = ctx.Value(mws.LobbyTokenKey).(string)
+	}
+	if lobby.ClaimOwner(conn, req.Username, token) {
 		if err := lobby.BroadcastPlayerUpdate(ctx, req.Username, "new owner"); err != nil {
 			slog.Error("broadcast player update: new owner",
 				slog.String("username", req.Username),
@@ -117,6 +148,9 @@ func handleRegisterRequest(ctx context.Context, lobby *quiz.Lobby, conn *websock
 	slog.InfoContext(ctx, "successful request")
 }
 
+// maxKickReasonLength bounds the kick reason shown to players.
+const maxKickReasonLength = 200
+
 func handleKickRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn, data json.RawMessage) {
 	req, err := api.DecodeJSON[api.KickRequestData](data)
 	if err != nil {
@@ -132,13 +166,27 @@ func handleKickRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.C
 		return
 	}
 
-	if ok := lobby.DeletePlayer(req.Username); !ok {
+	if req.Username == client.Username() {
+		err := errors.New("owner kicking itself")
+		errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(err, api.RequestTypeKick, "cannot kick yourself"))
+		return
+	}
+
+	if len(req.Reason) > maxKickReasonLength {
+		err := fmt.Errorf("reason exceeds %d bytes", maxKickReasonLength)
+		fields := map[string]string{"reason": err.Error()}
+		errs.WriteWebsocketError(ctx, conn, errs.InputValidationError(err, api.RequestTypeKick, fields))
+		return
+	}
+
+	if ok := lobby.KickPlayer(ctx, req.Username, req.Reason, req.Ban); !ok {
 		apiErr := errs.PlayerFoundError(api.RequestTypeKick, req.Username)
 		errs.WriteWebsocketError(ctx, conn, apiErr)
 		return
 	}
 
 	res := &api.Response[api.EmptyResponseData]{
+		ID:   errs.RequestID(ctx),
 		Type: api.ResponseTypeKick,
 	}
 	if err := wsjson.Write(ctx, conn, res); err != nil {
@@ -148,7 +196,14 @@ func handleKickRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.C
 			slog.Any("error", err))
 	}
 
-	if err := lobby.BroadcastPlayerUpdate(ctx, req.Username, "kick"); err != nil {
+	if err := lobby.BroadcastPlayerList(ctx); err != nil {
+		slog.Error("broadcast player list",
+			slog.String("username", client.Username()),
+			slog.String("kick", req.Username),
+			slog.Any("error", err))
+	}
+
+	if err := lobby.BroadcastPlayerKick(ctx, req.Username, req.Reason); err != nil {
 		slog.Error("broadcast player update: kick",
 			slog.String("username", client.Username()),
 			slog.String("kick", req.Username),
@@ -158,7 +213,10 @@ func handleKickRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.C
 	slog.InfoContext(ctx, "successful request")
 }
 
-func handleConfigureRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn, data json.RawMessage) {
+// handleConfigureRequest changes the lobby settings set by the owner.
+// The maximum of players may be raised up to maxPlayers, unless it is
+// disabled, or lowered down to the players already in the lobby.
+func handleConfigureRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn, data json.RawMessage, maxPlayers int) {
 	req, err := api.DecodeJSON[api.LobbyConfigureRequestData](data)
 	if err != nil {
 		errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(err, api.RequestTypeConfigure, "invalid configure request"))
@@ -171,33 +229,94 @@ func handleConfigureRequest(ctx context.Context, lobby *quiz.Lobby, conn *websoc
 		return
 	}
 
+	if req.ClearPassword && req.Password != "" {
+		err := errors.New("password both set and cleared")
+		fields := map[string]string{"password": "must be empty to clear the password"}
+		errs.WriteWebsocketError(ctx, conn, errs.InputValidationError(err, api.RequestTypeConfigure, fields))
+		return
+	}
+
+	var (
+		q        api.Quiz
+		quizName = req.Quiz
+	)
 	if req.Quiz != "" {
-		q, ok := lobby.LoadQuiz(req.Quiz)
-		if !ok {
+		if state := lobby.State(); state != quiz.LobbyStateCreated && state != quiz.LobbyStateRegister {
+			errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(quiz.ErrQuizLocked, api.RequestTypeConfigure, "quiz can only be changed while registering"))
+			return
+		}
+		if req.Quiz == api.RandomQuiz {
+			quizName, q = lobby.RandomQuiz()
+		} else if q, ok = lobby.LoadQuiz(req.Quiz); !ok {
 			errs.WriteWebsocketError(ctx, conn, errs.QuizNotFoundError(api.RequestTypeConfigure, "invalid quiz selected"))
 			return
 		}
-		lobby.SetQuiz(q)
 	}
-	if req.Password != "" {
+	if req.MaxPlayers != nil {
+		if n := *req.MaxPlayers; n < 1 || (maxPlayers > 0 && n > maxPlayers) {
+			err := fmt.Errorf("invalid maximum players %d", n)
+			fields := map[string]string{"maxPlayers": fmt.Sprintf("must be between 1 and %d", maxPlayers)}
+			if maxPlayers <= 0 {
+				fields["maxPlayers"] = "must be positive"
+			}
+			errs.WriteWebsocketError(ctx, conn, errs.InputValidationError(err, api.RequestTypeConfigure, fields))
+			return
+		}
+		if err := lobby.SetMaxPlayers(*req.MaxPlayers); err != nil {
+			fields := map[string]string{"maxPlayers": "must not be lower than the players in the lobby nor the minimum players"}
+			errs.WriteWebsocketError(ctx, conn, errs.InputValidationError(err, api.RequestTypeConfigure, fields))
+			return
+		}
+	}
+
+	if req.Quiz != "" {
+		if err := lobby.ChangeQuiz(q); err != nil {
+			errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(err, api.RequestTypeConfigure, "quiz can only be changed while registering"))
+			return
+		}
+	}
+	if req.Password != "" || req.ClearPassword {
 		lobby.SetPassword(req.Password)
 	}
+	if req.Shuffle != nil {
+		lobby.SetShuffle(*req.Shuffle)
+	}
+	if req.ShuffleChoices != nil {
+		lobby.SetShuffleChoices(*req.ShuffleChoices)
+	}
+	if req.RevealAfterEach != nil {
+		lobby.SetRevealAfterEach(*req.RevealAfterEach)
+	}
 
 	res := &api.Response[api.EmptyResponseData]{
+		ID:   errs.RequestID(ctx),
 		Type: api.ResponseTypeConfigure,
 	}
 	if err := wsjson.Write(ctx, conn, res); err != nil {
 		slog.Error("configure response write",
 			slog.String("username", client.Username()),
-			slog.String("quiz", req.Quiz),
+			slog.String("quiz", quizName),
 			slog.Any("error", err))
 	}
 
+	update := api.LobbyUpdateResponseData{Quiz: quizName}
 	if req.Quiz != "" {
-		if err := lobby.BroadcastConfigure(ctx, req.Quiz); err != nil {
+		update.QuestionCount = len(q.Questions)
+		update.EstimatedDuration = lobby.EstimatedDuration()
+	}
+	if req.MaxPlayers != nil {
+		update.MaxPlayers = *req.MaxPlayers
+	}
+	if req.Password != "" || req.ClearPassword {
+		// Only tell whether a password is required, never the password.
+		required := lobby.HasPassword()
+		update.PasswordRequired = &required
+	}
+	if update != (api.LobbyUpdateResponseData{}) {
+		if err := lobby.BroadcastConfigure(ctx, update); err != nil {
 			slog.Error("broadcast player update: configure",
 				slog.String("username", client.Username()),
-				slog.String("quiz", req.Quiz),
+				slog.String("quiz", quizName),
 				slog.Any("error", err))
 		}
 	}
@@ -218,26 +337,88 @@ func handleStartRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.
 		return
 	}
 
+	if len(lobby.GetPlayerList()) < lobby.MinPlayers() {
+		errs.WriteWebsocketError(ctx, conn, errs.NotEnoughPlayersError(api.RequestTypeStart, lobby.MinPlayers()))
+		return
+	}
+
+	if q := lobby.Quiz(); q.Name == "" || len(q.Questions) == 0 {
+		err := errors.New("selected quiz is empty")
+		errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(err, api.RequestTypeStart, "selected quiz has no questions"))
+		return
+	}
+
+	if err := startQuiz(ctx, lobby); err != nil {
+		errs.WriteWebsocketError(ctx, conn, errs.InternalServerError(err, api.RequestTypeStart))
+		return
+	}
+
 	go func() { //nolint:contextcheck
-		if err := runQuiz(lobby); err != nil {
+		// The runner outlives the request and stops with the lobby.
+		ctx, cancel := lobbyContext(lobby)
+		defer cancel()
+
+		reset := lobby.GameReset()
+
+		if err := runQuiz(ctx, lobby); err != nil {
 			slog.Info("run quiz", slog.Any("error", err))
 			return
 		}
-		if err := runReview(lobby); err != nil {
+		if err := runReview(ctx, lobby, reset); err != nil {
 			slog.Info("run review", slog.Any("error", err))
 			return
 		}
+		if err := holdResults(ctx, lobby, reset); err != nil {
+			slog.Info("hold results", slog.Any("error", err))
+			return
+		}
 
-		_ = lobby.Close()
+		lobby.EndGame()
 	}()
 }
 
-func runQuiz(lobby *quiz.Lobby) error {
-	lobby.SetState(quiz.LobbyStateQuiz)
+// errQuizEnded is returned by the quiz runner when the lobby ends mid-quiz.
+var errQuizEnded = errors.New("quiz has ended")
+
+// errGameReset is returned by the quiz runner when the game is reset
+// before the lobby closes.
+var errGameReset = errors.New("game was reset")
+
+// lobbyContext returns a context cancelled once the lobby is closed.
+func lobbyContext(lobby *quiz.Lobby) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-lobby.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// quizEnded returns if the lobby was closed or all players left.
+func quizEnded(ctx context.Context, lobby *quiz.Lobby) bool {
+	return ctx.Err() != nil || lobby.State() == quiz.LobbyStateEnded
+}
+
+// startQuiz prepares the quiz questions and tells the lobby the quiz
+// started. The start is aborted without side effects if a player token
+// cannot be minted.
+func startQuiz(ctx context.Context, lobby *quiz.Lobby) error {
+	tokens, err := lobby.Start()
+	if err != nil {
+		return err
+	}
+
+	q := lobby.Quiz()
+	if lobby.Shuffle() {
+		q.Questions = quiz.ShuffleQuestions(q.Questions, lobby.Seed())
+	}
 
 	// Setup each question with a unique ID to link answers.
+	// IDs follow the played order so they must be set after shuffling.
 	// TODO: at lobby register once ?
-	q := lobby.Quiz()
 	for i, question := range q.Questions {
 		question.ID = i
 		q.Questions[i] = question
@@ -246,63 +427,169 @@ func runQuiz(lobby *quiz.Lobby) error {
 
 	_ = lobby.CloseUnregisteredConns()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	if err := lobby.BroadcastStart(ctx); err != nil {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := lobby.BroadcastStart(timeoutCtx, tokens); err != nil {
 		slog.Error("broadcast start", slog.Any("error", err))
 	}
-	cancel()
 
-	for _, question := range lobby.Quiz().Questions {
-		if lobby.State() == quiz.LobbyStateEnded { // All players left.
-			return errors.New("quiz has ended")
+	return nil
+}
+
+// countdown broadcasts the seconds remaining before the first question,
+// once per second.
+func countdown(ctx context.Context, lobby *quiz.Lobby) error {
+	remaining := int((lobby.StartCountdown() + time.Second - 1) / time.Second)
+	if remaining <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for ; remaining > 0; remaining-- {
+		timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := lobby.BroadcastCountdown(timeoutCtx, remaining); err != nil {
+			slog.Error("broadcast countdown", slog.Any("error", err))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return errQuizEnded
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// interQuestionDelay waits the lobby delay between two questions,
+// returning early if the lobby is closed.
+func interQuestionDelay(ctx context.Context, lobby *quiz.Lobby) error {
+	delay := lobby.InterQuestionDelay()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return errQuizEnded
+	case <-lobby.Done():
+		return errQuizEnded
+	case <-timer.C:
+		return nil
+	}
+}
+
+func runQuiz(ctx context.Context, lobby *quiz.Lobby) error {
+	if err := countdown(ctx, lobby); err != nil {
+		return err
+	}
+
+	q := lobby.Quiz()
+
+	for i, question := range q.Questions {
+		if quizEnded(ctx, lobby) {
+			return errQuizEnded
+		}
+		if i > 0 { // The previous question is closed, late answers are rejected.
+			if err := interQuestionDelay(ctx, lobby); err != nil {
+				return err
+			}
 		}
 
-		question.Answer = nil
-		if question.Time <= 0 {
-			question.Time = 30 * time.Second
+		original := question
+
+		question = quiz.ResolveMediaURLs(question, lobby.MediaBaseURL(), q.Name).Sanitized()
+		if lobby.ShuffleChoices() {
+			// Stored as current question so late joiners see the same order.
+			question = quiz.ShuffleChoices(question, lobby.Seed())
 		}
+		question.Time = lobby.QuestionTime(question)
 		lobby.SetCurrentQuestion(&question)
 
 		start := time.Now()
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		if err := lobby.BroadcastQuestion(ctx, question); err != nil {
+		timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := lobby.BroadcastQuestion(timeoutCtx, question, len(q.Questions)); err != nil {
 			slog.Error("broadcast question", slog.Any("error", err))
 		}
 		cancel()
 
-		deadline, cancel := context.WithDeadline(context.Background(), start.Add(question.Time))
-		<-deadline.Done()
-		cancel()
+		// Lobby may be closed or the quiz paused during the question.
+		if err := lobby.WaitQuestion(question.Time - time.Since(start)); err != nil {
+			return errQuizEnded
+		}
+
+		// Closed before the reveal so the revealed answer can't be sent.
+		lobby.SetCurrentQuestion(nil)
+
+		if lobby.RevealAfterEach() {
+			timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			if err := lobby.BroadcastAnswerReveal(timeoutCtx, original); err != nil {
+				slog.Error("broadcast answer reveal", slog.Any("error", err))
+			}
+			cancel()
+		}
 	}
 
 	lobby.SetCurrentQuestion(nil)
 
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	if err := lobby.BroadcastQuizEnd(timeoutCtx, len(q.Questions)); err != nil {
+		slog.Error("broadcast quiz end", slog.Any("error", err))
+	}
+	cancel()
+
 	return nil
 }
 
-func runReview(lobby *quiz.Lobby) error {
+func runReview(ctx context.Context, lobby *quiz.Lobby, reset <-chan struct{}) error {
 	lobby.SetState(quiz.LobbyStateAnswers)
 
 	for _, question := range lobby.Quiz().Questions {
-		if lobby.State() == quiz.LobbyStateEnded { // All players left.
-			return errors.New("quiz has ended")
+		if quizEnded(ctx, lobby) {
+			return errQuizEnded
 		}
 
-		if question.Time <= 0 {
-			question.Time = 30 * time.Second
-		}
+		question.Time = lobby.QuestionTime(question)
 
 		for _, player := range lobby.AllPlayers() {
-			answer := player.GetAnswer(question.ID)
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			if err := lobby.BroadcastReview(ctx, question, player.Username(), answer); err != nil {
-				slog.Error("broadcast review", slog.Any("error", err))
+			if player == nil {
+				continue
 			}
 			select {
-			case <-lobby.Done(): // Maximum lobby timeout.
+			case <-reset:
+				return errGameReset
+			default:
+			}
+
+			answer, answered := player.LookupAnswer(question.ID)
+			// Partially correct answers are credited as is, without review.
+			validated := answered && quiz.ScoreAnswer(question, answer) > 0
+			if !validated { // Requested before the broadcast the owner answers.
+				lobby.RequestReview()
+			}
+			timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			if err := lobby.BroadcastReview(timeoutCtx, question, player.Username(), answer, validated); err != nil {
+				slog.ErrorContext(ctx, "broadcast review", slog.Any("error", err))
+			}
+			if validated { // Already scored by lobby.ComputeResults.
 				cancel()
-				return errors.New("quiz has ended")
+				continue
+			}
+			select {
+			case <-ctx.Done(): // Lobby closed, maximum lobby timeout included.
+				cancel()
+				return errQuizEnded
+			case <-reset:
+				cancel()
+				return errGameReset
 			case ok := <-lobby.NextReview():
 				if ok {
 					player.AddScore(1)
@@ -312,16 +599,27 @@ func runReview(lobby *quiz.Lobby) error {
 		}
 	}
 
-	results := map[string]int{}
-	for _, player := range lobby.AllPlayers() {
-		results[player.Username()] = player.Score()
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	if err := lobby.BroadcastResults(ctx, results); err != nil {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	if err := lobby.BroadcastResults(timeoutCtx, lobby.ComputeResults()); err != nil {
 		slog.Error("broadcast results", slog.Any("error", err))
 	}
 	cancel()
 
 	return nil
 }
+
+// holdResults keeps the lobby open for its results hold, returning
+// errGameReset if the game is reset meanwhile.
+func holdResults(ctx context.Context, lobby *quiz.Lobby, reset <-chan struct{}) error {
+	timer := time.NewTimer(lobby.ResultsHold())
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return errQuizEnded
+	case <-reset:
+		return errGameReset
+	case <-timer.C:
+		return nil
+	}
+}
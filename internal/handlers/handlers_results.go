@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sevenquiz-backend/api"
+	errs "sevenquiz-backend/internal/errors"
+	"sevenquiz-backend/internal/quiz"
+	"strconv"
+	"strings"
+)
+
+const csvContentType = "text/csv"
+
+// LobbyResultsHandler returns a handler exporting the results of a lobby
+// once its quiz ended, as JSON or as CSV if requested by the Accept header.
+//
+// Only the lobby owner may export them, authenticated by the owner token
+// or its player token in the Authorization header.
+func LobbyResultsHandler(lobbies quiz.LobbyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id := r.PathValue("id")
+
+		lobby, ok := lobbies.Get(id)
+		if !ok || lobby == nil {
+			errs.WriteHTTPError(ctx, w, errs.HTTPLobbyNotFoundError(id))
+			return
+		}
+
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !lobby.IsOwnerToken(token) {
+			errs.WriteHTTPError(ctx, w, errs.UnauthorizedError("user is not lobby owner"))
+			return
+		}
+
+		switch state := lobby.State(); state {
+		case quiz.LobbyStateAnswers, quiz.LobbyStateEnded:
+		default:
+			errs.WriteHTTPError(ctx, w, errs.ResultsNotReadyError(state.String()))
+			return
+		}
+
+		res := lobby.ExportResults()
+
+		if !acceptsCSV(r) {
+			if err := json.NewEncoder(w).Encode(res); err != nil {
+				slog.ErrorContext(ctx, "lobby results response encoding", slog.Any("error", err))
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", csvContentType+"; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="results-%s.csv"`, lobby.ID()))
+		if err := writeResultsCSV(w, res); err != nil {
+			slog.ErrorContext(ctx, "lobby results csv encoding", slog.Any("error", err))
+		}
+	}
+}
+
+// acceptsCSV returns if the request Accept header lists text/csv.
+func acceptsCSV(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == csvContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResultsCSV writes a row per player in leaderboard order with its
+// rank, username, score and correctness of each question.
+func writeResultsCSV(w http.ResponseWriter, res api.LobbyResultsResponseData) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"rank", "username", "score"}
+	for _, question := range res.Questions {
+		header = append(header, question.Title)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, entry := range res.Leaderboard {
+		row := []string{
+			strconv.Itoa(entry.Rank),
+			entry.Username,
+			strconv.FormatFloat(entry.Score, 'f', -1, 64),
+		}
+		for _, question := range res.Questions {
+			row = append(row, strconv.FormatBool(question.Correct[entry.Username]))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -3,7 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"sevenquiz-backend/api"
 	errs "sevenquiz-backend/internal/errors"
 	"sevenquiz-backend/internal/quiz"
@@ -13,12 +13,16 @@ import (
 
 func (h LobbyHandler) handleReviewState(ctx context.Context, req api.Request[json.RawMessage], lobby *quiz.Lobby, conn *websocket.Conn) {
 	switch req.Type {
+	case api.RequestTypeLobby:
+		handleLobbyRequest(ctx, lobby, conn, false)
 	case api.RequestTypeReview:
 		handleReviewRequest(ctx, lobby, conn, req.Data)
+	case api.RequestTypeLogin:
+		handleLoginRequest(ctx, lobby, conn, req.Data)
+	case api.RequestTypeReset:
+		handleResetRequest(ctx, lobby, conn)
 	default:
-		err := fmt.Errorf("unknown request: %s", req.Type)
-		apiErr := errs.InvalidRequestError(err, api.RequestTypeUnknown, err.Error())
-		errs.WriteWebsocketError(ctx, conn, apiErr)
+		handleUnexpectedRequest(ctx, lobby, conn, req.Type)
 	}
 }
 
@@ -37,5 +41,33 @@ func handleReviewRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket
 		return
 	}
 
-	lobby.SendReview(req.Validate)
+	if err := lobby.SendReview(req.Validate); err != nil {
+		errs.WriteWebsocketError(ctx, conn, errs.NoReviewPendingError(api.RequestTypeReview))
+		return
+	}
+}
+
+// handleResetRequest sets the lobby back to registration for the same
+// players to play again. The quiz runner stops on reset.
+func handleResetRequest(ctx context.Context, lobby *quiz.Lobby, conn *websocket.Conn) {
+	client, ok := lobby.GetPlayerByConn(conn)
+	if !ok || client == nil || client.Username() != lobby.Owner() {
+		apiErr := errs.UnauthorizedRequestError(api.RequestTypeReset, "user is not lobby owner")
+		errs.WriteWebsocketError(ctx, conn, apiErr)
+		return
+	}
+
+	if err := lobby.ResetGame(); err != nil {
+		errs.WriteWebsocketError(ctx, conn, errs.InvalidRequestError(err, api.RequestTypeReset, err.Error()))
+		return
+	}
+
+	if err := lobby.BroadcastReset(ctx); err != nil {
+		slog.ErrorContext(ctx, "broadcast reset", slog.Any("error", err))
+	}
+	if err := lobby.BroadcastPlayerList(ctx); err != nil {
+		slog.ErrorContext(ctx, "broadcast player list", slog.Any("error", err))
+	}
+
+	slog.InfoContext(ctx, "successful request")
 }
@@ -3,11 +3,15 @@ package handlers_test
 import (
 	"context"
 	"embed"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"runtime"
@@ -17,59 +21,25 @@ import (
 	"sevenquiz-backend/internal/handlers"
 	mws "sevenquiz-backend/internal/middlewares"
 	"sevenquiz-backend/internal/quiz"
+	"sevenquiz-backend/internal/rate"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
 	"github.com/google/go-cmp/cmp"
-	"gopkg.in/yaml.v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 //go:embed tests/quizzes
 var quizzes embed.FS
 
-func getQuizzesFromFS(quizFS fs.FS) (map[string]api.Quiz, error) {
-	quizzes := map[string]api.Quiz{}
-
-	root := "."
-	depth := 0
-
-	err := fs.WalkDir(quizFS, root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if path == root {
-			return nil
-		}
-		if d.IsDir() && strings.Count(path, "/") <= depth {
-			path := d.Name() + "/questions.yml"
-			f, err := quizFS.Open(path)
-			if err != nil {
-				return err
-			}
-			quiz := api.Quiz{Name: d.Name()}
-			dec := yaml.NewDecoder(f)
-			for {
-				var q api.Question
-				if err := dec.Decode(&q); err != nil {
-					if errors.Is(err, io.EOF) {
-						break
-					}
-					quiz.Questions = []api.Question{}
-					return err
-				}
-				quiz.Questions = append(quiz.Questions, q)
-			}
-			quizzes[quiz.Name] = quiz
-		}
-		return nil
-	})
-
-	return quizzes, err
-}
-
 func init() {
 	log.SetOutput(io.Discard)
 
@@ -78,12 +48,13 @@ func init() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	quizzes, err := getQuizzesFromFS(quizzesFS)
+	defaultTestQuizzesFS = quizzesFS
+	defaultTestQuizStore, err = quiz.NewQuizStore(quiz.NewFSLoader(quizzesFS))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	defaultTestLobbyOptions.Quizzes = quizzes
+	defaultTestLobbyOptions.Quizzes = defaultTestQuizStore.All()
 }
 
 var (
@@ -93,6 +64,7 @@ var (
 			MaxPlayers:         20,
 			RegisterTimeout:    15 * time.Second,
 			WebsocketReadLimit: 512,
+			PlayerReadLimit:    8192,
 		},
 	}
 	defaultTestAcceptOptions = websocket.AcceptOptions{
@@ -106,6 +78,8 @@ var (
 	defaultTestLobbyOptions = quiz.LobbyOptions{
 		MaxPlayers: 20,
 	}
+	defaultTestQuizStore *quiz.QuizStore
+	defaultTestQuizzesFS fs.FS
 )
 
 // param named "_pattern" to avoid unparam linter FP until new pattern is tested.
@@ -156,7 +130,7 @@ func TestLobbyCreate(t *testing.T) {
 	}
 
 	// Should spawn a goroutine for lobby timeout.
-	handlers.CreateLobbyHandler(defaultTestConfig, lobbies, defaultTestLobbyOptions.Quizzes)(res, req)
+	handlers.CreateLobbyHandler(defaultTestConfig, lobbies, defaultTestQuizStore)(res, req)
 
 	if got, want := runtime.NumGoroutine(), 3; got != want {
 		t.Error("Lobby's timeout goroutine did not spawn")
@@ -179,6 +153,9 @@ func TestLobbyCreate(t *testing.T) {
 	if !ok || lobby == nil {
 		t.Fatal("Could not get created lobby")
 	}
+	if _, err := lobby.CheckToken(apiRes.Token); err != nil {
+		t.Errorf("Invalid owner token returned: %v", err)
+	}
 	lobbyID := lobby.ID()
 	if len(lobbyID) != 5 {
 		t.Errorf("Unexpected lobby id in lobby banner: %s", lobbyID)
@@ -192,9 +169,7 @@ func TestLobbyCreate(t *testing.T) {
 	}
 }
 
-func TestLobbyBanner(t *testing.T) {
-	t.Parallel()
-
+func TestLobbyConnsNoLeak(t *testing.T) {
 	var (
 		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
 			MaxPlayers: 20,
@@ -209,50 +184,114 @@ func TestLobbyBanner(t *testing.T) {
 		path = "/lobby/" + lobby.ID()
 	)
 
-	_, cli, res := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mw))
+	defer s.Close()
 
-	apiRes, err := cli.ReadResponse()
-	if err != nil {
-		t.Fatalf("Could not read lobby banner: %v", err)
-	}
+	base := runtime.NumGoroutine()
 
-	if apiRes.Type != api.ResponseTypeLobby {
-		t.Fatalf("Could not read lobby banner: got api response: %+v", res)
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	for range 50 {
+		cli, _, err := client.Dial(context.Background(), url, nil)
+		if err != nil {
+			t.Fatalf("Error while dialing test server: %v", err)
+		}
+		mustReadResponseType(t, cli, api.ResponseTypeLobby)
+		cli.Close()
 	}
 
-	data, err := api.DecodeJSON[api.LobbyResponseData](apiRes.Data)
-	if err != nil {
-		t.Fatalf("Could not decode lobby data: %v", err)
+	// Conns are torn down asynchronously by the server.
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			t.Fatalf("Conn goroutines were not cleaned up, got %d, want %d", runtime.NumGoroutine(), base)
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
+}
 
-	want := defaultTestWantLobby
+// logBuffer collects the lines written by a logger.
+type logBuffer struct {
+	mu    sync.Mutex
+	lines []string
+}
 
-	if got, want := data.Owner, want.Owner; !cmp.Equal(got, want) {
-		t.Errorf("Unexpected owner in lobby banner: got %v, want %v", got, want)
-	}
-	if got, want := data.MaxPlayers, want.MaxPlayers; got != want {
-		t.Errorf("Unexpected max players in lobby banner: got %d, want %d", got, want)
-	}
-	if len(data.ID) != 5 {
-		t.Errorf("Unexpected lobby id in lobby banner: %s", data.ID)
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines = append(b.lines, string(p))
+	return len(p), nil
+}
+
+// find returns the first JSON log entry matching all attrs.
+func (b *logBuffer) find(attrs map[string]string) (map[string]any, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+next:
+	for _, line := range b.lines {
+		entry := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		for k, v := range attrs {
+			if entry[k] != v {
+				continue next
+			}
+		}
+		return entry, true
 	}
-	if data.Created == "" {
-		t.Error("Missing created field in lobby banner")
+	return nil, false
+}
+
+// mustCaptureLogs redirects the default logger to the returned buffer
+// until the test ends. Tests using it must not be parallel.
+func mustCaptureLogs(t *testing.T) *logBuffer {
+	t.Helper()
+
+	buf := &logBuffer{}
+	prev := slog.Default()
+	slog.SetDefault(handlers.NewLogger(buf, config.LogConf{},
+		mws.LobbyIDKey,
+		mws.LobbyUsernameKey,
+		mws.LobbyRequestKey,
+	))
+	t.Cleanup(func() {
+		slog.SetDefault(prev)
+		log.SetOutput(io.Discard) // Redirected by slog.SetDefault.
+	})
+
+	return buf
+}
+
+func TestNewLogger(t *testing.T) {
+	t.Parallel()
+
+	buf := &logBuffer{}
+	cfg := config.LogConf{
+		Level:  slog.LevelWarn,
+		Format: config.LogFormatText,
 	}
-	if diff := cmp.Diff(want.Quizzes, data.Quizzes); diff != "" {
-		t.Errorf("Unexpected quizzes list in lobby banner (-want+got):\n%v", diff)
+	logger := handlers.NewLogger(buf, cfg, mws.LobbyIDKey)
+
+	ctx := context.WithValue(context.Background(), mws.LobbyIDKey, slog.String("lobby_id", "abcde"))
+	logger.InfoContext(ctx, "filtered")
+	logger.WarnContext(ctx, "kept")
+
+	if got, want := len(buf.lines), 1; got != want {
+		t.Fatalf("Unexpected log lines count: got %d, want %d: %q", got, want, buf.lines)
 	}
-	if got, want := data.CurrentQuiz, want.CurrentQuiz; got != want {
-		t.Errorf("Unexpected current quiz in lobby banner: got %s, want %s", got, want)
+	for _, want := range []string{"level=WARN", "msg=kept", "lobby_id=abcde"} {
+		if !strings.Contains(buf.lines[0], want) {
+			t.Errorf("Log line %q does not contain %q", buf.lines[0], want)
+		}
 	}
 }
 
-func TestLobbyRegister(t *testing.T) {
-	t.Parallel()
+func TestLobbyLogUsername(t *testing.T) {
+	logs := mustCaptureLogs(t)
 
 	var (
 		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
-		mw             = mws.NewLobby(lobbies)
 		handler        = handlers.LobbyHandler{
 			Config:        defaultTestConfig,
 			Lobbies:       lobbies,
@@ -261,295 +300,4000 @@ func TestLobbyRegister(t *testing.T) {
 		path = "/lobby/" + lobby.ID()
 	)
 
-	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
-
-	username := "testuser"
-	want := defaultTestWantLobby
+	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)), path)
 
-	mustRegisterOwner(t, cli, &want, username)
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
 
-	_, player, ok := lobby.GetPlayer(username)
-	if !ok || player == nil {
-		t.Fatalf("Could not get registered player")
-	}
-	if got, want := player.Username(), username; got != want {
-		t.Errorf("Invalid player username, got %s, want %s", got, want)
+	if _, ok := logs.find(map[string]string{"request": "register", "username": "owner"}); ok {
+		t.Error("Username logged before registration")
 	}
 
-	res, err := cli.Register(username)
-	if err != nil {
-		t.Fatalf("Error while sending register command: %v", err)
-	}
-	if res.Type != api.ResponseTypeError {
-		t.Fatalf("Unexpected api response: %+v", res)
+	if _, err := cli.Lobby(); err != nil {
+		t.Fatalf("Could not request lobby: %v", err)
 	}
 
-	data, err := api.DecodeJSON[api.ErrorData[api.WebsocketErrorCode]](res.Data)
-	if err != nil {
-		t.Fatalf("Error while decoding register response: %v", err)
+	entry, ok := logs.find(map[string]string{"request": "lobby", "msg": "successful request"})
+	if !ok {
+		t.Fatal("Lobby request was not logged")
 	}
-	if got, want := data.Code, api.PlayerAlreadyRegisteredCode; got != want {
-		t.Errorf("Invalid register error code, got %d, want %d", got, want)
+	if got, want := entry["username"], "owner"; got != want {
+		t.Errorf("Unexpected username in lobby request log: got %v, want %v", got, want)
+	}
+	if got, want := entry["lobby_id"], lobby.ID(); got != want {
+		t.Errorf("Unexpected lobby id in lobby request log: got %v, want %v", got, want)
 	}
 }
 
-func TestLobbyTimeout(t *testing.T) {
+func TestLobbyCreateParams(t *testing.T) {
 	t.Parallel()
 
-	var (
-		lobbies = quiz.NewLobbiesCache()
-		req     = httptest.NewRequest(http.MethodPost, "/lobby", nil)
-		res     = httptest.NewRecorder()
-	)
+	lobbies := quiz.NewLobbiesCache()
 
-	cfg := defaultTestConfig
-	cfg.Lobby.RegisterTimeout = time.Nanosecond
+	body := strings.NewReader(`{"quiz":"custom","maxPlayers":3,"password":"secret"}`)
+	req := httptest.NewRequest(http.MethodPost, "/lobby", body)
+	rec := httptest.NewRecorder()
 
-	handlers.CreateLobbyHandler(cfg, lobbies, defaultTestLobbyOptions.Quizzes)(res, req)
+	handlers.CreateLobbyHandler(defaultTestConfig, lobbies, defaultTestQuizStore)(rec, req)
 
-	apiRes := &api.CreateLobbyResponseData{}
-	if err := json.NewDecoder(res.Body).Decode(apiRes); err != nil {
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+	apiRes := api.CreateLobbyResponseData{}
+	if err := json.NewDecoder(rec.Body).Decode(&apiRes); err != nil {
 		t.Fatalf("Could not decode create lobby response: %v", err)
 	}
+	t.Cleanup(func() { lobbies.Delete(apiRes.LobbyID) })
 
-	// wait for the goroutine to process the delete
-	time.Sleep(time.Millisecond)
-
-	if lobby, ok := lobbies.Get(apiRes.LobbyID); ok || lobby != nil {
-		t.Error("Lobby was not deleted after timeout")
+	handler := handlers.LobbyHandler{
+		Config:        defaultTestConfig,
+		Lobbies:       lobbies,
+		AcceptOptions: defaultTestAcceptOptions,
 	}
+	path := "/lobby/" + apiRes.LobbyID + "?p=secret"
+	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)), path)
+
+	wantLobby := defaultTestWantLobby
+	wantLobby.MaxPlayers = 3
+	wantLobby.CurrentQuiz = "custom"
+	mustLobbyBanner(t, cli, wantLobby)
 }
 
-func TestLobbyPlayerList(t *testing.T) {
+func TestLobbyCreateInvalidParams(t *testing.T) {
 	t.Parallel()
 
-	var (
-		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
-		mw             = mws.NewLobby(lobbies)
-		handler        = handlers.LobbyHandler{
-			Config:        defaultTestConfig,
-			Lobbies:       lobbies,
-			AcceptOptions: defaultTestAcceptOptions,
-		}
-		path = "/lobby/" + lobby.ID()
-	)
+	tests := map[string]string{
+		"unknown quiz":      `{"quiz":"unknown"}`,
+		"too many players":  `{"maxPlayers":1000}`,
+		"negative players":  `{"maxPlayers":-1}`,
+		"malformed request": `{"quiz":`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-	s, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+			lobbies := quiz.NewLobbiesCache()
+			req := httptest.NewRequest(http.MethodPost, "/lobby", strings.NewReader(body))
+			rec := httptest.NewRecorder()
 
-	// Setup lobby owner
-	owner := "owner"
-	want := defaultTestWantLobby
-	mustRegisterOwner(t, cli, &want, owner)
+			handlers.CreateLobbyHandler(defaultTestConfig, lobbies, defaultTestQuizStore)(rec, req)
 
-	players := map[string]*client.Client{
-		"testuser":  nil,
-		"testuser2": nil,
-		"testuser3": nil,
+			if got, want := rec.Code, http.StatusBadRequest; got != want {
+				t.Errorf("Unexpected status code: got %d, want %d", got, want)
+			}
+			for id := range lobbies.All() {
+				t.Errorf("Lobby %s was created with invalid parameters", id)
+			}
+		})
 	}
+}
 
-	for username := range players {
-		cli2, _ := mustDialTestServer(t, s, path)
-		players[username] = cli2
+func TestLobbyCreateIdempotencyKey(t *testing.T) {
+	t.Parallel()
 
-		mustRegisterPlayer(t, cli2, &want, username)
-		mustBroadcastPlayerUpdate(t, cli, username, "join")
+	lobbies := quiz.NewLobbiesCache()
+	handler := handlers.CreateLobbyHandler(defaultTestConfig, lobbies, defaultTestQuizStore)
 
-		want.PlayerList = append(want.PlayerList, username)
+	create := func(key string) api.CreateLobbyResponseData {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodPost, "/lobby", nil)
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		if got, want := rec.Code, http.StatusOK; got != want {
+			t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+		}
+		apiRes := api.CreateLobbyResponseData{}
+		if err := json.NewDecoder(rec.Body).Decode(&apiRes); err != nil {
+			t.Fatalf("Could not decode create lobby response: %v", err)
+		}
+		t.Cleanup(func() { lobbies.Delete(apiRes.LobbyID) })
+		return apiRes
 	}
 
-	// Make sure new players are now in the list.
-	mustLobby(t, cli, want)
+	first, retry := create("retry"), create("retry")
+	if first != retry {
+		t.Errorf("Retried creation returned another lobby: got %+v, want %+v", retry, first)
+	}
 
-	for username, cli2 := range players {
-		cli2.Close()
-		<-time.After(time.Millisecond)
-		mustBroadcastPlayerUpdate(t, cli, username, "disconnect")
+	count := 0
+	for range lobbies.All() {
+		count++
+	}
+	if got, want := count, 1; got != want {
+		t.Errorf("Unexpected lobbies count: got %d, want %d", got, want)
+	}
 
-		// Make sure disconnected player is not on the list.
-		want.PlayerList = slices.DeleteFunc(want.PlayerList, func(s string) bool {
-			return s == username
-		})
-		mustLobby(t, cli, want)
+	if other := create("other"); other.LobbyID == first.LobbyID {
+		t.Error("Distinct idempotency keys returned the same lobby")
+	}
+
+	// A deleted lobby is not returned again.
+	lobbies.Delete(first.LobbyID)
+	if again := create("retry"); again.LobbyID == first.LobbyID {
+		t.Error("Idempotency key returned a deleted lobby")
 	}
 }
 
-func TestLobbyMaxPlayers(t *testing.T) {
+func TestLobbyCreateRateLimit(t *testing.T) {
 	t.Parallel()
 
-	var (
-		maxPlayers     = 1
-		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
-			MaxPlayers: maxPlayers,
-			Quizzes:    defaultTestLobbyOptions.Quizzes,
-		})
-	)
+	const limit = 3
 
-	cfg := defaultTestConfig
-	cfg.Lobby.MaxPlayers = maxPlayers
+	lobbies := quiz.NewLobbiesCache()
+	limiter := rate.NewLimiter(time.Minute, limit)
+	handler := mws.Chain(handlers.CreateLobbyHandler(defaultTestConfig, lobbies, defaultTestQuizStore), mws.NewRateLimit(limiter))
 
-	mw := mws.NewLobby(lobbies)
-	handler := handlers.LobbyHandler{
-		Config:        cfg,
-		Lobbies:       lobbies,
-		AcceptOptions: defaultTestAcceptOptions,
+	for range limit {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/lobby", nil))
+		if got, want := rec.Code, http.StatusOK; got != want {
+			t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+		}
+		apiRes := api.CreateLobbyResponseData{}
+		if err := json.NewDecoder(rec.Body).Decode(&apiRes); err != nil {
+			t.Fatalf("Could not decode create lobby response: %v", err)
+		}
+		t.Cleanup(func() { lobbies.Delete(apiRes.LobbyID) })
 	}
-	path := "/lobby/" + lobby.ID()
-	s, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
-
-	// Setup lobby owner
-	want := defaultTestWantLobby
-	want.MaxPlayers = maxPlayers
-	mustRegisterOwner(t, cli, &want, "owner")
 
-	// Make sure no players can join and be upgraded to websocket.
-	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
-	cli, res, err := client.Dial(context.Background(), url, nil)
-	if cli != nil {
-		cli.Close()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/lobby", nil))
+	if got, want := rec.Code, http.StatusTooManyRequests; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
 	}
-	if err == nil {
-		t.Errorf("Player was able to join a full lobby, response %+v", res)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Missing Retry-After header")
+	}
+	apiErr := api.HTTPErrorData{}
+	if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("Could not decode error response: %v", err)
+	}
+	if got, want := apiErr.Code, api.TooManyRequestsHTTPCode; got != want {
+		t.Errorf("Unexpected error code: got %d, want %d", got, want)
+	}
+	if !apiErr.Retryable || apiErr.RetryAfter <= 0 {
+		t.Errorf("Unexpected retry hints: %+v", apiErr)
 	}
 }
 
-func TestLobbyOwnerElection(t *testing.T) {
+func TestLobbyCreateDrain(t *testing.T) {
 	t.Parallel()
 
 	var (
 		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
-		mw             = mws.NewLobby(lobbies)
 		handler        = handlers.LobbyHandler{
 			Config:        defaultTestConfig,
 			Lobbies:       lobbies,
 			AcceptOptions: defaultTestAcceptOptions,
 		}
-		path = "/lobby/" + lobby.ID()
+		path  = "/lobby/" + lobby.ID()
+		drain = &mws.Drain{}
 	)
 
-	s, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+	adminMw := mws.NewAdmin(defaultTestAdminToken)
+	mux := http.NewServeMux()
+	mux.Handle("POST /lobby", mws.Chain(handlers.CreateLobbyHandler(defaultTestConfig, lobbies, defaultTestQuizStore), mws.NewDrain(drain)))
+	mux.Handle("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	mux.Handle("POST /admin/drain", mws.Chain(handlers.AdminDrainHandler(drain, true), adminMw))
+	mux.Handle("DELETE /admin/drain", mws.Chain(handlers.AdminDrainHandler(drain, false), adminMw))
+	mux.Handle("GET /readyz", handlers.ReadyzHandler(drain))
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
 
-	// Setup lobby owner
-	owner := "owner"
+	cli, _ := mustDialTestServer(t, s, path)
 	wantLobby := defaultTestWantLobby
-	mustRegisterOwner(t, cli, &wantLobby, owner)
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
 
-	// Setup second player to join
-	cli2, _ := mustDialTestServer(t, s, path)
+	create := func() int {
+		t.Helper()
 
-	nextPlayer := "nextplayer"
-	mustRegisterPlayer(t, cli2, &wantLobby, nextPlayer)
+		res := mustHTTPRequest(t, http.MethodPost, s.URL+"/lobby", "")
+		if res.StatusCode == http.StatusOK {
+			apiRes := api.CreateLobbyResponseData{}
+			if err := json.NewDecoder(res.Body).Decode(&apiRes); err != nil {
+				t.Fatalf("Could not decode create lobby response: %v", err)
+			}
+			t.Cleanup(func() { lobbies.Delete(apiRes.LobbyID) })
+		}
+		return res.StatusCode
+	}
 
-	// Close owner client, must be replaced by next player.
-	cli.Close()
-	mustBroadcastPlayerUpdate(t, cli2, owner, "disconnect")
-	mustBroadcastPlayerUpdate(t, cli2, nextPlayer, "new owner")
-	if got, want := lobby.Owner(), nextPlayer; got != want {
-		t.Errorf("Invalid lobby owner, got %s, want %s", got, want)
+	res := mustHTTPRequest(t, http.MethodPost, s.URL+"/admin/drain", string(defaultTestAdminToken))
+	if got, want := res.StatusCode, http.StatusNoContent; got != want {
+		t.Fatalf("Unexpected drain status code: got %d, want %d", got, want)
 	}
 
-	// Close new owner client, no other players so lobby must be deleted.
-	cli2.Close()
-	<-time.After(time.Millisecond)
+	if got, want := create(), http.StatusServiceUnavailable; got != want {
+		t.Errorf("Unexpected create status code while draining: got %d, want %d", got, want)
+	}
+	if got, want := mustHTTPRequest(t, http.MethodGet, s.URL+"/readyz", "").StatusCode, http.StatusServiceUnavailable; got != want {
+		t.Errorf("Unexpected readyz status code while draining: got %d, want %d", got, want)
+	}
 
-	if lobby, ok := lobbies.Get(lobby.ID()); ok || lobby != nil {
-		t.Error("Lobby was not deleted after owner disconnect")
+	// The existing lobby is still served.
+	if _, err := cli.Lobby(); err != nil {
+		t.Fatalf("Could not request lobby while draining: %v", err)
+	}
+
+	res = mustHTTPRequest(t, http.MethodDelete, s.URL+"/admin/drain", string(defaultTestAdminToken))
+	if got, want := res.StatusCode, http.StatusNoContent; got != want {
+		t.Fatalf("Unexpected undrain status code: got %d, want %d", got, want)
+	}
+
+	if got, want := create(), http.StatusOK; got != want {
+		t.Errorf("Unexpected create status code after draining: got %d, want %d", got, want)
+	}
+	if got, want := mustHTTPRequest(t, http.MethodGet, s.URL+"/readyz", "").StatusCode, http.StatusOK; got != want {
+		t.Errorf("Unexpected readyz status code after draining: got %d, want %d", got, want)
 	}
 }
 
-func TestLobbyKick(t *testing.T) {
+func TestLobbyCreateMaxLobbies(t *testing.T) {
 	t.Parallel()
 
-	var (
-		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
-		mw             = mws.NewLobby(lobbies)
-		handler        = handlers.LobbyHandler{
-			Config:        defaultTestConfig,
-			Lobbies:       lobbies,
-			AcceptOptions: defaultTestAcceptOptions,
-		}
-		path = "/lobby/" + lobby.ID()
-	)
+	cfg := defaultTestConfig
+	cfg.Lobby.MaxLobbies = 2
 
-	s, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+	lobbies := quiz.NewLobbiesCache()
+	handler := handlers.CreateLobbyHandler(cfg, lobbies, defaultTestQuizStore)
+
+	create := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/lobby", nil))
+		return rec
+	}
+
+	var ids []string
+	for range cfg.Lobby.MaxLobbies {
+		rec := create()
+		if got, want := rec.Code, http.StatusOK; got != want {
+			t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+		}
+		apiRes := api.CreateLobbyResponseData{}
+		if err := json.NewDecoder(rec.Body).Decode(&apiRes); err != nil {
+			t.Fatalf("Could not decode create lobby response: %v", err)
+		}
+		ids = append(ids, apiRes.LobbyID)
+		t.Cleanup(func() { lobbies.Delete(apiRes.LobbyID) })
+	}
+
+	rec := create()
+	if got, want := rec.Code, http.StatusServiceUnavailable; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+	apiErr := api.HTTPErrorData{}
+	if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("Could not decode error response: %v", err)
+	}
+	if got, want := apiErr.Code, api.TooManyLobbiesHTTPCode; got != want {
+		t.Errorf("Unexpected error code: got %d, want %d", got, want)
+	}
+
+	// A deleted lobby frees up its slot.
+	lobbies.Delete(ids[0])
+	rec = create()
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Fatalf("Unexpected status code after deletion: got %d, want %d", got, want)
+	}
+	apiRes := api.CreateLobbyResponseData{}
+	if err := json.NewDecoder(rec.Body).Decode(&apiRes); err != nil {
+		t.Fatalf("Could not decode create lobby response: %v", err)
+	}
+	t.Cleanup(func() { lobbies.Delete(apiRes.LobbyID) })
+}
+
+func TestLobbyStatus(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers: 1,
+			Quizzes:    defaultTestLobbyOptions.Quizzes,
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+	)
+
+	protected, err := lobbies.Register(quiz.LobbyOptions{
+		Quizzes:  defaultTestLobbyOptions.Quizzes,
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+	t.Cleanup(func() { lobbies.Delete(protected.ID()) })
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	mux.Handle("GET /lobby/{id}/status", handlers.LobbyStatusHandler(lobbies))
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	mustLobbyStatus(t, s.URL+"/lobby/"+lobby.ID()+"/status", api.LobbyStatusResponseData{
+		Exists: true,
+		State:  "created",
+	})
+	mustLobbyStatus(t, s.URL+"/lobby/"+protected.ID()+"/status", api.LobbyStatusResponseData{
+		Exists:           true,
+		State:            "created",
+		PasswordRequired: true,
+	})
+
+	// A single conn fills the lobby.
+	cli, _ := mustDialTestServer(t, s, "/lobby/"+lobby.ID())
+	wantLobby := defaultTestWantLobby
+	wantLobby.MaxPlayers = 1
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	mustLobbyStatus(t, s.URL+"/lobby/"+lobby.ID()+"/status", api.LobbyStatusResponseData{
+		Exists:      true,
+		State:       "register",
+		Full:        true,
+		PlayerCount: 1,
+	})
+
+	res := mustHTTPRequest(t, http.MethodGet, s.URL+"/lobby/unknown/status", "")
+	if got, want := res.StatusCode, http.StatusNotFound; got != want {
+		t.Errorf("Unexpected status code for unknown lobby: got %d, want %d", got, want)
+	}
+}
+
+func mustLobbyStatus(t *testing.T, url string, want api.LobbyStatusResponseData) {
+	t.Helper()
+
+	res := mustHTTPRequest(t, http.MethodGet, url, "")
+	if got, want := res.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Could not read lobby status: %v", err)
+	}
+	if strings.Contains(string(body), "secret") {
+		t.Errorf("Lobby status leaks the password: %s", body)
+	}
+
+	got := api.LobbyStatusResponseData{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("Could not decode lobby status: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected lobby status (-want+got):\n%v", diff)
+	}
+}
+
+func TestLobbyBanner(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers: 20,
+			Quizzes:    defaultTestLobbyOptions.Quizzes,
+		})
+		mw      = mws.NewLobby(lobbies)
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	_, cli, res := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+
+	apiRes, err := cli.ReadResponse()
+	if err != nil {
+		t.Fatalf("Could not read lobby banner: %v", err)
+	}
+
+	if apiRes.Type != api.ResponseTypeLobby {
+		t.Fatalf("Could not read lobby banner: got api response: %+v", res)
+	}
+
+	data, err := api.DecodeJSON[api.LobbyResponseData](apiRes.Data)
+	if err != nil {
+		t.Fatalf("Could not decode lobby data: %v", err)
+	}
+
+	want := defaultTestWantLobby
+
+	if got, want := data.Owner, want.Owner; !cmp.Equal(got, want) {
+		t.Errorf("Unexpected owner in lobby banner: got %v, want %v", got, want)
+	}
+	if got, want := data.MaxPlayers, want.MaxPlayers; got != want {
+		t.Errorf("Unexpected max players in lobby banner: got %d, want %d", got, want)
+	}
+	if len(data.ID) != 5 {
+		t.Errorf("Unexpected lobby id in lobby banner: %s", data.ID)
+	}
+	if data.Created == "" {
+		t.Error("Missing created field in lobby banner")
+	}
+	if diff := cmp.Diff(want.Quizzes, data.Quizzes); diff != "" {
+		t.Errorf("Unexpected quizzes list in lobby banner (-want+got):\n%v", diff)
+	}
+	if got, want := data.CurrentQuiz, want.CurrentQuiz; got != want {
+		t.Errorf("Unexpected current quiz in lobby banner: got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyOrigin(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:  defaultTestConfig,
+			Lobbies: lobbies,
+			AcceptOptions: websocket.AcceptOptions{
+				OriginPatterns: []string{"allowed.example"},
+			},
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	dial := func(origin string) (*client.Client, *http.Response, error) {
+		return client.Dial(context.Background(), url, &websocket.DialOptions{
+			HTTPHeader: http.Header{"Origin": []string{origin}},
+		})
+	}
+
+	_, res, err := dial("http://forbidden.example")
+	if err == nil {
+		t.Fatal("Dial from a forbidden origin succeeded")
+	}
+	if got, want := res.StatusCode, http.StatusForbidden; got != want {
+		t.Errorf("Unexpected status code: got %d, want %d", got, want)
+	}
+	apiErr := api.HTTPErrorData{}
+	if err := json.NewDecoder(res.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("Could not decode error response: %v", err)
+	}
+	if got, want := apiErr.Code, api.ForbiddenOriginHTTPCode; got != want {
+		t.Errorf("Unexpected error code: got %d, want %d", got, want)
+	}
+	if got, want := lobby.State(), quiz.LobbyStateCreated; got != want {
+		t.Errorf("Rejected dial changed the lobby state: got %s, want %s", got, want)
+	}
+
+	cli, _, err := dial("http://allowed.example")
+	if err != nil {
+		t.Fatalf("Dial from an allowed origin failed: %v", err)
+	}
+	t.Cleanup(cli.Close)
+	mustReadResponseType(t, cli, api.ResponseTypeLobby)
+}
+
+func TestLobbyRegister(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		mw             = mws.NewLobby(lobbies)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+
+	username := "testuser"
+	want := defaultTestWantLobby
+
+	mustRegisterOwner(t, cli, &want, username)
+
+	_, player, ok := lobby.GetPlayer(username)
+	if !ok || player == nil {
+		t.Fatalf("Could not get registered player")
+	}
+	if got, want := player.Username(), username; got != want {
+		t.Errorf("Invalid player username, got %s, want %s", got, want)
+	}
+
+	res, err := cli.Register(username)
+	if err != nil {
+		t.Fatalf("Error while sending register command: %v", err)
+	}
+	if res.Type != api.ResponseTypeError {
+		t.Fatalf("Unexpected api response: %+v", res)
+	}
+
+	data, err := api.DecodeJSON[api.ErrorData[api.WebsocketErrorCode]](res.Data)
+	if err != nil {
+		t.Fatalf("Error while decoding register response: %v", err)
+	}
+	if got, want := data.Code, api.PlayerAlreadyRegisteredCode; got != want {
+		t.Errorf("Invalid register error code, got %d, want %d", got, want)
+	}
+}
+
+func TestLobbyRegisterResponseJSON(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+	mustLobbyBanner(t, cli, defaultTestWantLobby)
+
+	mustWriteRequest(t, conn, api.RequestTypeRegister, json.RawMessage(`{"username":"owner"}`))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, got, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("Could not read register response: %v", err)
+	}
+	if want := `{"type":"register"}`; strings.TrimSpace(string(got)) != want {
+		t.Errorf("Unexpected register response: got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyTimeout(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies = quiz.NewLobbiesCache()
+		req     = httptest.NewRequest(http.MethodPost, "/lobby", nil)
+		res     = httptest.NewRecorder()
+	)
+
+	cfg := defaultTestConfig
+	cfg.Lobby.RegisterTimeout = time.Nanosecond
+
+	handlers.CreateLobbyHandler(cfg, lobbies, defaultTestQuizStore)(res, req)
+
+	apiRes := &api.CreateLobbyResponseData{}
+	if err := json.NewDecoder(res.Body).Decode(apiRes); err != nil {
+		t.Fatalf("Could not decode create lobby response: %v", err)
+	}
+
+	// wait for the goroutine to process the delete
+	time.Sleep(time.Millisecond)
+
+	if lobby, ok := lobbies.Get(apiRes.LobbyID); ok || lobby != nil {
+		t.Error("Lobby was not deleted after timeout")
+	}
+}
+
+func TestLobbyPlayerList(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		mw             = mws.NewLobby(lobbies)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
 
 	// Setup lobby owner
 	owner := "owner"
-	wantLobby := defaultTestWantLobby
-	mustRegisterOwner(t, cli, &wantLobby, owner)
+	want := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &want, owner)
 
-	// Setup second player to join
-	player := "player"
-	cli2, _ := mustDialTestServer(t, s, path)
+	players := map[string]*client.Client{
+		"testuser":  nil,
+		"testuser2": nil,
+		"testuser3": nil,
+	}
+
+	for username := range players {
+		cli2, _ := mustDialTestServer(t, s, path)
+		players[username] = cli2
+
+		mustRegisterPlayer(t, cli2, &want, username)
+		mustBroadcastPlayerUpdate(t, cli, username, "join")
+
+		want.PlayerList = append(want.PlayerList, username)
+	}
+
+	// Make sure new players are now in the list.
+	mustLobby(t, cli, want)
+
+	for username, cli2 := range players {
+		cli2.Close()
+		<-time.After(time.Millisecond)
+		mustBroadcastPlayerUpdate(t, cli, username, "disconnect")
+
+		// Make sure disconnected player is not on the list.
+		want.PlayerList = slices.DeleteFunc(want.PlayerList, func(s string) bool {
+			return s == username
+		})
+		mustLobby(t, cli, want)
+	}
+}
+
+func TestLobbyPlayerListSnapshot(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		mw             = mws.NewLobby(lobbies)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	cli2, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli2, &wantLobby, "player2")
+
+	cli3, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli3, &wantLobby, "player3")
+
+	cli3.Close()
+
+	wantSnapshots := [][]string{
+		{"owner", "player2"},
+		{"owner", "player2", "player3"},
+		{"owner", "player2"},
+	}
+	for _, want := range wantSnapshots {
+		res := mustReadResponseType(t, cli, api.ResponseTypePlayerList)
+
+		data, err := api.DecodeJSON[api.PlayerListResponseData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode player list broadcast: %v", err)
+		}
+		if diff := cmp.Diff(want, data.PlayerList); diff != "" {
+			t.Errorf("Unexpected player list snapshot (-want+got):\n%v", diff)
+		}
+		for _, username := range want {
+			if _, ok := data.Scores[username]; !ok {
+				t.Errorf("Missing score of %s in player list snapshot", username)
+			}
+		}
+	}
+
+	if diff := cmp.Diff(wantSnapshots[len(wantSnapshots)-1], lobby.GetPlayerList()); diff != "" {
+		t.Errorf("Snapshot does not match lobby player list (-want+got):\n%v", diff)
+	}
+}
+
+func TestLobbyMaxPlayers(t *testing.T) {
+	t.Parallel()
+
+	var (
+		maxPlayers     = 1
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers: maxPlayers,
+			Quizzes:    defaultTestLobbyOptions.Quizzes,
+		})
+	)
+
+	cfg := defaultTestConfig
+	cfg.Lobby.MaxPlayers = maxPlayers
+
+	mw := mws.NewLobby(lobbies)
+	handler := handlers.LobbyHandler{
+		Config:        cfg,
+		Lobbies:       lobbies,
+		AcceptOptions: defaultTestAcceptOptions,
+	}
+	path := "/lobby/" + lobby.ID()
+	s, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+
+	// Setup lobby owner
+	want := defaultTestWantLobby
+	want.MaxPlayers = maxPlayers
+	mustRegisterOwner(t, cli, &want, "owner")
+
+	// Make sure no players can join and be upgraded to websocket.
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	cli, res, err := client.Dial(context.Background(), url, nil)
+	if cli != nil {
+		cli.Close()
+	}
+	if err == nil {
+		t.Errorf("Player was able to join a full lobby, response %+v", res)
+	}
+	if res == nil || res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected response for a full lobby: %+v", res)
+	}
+}
+
+func TestLobbyOwnerElection(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		mw             = mws.NewLobby(lobbies)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+
+	// Setup lobby owner
+	owner := "owner"
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, owner)
+
+	// Setup second player to join
+	cli2, _ := mustDialTestServer(t, s, path)
+
+	nextPlayer := "nextplayer"
+	mustRegisterPlayer(t, cli2, &wantLobby, nextPlayer)
+
+	// Close owner client, must be replaced by next player.
+	cli.Close()
+	mustBroadcastPlayerUpdate(t, cli2, owner, "disconnect")
+	mustBroadcastPlayerUpdate(t, cli2, nextPlayer, "new owner")
+	if got, want := lobby.Owner(), nextPlayer; got != want {
+		t.Errorf("Invalid lobby owner, got %s, want %s", got, want)
+	}
+
+	// Close new owner client, no other players so lobby must be deleted.
+	cli2.Close()
+	<-time.After(time.Millisecond)
+
+	if lobby, ok := lobbies.Get(lobby.ID()); ok || lobby != nil {
+		t.Error("Lobby was not deleted after owner disconnect")
+	}
+}
+
+func TestLobbyOwnerElectionJoinOrder(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		mw             = mws.NewLobby(lobbies)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+
+	owner := "owner"
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, owner)
+
+	// Second player sorts after the third one alphabetically.
+	second, third := "zed", "alice"
+
+	cli2, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli2, &wantLobby, second)
+
+	cli3, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli3, &wantLobby, third)
+	mustBroadcastPlayerUpdate(t, cli2, third, "join")
+
+	// Close owner client, must be replaced by the second joined player.
+	cli.Close()
+	mustBroadcastPlayerUpdate(t, cli2, owner, "disconnect")
+	mustBroadcastPlayerUpdate(t, cli2, second, "new owner")
+	if got, want := lobby.Owner(), second; got != want {
+		t.Errorf("Invalid lobby owner, got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyOwnerToken(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	token, err := lobby.NewOwnerToken()
+	if err != nil {
+		t.Fatalf("Could not issue owner token: %v", err)
+	}
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.Subprotocols, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	// The first registrant is not granted the reserved ownership.
+	cli, _ := mustDialTestServer(t, s, path)
+	wantLobby := defaultTestWantLobby
+	mustRegisterPlayer(t, cli, &wantLobby, "thief")
+
+	if owner := lobby.Owner(); owner != "" {
+		t.Fatalf("Ownership was stolen by %s", owner)
+	}
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	cli2, _, err := client.DialWithToken(context.Background(), url, token)
+	if err != nil {
+		t.Fatalf("Could not dial with owner token: %v", err)
+	}
+	t.Cleanup(cli2.Close)
+
+	mustRegisterOwner(t, cli2, &wantLobby, "creator")
+
+	if got, want := lobby.Owner(), "creator"; got != want {
+		t.Errorf("Unexpected lobby owner: got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyOwnerClaimOnConnect(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	token, err := lobby.NewOwnerToken()
+	if err != nil {
+		t.Fatalf("Could not issue owner token: %v", err)
+	}
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.Subprotocols, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	dial := func() (*client.Client, api.LobbyResponseData) {
+		cli, _, err := client.DialWithToken(context.Background(), url, token)
+		if err != nil {
+			t.Fatalf("Could not dial with owner token: %v", err)
+		}
+		t.Cleanup(cli.Close)
+
+		res := mustReadResponseType(t, cli, api.ResponseTypeLobby)
+		banner := api.LobbyResponseData{}
+		if err := json.Unmarshal(res.Data, &banner); err != nil {
+			t.Fatalf("Could not decode lobby banner: %v", err)
+		}
+		return cli, banner
+	}
+
+	// The creator is recognized as soon as it connects.
+	creator, banner := dial()
+	if !banner.OwnerClaimed {
+		t.Error("Owner token holder was not recognized on connect")
+	}
+
+	// Another holder of the token registering first does not race the creator.
+	thief, banner := dial()
+	if banner.OwnerClaimed {
+		t.Error("Ownership was claimed twice")
+	}
+	if res, err := thief.Register("thief"); err != nil || res.Type != api.ResponseTypeRegister {
+		t.Fatalf("Could not register thief: %+v, %v", res, err)
+	}
+	if owner := lobby.Owner(); owner != "" {
+		t.Fatalf("Ownership was stolen by %s", owner)
+	}
+
+	mustBroadcastPlayerUpdate(t, creator, "thief", "join")
+	if res, err := creator.Register("creator"); err != nil || res.Type != api.ResponseTypeRegister {
+		t.Fatalf("Could not register creator: %+v, %v", res, err)
+	}
+	if got, want := lobby.Owner(), "creator"; got != want {
+		t.Errorf("Unexpected lobby owner: got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyKick(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		mw             = mws.NewLobby(lobbies)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+
+	// Setup lobby owner
+	owner := "owner"
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, owner)
+
+	// Setup second player to join
+	player := "player"
+	cli2, _ := mustDialTestServer(t, s, path)
+
+	mustRegisterPlayer(t, cli2, &wantLobby, player)
+	mustBroadcastPlayerUpdate(t, cli, player, "join")
+
+	// Player is not owner, kick must not be possible.
+	res, err := cli2.Kick(owner)
+	if err != nil {
+		t.Fatalf("Unexpected error while trying to kick %s: %v", owner, err)
+	}
+	if got, want := res.Type, api.ResponseTypeError; got != want {
+		t.Errorf("Invalid kick command response, got %s, want %s, response %+v", got, want, res)
+	}
+
+	res, err = cli.Kick(player)
+	if err != nil {
+		t.Fatalf("Unexpected error while trying to kick %s: %v", player, err)
+	}
+	if got, want := res.Type, api.ResponseTypeKick; got != want {
+		t.Errorf("Invalid kick command response, got %s, want %s, response %+v", got, want, res)
+	}
+
+	mustBroadcastPlayerUpdate(t, cli, player, "kick")
+
+	// The owner cannot kick itself and stays owner.
+	res, err = cli.Kick(owner)
+	if err != nil {
+		t.Fatalf("Unexpected error while trying to kick %s: %v", owner, err)
+	}
+	if got, want := res.Type, api.ResponseTypeError; got != want {
+		t.Errorf("Invalid self kick response, got %s, want %s, response %+v", got, want, res)
+	}
+	if got := lobby.Owner(); got != owner {
+		t.Errorf("Owner changed after self kick: got %s, want %s", got, owner)
+	}
+	if _, _, ok := lobby.GetPlayer(owner); !ok {
+		t.Error("Owner was removed by self kick")
+	}
+}
+
+func TestLobbyKickBan(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	cli2, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli2, &wantLobby, "player")
+
+	mustWriteRequest(t, conn, api.RequestTypeKick, json.RawMessage(`{"username":"player","reason":"spam","ban":true}`))
+	mustReadResponseType(t, cli, api.ResponseTypeKick)
+
+	// The kicked player is told why before being disconnected.
+	res := mustReadResponseType(t, cli2, api.ResponseTypeKicked)
+	kicked, err := api.DecodeJSON[api.KickedResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode kicked response: %v", err)
+	}
+	if diff := cmp.Diff(api.KickedResponseData{Reason: "spam", Banned: true}, kicked); diff != "" {
+		t.Errorf("Unexpected kicked response: (-want +got):\n%s", diff)
+	}
+
+	for {
+		res := mustReadResponseType(t, cli, api.ResponseTypePlayerUpdate)
+		update, err := api.DecodeJSON[api.PlayerUpdateResponseData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode player update broadcast: %v", err)
+		}
+		if update.Action != "kick" {
+			continue
+		}
+		if got, want := update.Reason, "spam"; got != want {
+			t.Errorf("Unexpected kick reason: got %q, want %q", got, want)
+		}
+		break
+	}
+
+	// The banned username cannot register again.
+	cli3, _ := mustDialTestServer(t, s, path)
+	mustReadResponseType(t, cli3, api.ResponseTypeLobby)
+
+	res, err = cli3.Register("player")
+	if err != nil {
+		t.Fatalf("Could not send register request: %v", err)
+	}
+	if res.Type != api.ResponseTypeError {
+		t.Fatalf("Banned username registered: %+v", res)
+	}
+	apiErr, err := api.DecodeJSON[api.WebsocketErrorData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode register error: %v", err)
+	}
+	if got, want := apiErr.Code, api.UsernameBannedCode; got != want {
+		t.Errorf("Unexpected register error code: got %d, want %d", got, want)
+	}
+}
+
+func TestLobbyConfigure(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		mw             = mws.NewLobby(lobbies)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+
+	// Setup lobby owner
+	owner := "owner"
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, owner)
+
+	res, err := cli.Configure(wantLobby.Quizzes[1])
+	if err != nil {
+		t.Fatalf("Error while sending configure command: %v", err)
+	}
+	if got, want := res.Type, api.ResponseTypeConfigure; got != want {
+		t.Errorf("Invalid configure response type: got %s, want %s", got, want)
+	}
+
+	mustBroadcastConfigure(t, cli, wantLobby.Quizzes[1])
+
+	if got, want := lobby.Quiz().Name, wantLobby.Quizzes[1]; got != want {
+		t.Errorf("Invalid configured quiz in lobby: got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyConfigureRandomQuiz(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)), path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	if _, err := cli.Configure(api.RandomQuiz); err != nil {
+		t.Fatalf("Error while sending configure command: %v", err)
+	}
+
+	res := mustReadResponseType(t, cli, api.ResponseTypeConfigure)
+	data, err := api.DecodeJSON[api.LobbyUpdateResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode configure broadcast: %v", err)
+	}
+	if !slices.Contains(wantLobby.Quizzes, data.Quiz) {
+		t.Fatalf("Broadcasted random quiz %q is not a lobby quiz", data.Quiz)
+	}
+	if got := lobby.Quiz().Name; got != data.Quiz {
+		t.Errorf("Lobby quiz is not the broadcasted one: got %q, want %q", got, data.Quiz)
+	}
+}
+
+func TestLobbyConfigurePreview(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)), path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	if _, err := cli.Configure("cars"); err != nil {
+		t.Fatalf("Error while sending configure command: %v", err)
+	}
+
+	res := mustReadResponseType(t, cli, api.ResponseTypeConfigure)
+	data, err := api.DecodeJSON[api.LobbyUpdateResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode configure broadcast: %v", err)
+	}
+	if got, want := data.QuestionCount, len(defaultTestLobbyOptions.Quizzes["cars"].Questions); got != want || got == 0 {
+		t.Errorf("Unexpected question count: got %d, want %d", got, want)
+	}
+	if data.EstimatedDuration <= 0 {
+		t.Errorf("Unexpected estimated duration: %s", data.EstimatedDuration)
+	}
+}
+
+func TestLobbyConfigureMaxPlayers(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers: 2,
+			Quizzes:    defaultTestLobbyOptions.Quizzes,
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	wantLobby.MaxPlayers = 2
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	cli2, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli2, &wantLobby, "player2")
+
+	if !lobby.IsFull() {
+		t.Fatal("Lobby not full before raising the maximum players")
+	}
+
+	mustWriteRequest(t, conn, api.RequestTypeConfigure, json.RawMessage(`{"maxPlayers":5}`))
+	mustReadResponseType(t, cli, api.ResponseTypeConfigure)
+
+	res := mustReadResponseType(t, cli, api.ResponseTypeConfigure)
+	update, err := api.DecodeJSON[api.LobbyUpdateResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode configure broadcast: %v", err)
+	}
+	if diff := cmp.Diff(api.LobbyUpdateResponseData{MaxPlayers: 5}, update); diff != "" {
+		t.Errorf("Unexpected configure broadcast: (-want +got):\n%s", diff)
+	}
+	if got, want := lobby.MaxPlayers(), 5; got != want {
+		t.Errorf("Unexpected maximum players: got %d, want %d", got, want)
+	}
+
+	tests := []struct {
+		name       string
+		maxPlayers int
+	}{
+		{"Below players in lobby", 1},
+		{"Over configured maximum", defaultTestConfig.Lobby.MaxPlayers + 1},
+	}
+
+	for _, tt := range tests {
+		data := fmt.Sprintf(`{"maxPlayers":%d}`, tt.maxPlayers)
+		mustWriteRequest(t, conn, api.RequestTypeConfigure, json.RawMessage(data))
+
+		res := mustReadResponseType(t, cli, api.ResponseTypeError)
+		apiErr, err := api.DecodeJSON[api.WebsocketErrorData](res.Data)
+		if err != nil {
+			t.Fatalf("%s: could not decode configure error: %v", tt.name, err)
+		}
+		if got, want := apiErr.Code, api.InvalidInputCode; got != want {
+			t.Errorf("%s: unexpected configure error code: got %d, want %d", tt.name, got, want)
+		}
+		if got, want := lobby.MaxPlayers(), 5; got != want {
+			t.Errorf("%s: maximum players changed: got %d, want %d", tt.name, got, want)
+		}
+	}
+}
+
+func TestLobbyJoinTrimmedID(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		middlewares    = []mws.Middleware{mws.Subprotocols, mws.NewLobby(lobbies)}
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, middlewares...))
+	defer s.Close()
+
+	// A code pasted with surrounding spaces still joins the lobby.
+	cli, res := mustDialTestServer(t, s, "/lobby/%20"+lobby.ID()+"%20%09")
+	if got, want := res.StatusCode, http.StatusSwitchingProtocols; got != want {
+		t.Errorf("Unexpected status code during ws handshake: got %d, want %d", got, want)
+	}
+
+	lobbyRes := mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	data := api.LobbyResponseData{}
+	if err := json.Unmarshal(lobbyRes.Data, &data); err != nil {
+		t.Fatalf("Could not decode lobby response: %v", err)
+	}
+	if got, want := data.ID, lobby.ID(); got != want {
+		t.Errorf("Unexpected lobby joined: got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyPassword(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			Quizzes:  defaultTestLobbyOptions.Quizzes,
+			Password: "1234",
+		})
+		middlewares = []mws.Middleware{mws.Subprotocols, mws.NewLobby(lobbies)}
+		handler     = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, middlewares...))
+	defer s.Close()
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	cli, res, err := client.Dial(context.Background(), url, nil)
+	if cli != nil {
+		cli.Close()
+	}
+	if err == nil {
+		t.Fatalf("Player was able to join a password protected lobby")
+	}
+	if got, want := res.StatusCode, http.StatusUnauthorized; got != want {
+		t.Errorf("Unexpected status code during ws handshake: got %d, want %d", got, want)
+	}
+
+	url += "?p=1234"
+	cli, res, err = client.Dial(context.Background(), url, nil)
+	if cli != nil {
+		cli.Close()
+	}
+	if err != nil {
+		t.Fatalf("Player was not able to join lobby with password: %v", err)
+	}
+	if got, want := res.StatusCode, http.StatusSwitchingProtocols; got != want {
+		t.Errorf("Unexpected status code during ws handshake: got %d, want %d", got, want)
+	}
+}
+
+func TestLobbyClearPassword(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	dial := func() (*http.Response, error) {
+		cli, res, err := client.Dial(context.Background(), url, nil)
+		if cli != nil {
+			cli.Close()
+		}
+		return res, err
+	}
+
+	mustWriteRequest(t, conn, api.RequestTypeConfigure, json.RawMessage(`{"password":"secret"}`))
+	mustReadResponseType(t, cli, api.ResponseTypeConfigure)
+
+	// Other players are told a password is now required, not which one.
+	broadcast := mustReadResponseType(t, cli, api.ResponseTypeConfigure)
+	if strings.Contains(string(broadcast.Data), "secret") {
+		t.Errorf("Configure broadcast leaks the password: %s", broadcast.Data)
+	}
+	update, err := api.DecodeJSON[api.LobbyUpdateResponseData](broadcast.Data)
+	if err != nil {
+		t.Fatalf("Could not decode configure broadcast: %v", err)
+	}
+	if update.PasswordRequired == nil || !*update.PasswordRequired {
+		t.Errorf("Configure broadcast does not require a password: %s", broadcast.Data)
+	}
+
+	res, err := dial()
+	if err == nil {
+		t.Fatal("Player was able to join a password protected lobby")
+	}
+	if got, want := res.StatusCode, http.StatusUnauthorized; got != want {
+		t.Errorf("Unexpected status code during ws handshake: got %d, want %d", got, want)
+	}
+
+	// A password cannot be both set and cleared.
+	mustWriteRequest(t, conn, api.RequestTypeConfigure, json.RawMessage(`{"password":"other","clearPassword":true}`))
+	mustReadResponseType(t, cli, api.ResponseTypeError)
+	if !lobby.CheckPassword("secret") {
+		t.Error("Password changed by an invalid configure request")
+	}
+
+	mustWriteRequest(t, conn, api.RequestTypeConfigure, json.RawMessage(`{"clearPassword":true}`))
+	mustReadResponseType(t, cli, api.ResponseTypeConfigure)
+
+	broadcast = mustReadResponseType(t, cli, api.ResponseTypeConfigure)
+	if update, err = api.DecodeJSON[api.LobbyUpdateResponseData](broadcast.Data); err != nil {
+		t.Fatalf("Could not decode configure broadcast: %v", err)
+	}
+	if update.PasswordRequired == nil || *update.PasswordRequired {
+		t.Errorf("Configure broadcast still requires a password: %s", broadcast.Data)
+	}
+
+	if _, err := dial(); err != nil {
+		t.Fatalf("Player was not able to join lobby after clearing its password: %v", err)
+	}
+	if lobby.HasPassword() {
+		t.Error("Lobby still has a password after clearing it")
+	}
+}
+
+func mustRegisterLobby(t *testing.T, opts quiz.LobbyOptions) (quiz.LobbyRepository, *quiz.Lobby) {
+	t.Helper()
+
+	lobbies := quiz.NewLobbiesCache()
+	lobby, err := lobbies.Register(opts)
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+
+	// Stop any running quiz and timeout goroutines.
+	t.Cleanup(func() {
+		lobbies.Delete(lobby.ID())
+	})
+
+	return lobbies, lobby
+}
+
+func mustLobby(t *testing.T, cli *client.Client, want api.LobbyResponseData) {
+	t.Helper()
+
+	res, err := cli.Lobby()
+	if err != nil {
+		t.Fatalf("Error while sending lobby command: %v", err)
+	}
+	if res.Type != api.ResponseTypeLobby {
+		t.Fatalf("Could not read lobby response: got api response: %+v", res)
+	}
+
+	mustDecodeLobbyData(t, res, want)
+}
+
+func mustLobbyBanner(t *testing.T, cli *client.Client, want api.LobbyResponseData) {
+	t.Helper()
+
+	res, err := cli.ReadResponse()
+	if err != nil {
+		t.Fatalf("Could not read lobby banner: %v", err)
+	}
+	if res.Type != api.ResponseTypeLobby {
+		t.Fatalf("Could not read lobby banner: got api response: %+v", res)
+	}
+
+	mustDecodeLobbyData(t, res, want)
+}
+
+func mustDecodeLobbyData(t *testing.T, res api.Response[json.RawMessage], want api.LobbyResponseData) {
+	t.Helper()
+
+	data, err := api.DecodeJSON[api.LobbyResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode lobby data: %v", data)
+	}
+	if got, want := data.Owner, want.Owner; !cmp.Equal(got, want) {
+		t.Fatalf("Unexpected owner in lobby banner: got %v, want %v", got, want)
+	}
+	if got, want := data.MaxPlayers, want.MaxPlayers; got != want {
+		t.Fatalf("Unexpected max players in lobby banner: got %d, want %d", got, want)
+	}
+	if len(data.ID) != 5 {
+		t.Fatalf("Unexpected lobby id in lobby banner: %s", data.ID)
+	}
+	if data.Created == "" {
+		t.Fatal("Missing created field in lobby banner")
+	}
+	if diff := cmp.Diff(want.Quizzes, data.Quizzes); diff != "" {
+		t.Fatalf("Unexpected quizzes list in lobby banner (-want+got):\n%v", diff)
+	}
+	if got, want := data.CurrentQuiz, want.CurrentQuiz; got != want {
+		t.Fatalf("Unexpected current quiz in lobby banner: got %s, want %s", got, want)
+	}
+}
+
+func mustRegisterPlayer(t *testing.T, cli *client.Client, wantLobby *api.LobbyResponseData, username string) {
+	t.Helper()
+
+	mustLobbyBanner(t, cli, *wantLobby)
+	mustRegister(t, cli, username)
+	mustBroadcastPlayerUpdate(t, cli, username, "join")
+
+	wantLobby.PlayerList = append(wantLobby.PlayerList, username)
+}
+
+func mustRegisterOwner(t *testing.T, cli *client.Client, wantLobby *api.LobbyResponseData, username string) {
+	t.Helper()
+
+	mustRegisterPlayer(t, cli, wantLobby, username)
+	mustBroadcastPlayerUpdate(t, cli, username, "new owner")
+
+	wantLobby.Owner = &username
+}
+
+func mustRegister(t *testing.T, cli *client.Client, username string) {
+	t.Helper()
+
+	res, err := cli.Register(username)
+	if err != nil {
+		t.Fatalf("Could not register username: %v", err)
+	}
+	if res.Type != api.ResponseTypeRegister {
+		t.Fatalf("Could not register username: got api response: %+v", res)
+	}
+}
+
+// mustBroadcastPlayerUpdate reads the next player update broadcast,
+// skipping the player list snapshot sent before each roster change.
+func mustBroadcastPlayerUpdate(t *testing.T, cli *client.Client, username, action string) {
+	t.Helper()
+
+	res, err := cli.ReadResponse()
+	if err == nil && res.Type == api.ResponseTypePlayerList {
+		res, err = cli.ReadResponse()
+	}
+	if err != nil {
+		t.Fatalf("Could not read lobby update broadcast: %v", err)
+	}
+	if res.Type != api.ResponseTypePlayerUpdate {
+		t.Fatalf("Could not read lobby update broadcast: got api response: %+v", res)
+	}
+
+	data, err := api.DecodeJSON[api.PlayerUpdateResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode lobby update broadcast data: %v", data)
+	}
+	if username != data.Username {
+		t.Fatalf("Unexpected username returned in lobby update broadcast: %s", data.Username)
+	}
+	if action != data.Action {
+		t.Fatalf("Unexpected action returned in lobby update broadcast: %s", data.Action)
+	}
+}
+
+func mustBroadcastConfigure(t *testing.T, cli *client.Client, quiz string) {
+	t.Helper()
+
+	res, err := cli.ReadResponse()
+	if err != nil {
+		t.Fatalf("Could not read configure broadcast: %v", err)
+	}
+	if res.Type != api.ResponseTypeConfigure {
+		t.Fatalf("Could not read configure broadcast: got api response: %+v", res)
+	}
+
+	data, err := api.DecodeJSON[api.LobbyUpdateResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode configure broadcast data: %v", data)
+	}
+	if quiz != data.Quiz {
+		t.Fatalf("Unexpected quiz returned in configure broadcast: %s", data.Quiz)
+	}
+}
+
+var defaultTestAdminToken = []byte("myadmintoken1234")
+
+func newTestAdminServer(t *testing.T, lobbies quiz.LobbyRepository) *httptest.Server {
+	t.Helper()
+
+	mw := mws.NewAdmin(defaultTestAdminToken)
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/lobbies", mws.Chain(handlers.AdminLobbiesHandler(lobbies), mw))
+	mux.Handle("GET /admin/lobbies/{id}", mws.Chain(handlers.AdminLobbyHandler(lobbies), mw))
+	mux.Handle("DELETE /admin/lobbies/{id}", mws.Chain(handlers.AdminDeleteLobbyHandler(lobbies), mw))
+
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func mustHTTPRequest(t *testing.T, method, url, token string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), method, url, nil)
+	if err != nil {
+		t.Fatalf("Could not create http request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Could not send http request: %v", err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+
+	return res
+}
+
+func TestAdminUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	lobbies, lobby := mustRegisterLobby(t, defaultTestLobbyOptions)
+	s := newTestAdminServer(t, lobbies)
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+	}{
+		{name: "List without token", path: "/admin/lobbies"},
+		{name: "List with invalid token", path: "/admin/lobbies", token: "invalid"},
+		{name: "Detail without token", path: "/admin/lobbies/" + lobby.ID()},
+		{name: "Detail with invalid token", path: "/admin/lobbies/" + lobby.ID(), token: "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := mustHTTPRequest(t, http.MethodGet, s.URL+tt.path, tt.token)
+			if got, want := res.StatusCode, http.StatusUnauthorized; got != want {
+				t.Errorf("Unexpected status code: got %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestAdminLobbies(t *testing.T) {
+	t.Parallel()
+
+	lobbies, lobby := mustRegisterLobby(t, defaultTestLobbyOptions)
+	s := newTestAdminServer(t, lobbies)
+
+	res := mustHTTPRequest(t, http.MethodGet, s.URL+"/admin/lobbies", string(defaultTestAdminToken))
+	if got, want := res.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+
+	data := api.AdminLobbiesResponseData{}
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		t.Fatalf("Could not decode admin lobbies response: %v", err)
+	}
+	if got, want := len(data.Lobbies), 1; got != want {
+		t.Fatalf("Unexpected number of lobbies: got %d, want %d", got, want)
+	}
+
+	got := data.Lobbies[0]
+	if got.ID != lobby.ID() {
+		t.Errorf("Unexpected lobby id: got %s, want %s", got.ID, lobby.ID())
+	}
+	if got.State != quiz.LobbyStateCreated.String() {
+		t.Errorf("Unexpected lobby state: got %s, want %s", got.State, quiz.LobbyStateCreated)
+	}
+	if got.CurrentQuiz != defaultTestWantLobby.CurrentQuiz {
+		t.Errorf("Unexpected current quiz: got %s, want %s", got.CurrentQuiz, defaultTestWantLobby.CurrentQuiz)
+	}
+	if got.Created == "" {
+		t.Error("Missing created field in admin lobby")
+	}
+	if got.Players != nil {
+		t.Errorf("Unexpected players details in lobbies list: %+v", got.Players)
+	}
+}
+
+func TestAdminLobby(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)), path)
+
+	owner := "owner"
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, owner)
+
+	s := newTestAdminServer(t, lobbies)
+
+	res := mustHTTPRequest(t, http.MethodGet, s.URL+"/admin/lobbies/"+lobby.ID(), string(defaultTestAdminToken))
+	if got, want := res.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+
+	data := api.AdminLobbyResponseData{}
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		t.Fatalf("Could not decode admin lobby response: %v", err)
+	}
+	if got, want := data.Owner, owner; got != want {
+		t.Errorf("Unexpected lobby owner: got %s, want %s", got, want)
+	}
+	if got, want := data.NumPlayers, 1; got != want {
+		t.Errorf("Unexpected number of players: got %d, want %d", got, want)
+	}
+	want := []api.AdminPlayerDetails{{Username: owner, Alive: true}}
+	if len(data.Players) != 1 || data.Players[0] != want[0] {
+		t.Errorf("Unexpected players details: got %+v, want %+v", data.Players, want)
+	}
+
+	res = mustHTTPRequest(t, http.MethodGet, s.URL+"/admin/lobbies/unknown", string(defaultTestAdminToken))
+	if got, want := res.StatusCode, http.StatusNotFound; got != want {
+		t.Errorf("Unexpected status code for unknown lobby: got %d, want %d", got, want)
+	}
+}
+
+func TestAdminDeleteLobby(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)), path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	s := newTestAdminServer(t, lobbies)
+	url := s.URL + "/admin/lobbies/" + lobby.ID()
+
+	res := mustHTTPRequest(t, http.MethodDelete, url, "")
+	if got, want := res.StatusCode, http.StatusUnauthorized; got != want {
+		t.Errorf("Unexpected status code without token: got %d, want %d", got, want)
+	}
+
+	// Keep reading so the close handshake is not blocked.
+	types := make(chan api.ResponseType, 1)
+	go func() {
+		defer close(types)
+		for {
+			res, err := cli.ReadResponse()
+			if err != nil {
+				return
+			}
+			types <- res.Type
+		}
+	}()
+
+	res = mustHTTPRequest(t, http.MethodDelete, url, string(defaultTestAdminToken))
+	if got, want := res.StatusCode, http.StatusNoContent; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+
+	if got, want := <-types, api.ResponseTypeLobbyClosed; got != want {
+		t.Fatalf("Unexpected broadcast type: got %s, want %s", got, want)
+	}
+	if _, ok := <-types; ok {
+		t.Error("Client conn was not closed after lobby deletion")
+	}
+
+	select {
+	case <-lobby.Done():
+	default:
+		t.Error("Lobby was not closed after deletion")
+	}
+	if _, ok := lobbies.Get(lobby.ID()); ok {
+		t.Error("Lobby was not deleted")
+	}
+
+	res = mustHTTPRequest(t, http.MethodDelete, url, string(defaultTestAdminToken))
+	if got, want := res.StatusCode, http.StatusNotFound; got != want {
+		t.Errorf("Unexpected status code for deleted lobby: got %d, want %d", got, want)
+	}
+}
+
+func TestMediaHandler(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer("GET /media/{quiz}/{file...}", handlers.MediaHandler(defaultTestQuizzesFS))
+	t.Cleanup(s.Close)
+
+	res := mustHTTPRequest(t, http.MethodGet, s.URL+"/media/cars/image.png", "")
+	if got, want := res.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+	if got, want := res.Header.Get("Content-Type"), "image/png"; got != want {
+		t.Errorf("Unexpected content type: got %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name string
+		quiz string
+		file string
+	}{
+		{name: "Traversal in file", quiz: "cars", file: "../questions.yml"},
+		{name: "Traversal in quiz", quiz: "..", file: "cars/questions.yml"},
+		{name: "Questions file", quiz: "cars", file: "questions.yml"},
+		{name: "Unknown file", quiz: "cars", file: "unknown.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/media/", nil)
+			req.SetPathValue("quiz", tt.quiz)
+			req.SetPathValue("file", tt.file)
+			rec := httptest.NewRecorder()
+
+			handlers.MediaHandler(defaultTestQuizzesFS)(rec, req)
+
+			if got, want := rec.Code, http.StatusNotFound; got != want {
+				t.Errorf("Unexpected status code: got %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestLobbyQuestionSanitized(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	questions := 0
+	for questions < len(lobby.Quiz().Questions) {
+		res, err := cli.ReadResponse()
+		if err != nil {
+			t.Fatalf("Could not read quiz broadcast: %v", err)
+		}
+		if res.Type != api.ResponseTypeQuestion {
+			continue
+		}
+		questions++
+
+		if strings.Contains(string(res.Data), `"answer"`) {
+			t.Errorf("Question broadcast contains an answer: %s", res.Data)
+		}
+	}
+}
+
+func TestLobbyWrongState(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	// Joins before the quiz without registering.
+	lateConn, lateCli := mustDialRawTestServer(t, s, path)
+
+	mustReadError := func(t *testing.T, cli *client.Client) api.WebsocketErrorData {
+		t.Helper()
+
+		res := mustReadResponseType(t, cli, api.ResponseTypeError)
+		apiErr, err := api.DecodeJSON[api.WebsocketErrorData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode error response: %v", err)
+		}
+		return apiErr
+	}
+
+	// An answer is only allowed during the quiz.
+	mustWriteRequest(t, conn, api.RequestTypeAnswer, json.RawMessage(`{"questionId":0,"answer":{"text":"Porsche"}}`))
+	apiErr := mustReadError(t, cli)
+	if got, want := apiErr.Code, api.WrongLobbyStateCode; got != want {
+		t.Errorf("Unexpected error code for answer while registering: got %d, want %d", got, want)
+	}
+	if got, want := apiErr.Request, api.RequestTypeAnswer; got != want {
+		t.Errorf("Unexpected error request: got %s, want %s", got, want)
+	}
+	if got, want := apiErr.Message, "answer is not allowed in state register"; got != want {
+		t.Errorf("Unexpected error message: got %q, want %q", got, want)
+	}
+
+	// Unknown requests are still reported as such.
+	mustWriteRequest(t, conn, "dance", json.RawMessage("{}"))
+	if got, want := mustReadError(t, cli).Code, api.InvalidRequestCode; got != want {
+		t.Errorf("Unexpected error code for unknown request: got %d, want %d", got, want)
+	}
+
+	// Registering is only allowed before the quiz starts.
+	lobby.SetState(quiz.LobbyStateQuiz)
+	mustWriteRequest(t, lateConn, api.RequestTypeRegister, json.RawMessage(`{"username":"late"}`))
+	apiErr = mustReadError(t, lateCli)
+	if got, want := apiErr.Code, api.WrongLobbyStateCode; got != want {
+		t.Errorf("Unexpected error code for register during quiz: got %d, want %d", got, want)
+	}
+	if got, want := apiErr.Message, "register is not allowed in state quiz"; got != want {
+		t.Errorf("Unexpected error message: got %q, want %q", got, want)
+	}
+	if _, _, ok := lobby.GetPlayer("late"); ok {
+		t.Error("Player registered during the quiz")
+	}
+}
+
+func TestLobbyReRegisterAcrossStates(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	for _, state := range []quiz.LobbyState{quiz.LobbyStateRegister, quiz.LobbyStateQuiz, quiz.LobbyStateAnswers} {
+		lobby.SetState(state)
+		mustWriteRequest(t, conn, api.RequestTypeRegister, json.RawMessage(`{"username":"other"}`))
+
+		res := mustReadResponseType(t, cli, api.ResponseTypeError)
+		apiErr, err := api.DecodeJSON[api.WebsocketErrorData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode error response: %v", err)
+		}
+		if got, want := apiErr.Code, api.PlayerAlreadyRegisteredCode; got != want {
+			t.Errorf("Unexpected re-register error code in state %s: got %d, want %d", state, got, want)
+		}
+	}
+	if _, _, ok := lobby.GetPlayer("other"); ok {
+		t.Error("Registered conn registered a second player")
+	}
+}
+
+func TestLobbyUnregisteredCommands(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	_, owner := mustDialRawTestServer(t, s, path)
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, owner, &wantLobby, "owner")
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	commands := map[api.RequestType]json.RawMessage{
+		api.RequestTypeKick:      json.RawMessage(`{"username":"owner"}`),
+		api.RequestTypeConfigure: json.RawMessage(`{"quiz":"cars"}`),
+		api.RequestTypeStart:     json.RawMessage("{}"),
+	}
+	for reqType, data := range commands {
+		mustWriteRequest(t, conn, reqType, data)
+
+		res := mustReadResponseType(t, cli, api.ResponseTypeError)
+		apiErr, err := api.DecodeJSON[api.WebsocketErrorData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode error response: %v", err)
+		}
+		if got, want := apiErr.Code, api.NotRegisteredCode; got != want {
+			t.Errorf("Unexpected %s error code: got %d, want %d", reqType, got, want)
+		}
+		if got, want := apiErr.Request, reqType; got != want {
+			t.Errorf("Unexpected error request: got %s, want %s", got, want)
+		}
+	}
+
+	if got, want := lobby.State(), quiz.LobbyStateRegister; got != want {
+		t.Errorf("Unexpected lobby state: got %s, want %s", got, want)
+	}
+	if _, _, ok := lobby.GetPlayer("owner"); !ok {
+		t.Error("Owner was kicked by an unregistered conn")
+	}
+
+	// Registering is still allowed.
+	res, err := cli.Register("player")
+	if err != nil {
+		t.Fatalf("Could not register: %v", err)
+	}
+	if got, want := res.Type, api.ResponseTypeRegister; got != want {
+		t.Errorf("Unexpected register response: got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyReapUnregistered(t *testing.T) {
+	t.Parallel()
+
+	cfg := defaultTestConfig
+	cfg.Lobby.RegisterGracePeriod = 200 * time.Millisecond
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        cfg,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	_, owner := mustDialRawTestServer(t, s, path)
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, owner, &wantLobby, "owner")
+
+	idle, _ := mustDialRawTestServer(t, s, path)
+
+	// The idle conn is closed once the grace period is over.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		_, _, err := idle.Read(ctx)
+		if err == nil {
+			continue // Banner and broadcasts.
+		}
+		if got, want := websocket.CloseStatus(err), websocket.StatusPolicyViolation; got != want {
+			t.Fatalf("Unexpected idle conn closure: got status %d, want %d: %v", got, want, err)
+		}
+		break
+	}
+
+	// The registered conn stays.
+	res, err := owner.Lobby()
+	if err != nil {
+		t.Fatalf("Registered conn was closed: %v", err)
+	}
+	for res.Type != api.ResponseTypeLobby {
+		if res, err = owner.ReadResponse(); err != nil {
+			t.Fatalf("Registered conn was closed: %v", err)
+		}
+	}
+
+	// The reaped conn is torn down asynchronously by the server.
+	deadline := time.Now().Add(2 * time.Second)
+	for lobby.NumConns() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Unexpected conns after reaping: got %d, want 1", lobby.NumConns())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLobbyQuizGreeting(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	_, owner := mustDialRawTestServer(t, s, path)
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, owner, &wantLobby, "owner")
+
+	// Between questions, the lobby details are sent.
+	lobby.SetState(quiz.LobbyStateQuiz)
+	_, cli := mustDialRawTestServer(t, s, path)
+	res := mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	data := api.LobbyResponseData{}
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		t.Fatalf("Could not decode lobby response: %v", err)
+	}
+	if got, want := data.State, quiz.LobbyStateQuiz.String(); got != want {
+		t.Errorf("Unexpected lobby state: got %s, want %s", got, want)
+	}
+
+	question := lobby.Quiz().Questions[0]
+	question.Time = 10 * time.Second
+	lobby.SetCurrentQuestion(&question)
+
+	// During a question, the question is sent with its remaining time.
+	_, cli = mustDialRawTestServer(t, s, path)
+	res = mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+	greeting := api.QuestionResponseData{}
+	if err := json.Unmarshal(res.Data, &greeting); err != nil {
+		t.Fatalf("Could not decode question response: %v", err)
+	}
+	if diff := cmp.Diff(question.Sanitized(), greeting.Question); diff != "" {
+		t.Errorf("Unexpected greeting question (-want+got):\n%v", diff)
+	}
+	if greeting.Question.Answer != nil {
+		t.Error("Greeting question contains an answer")
+	}
+	if greeting.Remaining <= 0 || greeting.Remaining > question.Time {
+		t.Errorf("Unexpected remaining time: got %s, want within %s", greeting.Remaining, question.Time)
+	}
+}
+
+func TestLobbyStartEmptyQuiz(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers: 20,
+			Quizzes:    map[string]api.Quiz{"empty": {Name: "empty"}},
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := api.LobbyResponseData{
+		MaxPlayers:  20,
+		Quizzes:     []string{"empty"},
+		CurrentQuiz: "empty",
+	}
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	res := mustReadResponseType(t, cli, api.ResponseTypeError)
+	apiErr, err := api.DecodeJSON[api.WebsocketErrorData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode error response: %v", err)
+	}
+	if got, want := apiErr.Code, api.InvalidRequestCode; got != want {
+		t.Errorf("Unexpected error code: got %d, want %d", got, want)
+	}
+	if got, want := apiErr.Request, api.RequestTypeStart; got != want {
+		t.Errorf("Unexpected error request: got %s, want %s", got, want)
+	}
+	if got, want := lobby.State(), quiz.LobbyStateRegister; got != want {
+		t.Errorf("Unexpected lobby state: got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyStartMinPlayers(t *testing.T) {
+	t.Parallel()
+
+	opts := defaultTestLobbyOptions
+	opts.MinPlayers = 2
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, opts)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	ownerConn, ownerCli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, ownerCli, &wantLobby, "owner")
+
+	mustWriteRequest(t, ownerConn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	res := mustReadResponseType(t, ownerCli, api.ResponseTypeError)
+	apiErr, err := api.DecodeJSON[api.WebsocketErrorData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode error response: %v", err)
+	}
+	if got, want := apiErr.Code, api.NotEnoughPlayersCode; got != want {
+		t.Errorf("Unexpected error code: got %d, want %d", got, want)
+	}
+	if got, want := lobby.State(), quiz.LobbyStateRegister; got != want {
+		t.Errorf("Unexpected lobby state: got %s, want %s", got, want)
+	}
+
+	playerCli, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, playerCli, &wantLobby, "player")
+
+	mustWriteRequest(t, ownerConn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	mustReadResponseType(t, ownerCli, api.ResponseTypeStart)
+	mustReadResponseType(t, playerCli, api.ResponseTypeStart)
+}
+
+func TestLobbyStartCountdown(t *testing.T) {
+	t.Parallel()
+
+	opts := defaultTestLobbyOptions
+	opts.StartCountdown = 2 * time.Second
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, opts)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, cli, api.ResponseTypeStart)
+
+	var remaining []int
+	for {
+		res, err := cli.ReadResponse()
+		if err != nil {
+			t.Fatalf("Could not read quiz broadcast: %v", err)
+		}
+		if res.Type == api.ResponseTypeQuestion {
+			break
+		}
+		if res.Type != api.ResponseTypeCountdown {
+			continue
+		}
+		data, err := api.DecodeJSON[api.CountdownResponseData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode countdown: %v", err)
+		}
+		remaining = append(remaining, data.Remaining)
+	}
+
+	if diff := cmp.Diff([]int{2, 1}, remaining); diff != "" {
+		t.Errorf("Unexpected countdown before the first question: (-want +got):\n%s", diff)
+	}
+}
+
+func TestLobbyInterQuestionDelay(t *testing.T) {
+	t.Parallel()
+
+	const (
+		questionTime = 100 * time.Millisecond
+		delay        = 500 * time.Millisecond
+	)
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers:         defaultTestLobbyOptions.MaxPlayers,
+			InterQuestionDelay: delay,
+			Quizzes: map[string]api.Quiz{
+				"short": {
+					Name: "short",
+					Questions: []api.Question{
+						{Title: "first", Type: api.QuestionTypeText, Time: questionTime},
+						{Title: "second", Type: api.QuestionTypeText, Time: questionTime},
+					},
+				},
+			},
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	mustRegister(t, cli, "owner")
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+	first := time.Now()
+	mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+
+	// The question time is left out as slack for the read latency.
+	if got, want := time.Since(first), delay; got < want {
+		t.Errorf("Questions were not spaced out by the delay: got %s, want at least %s", got, want)
+	}
+}
+
+func TestLobbyAnswerDuringDelay(t *testing.T) {
+	t.Parallel()
+
+	const questionTime = 100 * time.Millisecond
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers:         defaultTestLobbyOptions.MaxPlayers,
+			InterQuestionDelay: time.Second,
+			Quizzes: map[string]api.Quiz{
+				"capitals": {
+					Name: "capitals",
+					Questions: []api.Question{
+						{Title: "first", Type: api.QuestionTypeText, Time: questionTime, Answer: &api.Answer{Text: "Paris"}},
+						{Title: "second", Type: api.QuestionTypeText, Time: questionTime, Answer: &api.Answer{Text: "Rome"}},
+					},
+				},
+			},
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+	mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	mustRegister(t, cli, "owner")
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	res := mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+	question, err := api.DecodeJSON[api.QuestionResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode question broadcast: %v", err)
+	}
+
+	// Answer once the question time is over, well within the delay.
+	time.Sleep(2 * questionTime)
+	req := fmt.Sprintf(`{"questionId":%d,"answer":{"text":"Paris"}}`, question.Question.ID)
+	mustWriteRequest(t, conn, api.RequestTypeAnswer, json.RawMessage(req))
+	mustReadResponseType(t, cli, api.ResponseTypeError)
+
+	if got := lobby.ComputeResults().Results["owner"]; got != 0 {
+		t.Errorf("Answer sent during the delay was scored: got %g, want 0", got)
+	}
+}
+
+func TestLobbyQuestionProgress(t *testing.T) {
+	t.Parallel()
+
+	questions := []api.Question{
+		{Title: "first", Type: api.QuestionTypeText, Time: 50 * time.Millisecond},
+		{Title: "second", Type: api.QuestionTypeText, Time: 50 * time.Millisecond},
+		{Title: "third", Type: api.QuestionTypeText, Time: 50 * time.Millisecond},
+	}
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers: defaultTestLobbyOptions.MaxPlayers,
+			Quizzes: map[string]api.Quiz{
+				"short": {Name: "short", Questions: questions},
+			},
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	mustRegister(t, cli, "owner")
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	for i, want := range questions {
+		res := mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+		data, err := api.DecodeJSON[api.QuestionResponseData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode question broadcast: %v", err)
+		}
+		if data.Question.Title != want.Title {
+			t.Fatalf("Unexpected question: got %q, want %q", data.Question.Title, want.Title)
+		}
+		if data.Index != i || data.Total != len(questions) {
+			t.Errorf("Unexpected progress of question %q: got %d/%d, want %d/%d",
+				want.Title, data.Index, data.Total, i, len(questions))
+		}
+	}
+}
+
+// mustDialRawTestServer dials the test server and returns the raw
+// websocket along the client so tests can send arbitrary requests.
+func mustDialRawTestServer(t *testing.T, s *httptest.Server, path string) (*websocket.Conn, *client.Client) {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	conn, _, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Fatalf("Error while dialing test server: %v", err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+
+	return conn, client.NewClient(conn, 5*time.Second)
+}
+
+func mustWriteRequest(t *testing.T, conn *websocket.Conn, reqType api.RequestType, data json.RawMessage) {
+	t.Helper()
+
+	req := api.Request[json.RawMessage]{Type: reqType, Data: data}
+	if err := wsjson.Write(context.Background(), conn, req); err != nil {
+		t.Fatalf("Could not send %s request: %v", reqType, err)
+	}
+}
+
+func TestLobbyRequestID(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+	mustReadResponseType(t, cli, api.ResponseTypeLobby)
+
+	req := api.Request[api.RegisterRequestData]{
+		ID:   "req-1",
+		Type: api.RequestTypeRegister,
+		Data: api.RegisterRequestData{Username: "owner"},
+	}
+	if err := wsjson.Write(context.Background(), conn, req); err != nil {
+		t.Fatalf("Could not send register request: %v", err)
+	}
+	res := mustReadResponseType(t, cli, api.ResponseTypeRegister)
+	if got, want := res.ID, "req-1"; got != want {
+		t.Errorf("Unexpected register response id: got %q, want %q", got, want)
+	}
+
+	req.ID = "req-2" // Registering twice fails.
+	if err := wsjson.Write(context.Background(), conn, req); err != nil {
+		t.Fatalf("Could not send register request: %v", err)
+	}
+	res = mustReadResponseType(t, cli, api.ResponseTypeError)
+	if got, want := res.ID, "req-2"; got != want {
+		t.Errorf("Unexpected error response id: got %q, want %q", got, want)
+	}
+
+	// Requests without id get responses without id.
+	mustWriteRequest(t, conn, api.RequestTypeLobby, nil)
+	res = mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	if res.ID != "" {
+		t.Errorf("Unexpected lobby response id: %q", res.ID)
+	}
+}
+
+func TestLobbyToAPIResponseSanitized(t *testing.T) {
+	t.Parallel()
+
+	_, lobby := mustRegisterLobby(t, defaultTestLobbyOptions)
+
+	question := lobby.Quiz().Questions[0]
+	if question.Answer == nil {
+		t.Fatal("Test question has no answer")
+	}
+	lobby.SetCurrentQuestion(&question)
+
+	data, err := handlers.LobbyToAPIResponse(lobby)
+	if err != nil {
+		t.Fatalf("Could not convert lobby to api response: %v", err)
+	}
+	if data.CurrentQuestion == nil {
+		t.Fatal("Missing current question in lobby response")
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Could not encode lobby response: %v", err)
+	}
+	if strings.Contains(string(raw), `"answer"`) {
+		t.Errorf("Lobby response contains an answer: %s", raw)
+	}
+}
+
+func TestLobbySpectator(t *testing.T) {
+	t.Parallel()
+
+	var (
+		maxPlayers     = 1
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers: maxPlayers,
+			Quizzes:    defaultTestLobbyOptions.Quizzes,
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	ownerConn, ownerCli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	wantLobby.MaxPlayers = maxPlayers
+	mustRegisterOwner(t, ownerCli, &wantLobby, "owner")
+
+	// A spectator can join a full lobby.
+	conn, cli := mustDialRawTestServer(t, s, path+"?role=spectator")
+	mustLobbyBanner(t, cli, wantLobby)
+
+	if got := lobby.NumSpectators(); got != 1 {
+		t.Errorf("Unexpected number of spectators: got %d, want 1", got)
+	}
+	if diff := cmp.Diff([]string{"owner"}, lobby.GetPlayerList()); diff != "" {
+		t.Errorf("Spectator found in player list (-want+got):\n%v", diff)
+	}
+
+	mustWriteRequest(t, conn, api.RequestTypeRegister, json.RawMessage(`{"username":"spectator"}`))
+	mustReadResponseType(t, cli, api.ResponseTypeError)
+
+	mustWriteRequest(t, ownerConn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+
+	mustWriteRequest(t, conn, api.RequestTypeAnswer, json.RawMessage(`{"answer":{"text":"Porsche"}}`))
+	mustReadResponseType(t, cli, api.ResponseTypeError)
+}
+
+func TestLobbyAnswerAck(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	ownerConn, ownerCli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, ownerCli, &wantLobby, "owner")
+
+	playerConn, playerCli := mustDialRawTestServer(t, s, path)
+	mustRegisterPlayer(t, playerCli, &wantLobby, "player")
+
+	mustWriteRequest(t, ownerConn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, ownerCli, api.ResponseTypeQuestion)
+	res := mustReadResponseType(t, playerCli, api.ResponseTypeQuestion)
+	question, err := api.DecodeJSON[api.QuestionResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode question: %v", err)
+	}
+
+	mustWriteRequest(t, playerConn, api.RequestTypeAnswer, json.RawMessage(`{"answer":{"text":"Porsche"}}`))
+
+	res, err = playerCli.ReadResponse()
+	if err != nil {
+		t.Fatalf("Could not read answer response: %v", err)
+	}
+	if got, want := res.Type, api.ResponseTypeAnswer; got != want {
+		t.Fatalf("Unexpected response type: got %s, want %s", got, want)
+	}
+	ack, err := api.DecodeJSON[api.AnswerResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode answer response: %v", err)
+	}
+	want := api.AnswerResponseData{
+		QuestionID: question.Question.ID,
+		Answer:     api.Answer{Text: "Porsche"},
+	}
+	if diff := cmp.Diff(want, ack); diff != "" {
+		t.Errorf("Unexpected answer acknowledgement (-want +got):\n%s", diff)
+	}
+
+	mustWriteRequest(t, playerConn, api.RequestTypeAnswer, json.RawMessage(`{"answer":"Porsche"}`))
+
+	res, err = playerCli.ReadResponse()
+	if err != nil {
+		t.Fatalf("Could not read answer response: %v", err)
+	}
+	if got, want := res.Type, api.ResponseTypeError; got != want {
+		t.Fatalf("Unexpected response type: got %s, want %s", got, want)
+	}
+
+	// The acknowledgement was not broadcasted, the next owner message is
+	// the error of the owner invalid answer.
+	mustWriteRequest(t, ownerConn, api.RequestTypeAnswer, json.RawMessage(`{"answer":"Porsche"}`))
+
+	res, err = ownerCli.ReadResponse()
+	if err != nil {
+		t.Fatalf("Could not read owner response: %v", err)
+	}
+	if got, want := res.Type, api.ResponseTypeError; got != want {
+		t.Errorf("Unexpected owner response type: got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyRequestMidQuiz(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	res := mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+	question, err := api.DecodeJSON[api.QuestionResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode question: %v", err)
+	}
+
+	mustWriteRequest(t, conn, api.RequestTypeLobby, nil)
+
+	res = mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	data, err := api.DecodeJSON[api.LobbyResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode lobby response: %v", err)
+	}
+	if got, want := data.State, quiz.LobbyStateQuiz.String(); got != want {
+		t.Errorf("Unexpected lobby state: got %s, want %s", got, want)
+	}
+	if data.CurrentQuestion == nil {
+		t.Fatal("Missing current question in lobby response")
+	}
+	if diff := cmp.Diff(question.Question, *data.CurrentQuestion); diff != "" {
+		t.Errorf("Unexpected current question (-want +got):\n%s", diff)
+	}
+}
+
+func TestLobbyScores(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	playerCli, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, playerCli, &wantLobby, "player")
+
+	_, player, ok := lobby.GetPlayer("player")
+	if !ok {
+		t.Fatal("Could not get registered player")
+	}
+	player.AddScore(2)
+
+	mustWriteRequest(t, conn, api.RequestTypeLobby, nil)
+
+	res := mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	data, err := api.DecodeJSON[api.LobbyResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode lobby response: %v", err)
+	}
+	want := map[string]float64{"owner": 0, "player": 2}
+	if diff := cmp.Diff(want, data.Scores); diff != "" {
+		t.Errorf("Unexpected scores in lobby response (-want +got):\n%s", diff)
+	}
+}
+
+// mustReadResponseType reads responses until one of type want is received.
+func mustReadResponseType(t *testing.T, cli *client.Client, want api.ResponseType) api.Response[json.RawMessage] {
+	t.Helper()
+
+	res, err := cli.WaitFor(context.Background(), want)
+	if err != nil {
+		t.Fatalf("Could not read %s response: %v", want, err)
+	}
+	return res
+}
+
+func TestClientEvents(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	cli, _ := mustDialTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := cli.Events(ctx)
+
+	cli2, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli2, &wantLobby, "player2")
+
+	var got []api.ResponseType
+	for _, want := range []api.ResponseType{api.ResponseTypePlayerList, api.ResponseTypePlayerUpdate} {
+		res, ok := <-events
+		if !ok {
+			t.Fatalf("Events closed before %s", want)
+		}
+		got = append(got, res.Type)
+	}
+	want := []api.ResponseType{api.ResponseTypePlayerList, api.ResponseTypePlayerUpdate}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected events (-want+got):\n%v", diff)
+	}
+
+	// Closing the conn ends the stream.
+	cli.Close()
+	for range events {
+	}
+	if ctx.Err() != nil {
+		t.Error("Events were not closed on disconnect")
+	}
+}
+
+func TestClientWaitFor(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	cli, _ := mustDialTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	cli2, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli2, &wantLobby, "player2")
+
+	// The player list snapshot preceding the update is discarded.
+	res, err := cli.WaitFor(context.Background(), api.ResponseTypePlayerUpdate)
+	if err != nil {
+		t.Fatalf("Could not wait for player update: %v", err)
+	}
+	data, err := api.DecodeJSON[api.PlayerUpdateResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode player update broadcast: %v", err)
+	}
+	if data.Username != "player2" || data.Action != "join" {
+		t.Errorf("Unexpected player update: %+v", data)
+	}
+}
+
+func TestClientReadCancel(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)), path)
+	mustLobbyBanner(t, cli, defaultTestWantLobby)
+
+	// Cancellation must not wait for the client timeout.
+	cli.SetTimeout(10 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := cli.ReadResponseContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected read error: got %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read did not return promptly on cancel: %s", elapsed)
+	}
+}
+
+func TestLobbyPlayerAway(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	cli2, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli2, &wantLobby, "player2")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, cli, api.ResponseTypeStart)
+
+	cli2.Close()
+
+	// The snapshot marking the player away is sent before the update.
+	var snapshot api.PlayerListResponseData
+	for {
+		res, err := cli.ReadResponse()
+		if err != nil {
+			t.Fatalf("Could not read quiz broadcast: %v", err)
+		}
+		if res.Type == api.ResponseTypePlayerList {
+			snapshot, err = api.DecodeJSON[api.PlayerListResponseData](res.Data)
+			if err != nil {
+				t.Fatalf("Could not decode player list broadcast: %v", err)
+			}
+			continue
+		}
+		if res.Type != api.ResponseTypePlayerUpdate {
+			continue
+		}
+		data, err := api.DecodeJSON[api.PlayerUpdateResponseData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode player update broadcast: %v", err)
+		}
+		if data.Username == "player2" && data.Action == "away" {
+			break
+		}
+	}
+
+	if alive, ok := snapshot.Alive["player2"]; !ok || alive {
+		t.Errorf("Player not marked away in roster: %+v", snapshot)
+	}
+	if !snapshot.Alive["owner"] {
+		t.Errorf("Owner not marked alive in roster: %+v", snapshot)
+	}
+}
+
+func TestLobbyLogin(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.Subprotocols, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	cli2, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli2, &wantLobby, "player2")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, cli, api.ResponseTypeStart)
+
+	res := mustReadResponseType(t, cli2, api.ResponseTypeStart)
+	start, err := api.DecodeJSON[api.StartResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode start response: %v", err)
+	}
+	cli2.Close()
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+
+	// A token not issued by the lobby is rejected on dial.
+	_, httpRes, err := client.DialWithToken(context.Background(), url, "invalid")
+	if err == nil {
+		t.Fatal("Dial with invalid token succeeded")
+	}
+	if httpRes == nil || httpRes.StatusCode != http.StatusForbidden {
+		t.Errorf("Unexpected dial response with invalid token: %+v", httpRes)
+	}
+
+	cli3, _, err := client.DialWithToken(context.Background(), url, start.Token)
+	if err != nil {
+		t.Fatalf("Could not dial with token: %v", err)
+	}
+	t.Cleanup(cli3.Close)
+
+	res, err = cli3.Login(start.Token)
+	if err != nil {
+		t.Fatalf("Could not login: %v", err)
+	}
+	if res.Type != api.ResponseTypeLogin {
+		mustReadResponseType(t, cli3, api.ResponseTypeLogin)
+	}
+
+	// The owner is notified the player is back.
+	for {
+		res := mustReadResponseType(t, cli, api.ResponseTypePlayerUpdate)
+		data, err := api.DecodeJSON[api.PlayerUpdateResponseData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode player update broadcast: %v", err)
+		}
+		if data.Username == "player2" && data.Action == "back" {
+			break
+		}
+	}
+
+	if alive := lobby.GetPlayerPresence()["player2"]; !alive {
+		t.Error("Player was not restituted on login")
+	}
+}
+
+func TestLobbyLoginReplay(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	cli2, _ := mustDialTestServer(t, s, path)
+	mustRegisterPlayer(t, cli2, &wantLobby, "player2")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	res := mustReadResponseType(t, cli2, api.ResponseTypeStart)
+	start, err := api.DecodeJSON[api.StartResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode start response: %v", err)
+	}
+	startSeq := res.Seq
+	cli2.Close()
+
+	// The quiz is played while player2 is away, up to the owner review.
+	mustReadResponseType(t, cli, api.ResponseTypeReview)
+
+	conn3, cli3 := mustDialRawTestServer(t, s, path)
+	login := fmt.Sprintf(`{"token":%q,"lastSeq":%d}`, start.Token, startSeq)
+	mustWriteRequest(t, conn3, api.RequestTypeLogin, json.RawMessage(login))
+	mustReadResponseType(t, cli3, api.ResponseTypeLogin)
+
+	var (
+		seqs      []uint64
+		questions int
+	)
+	for {
+		res, err := cli3.ReadResponse()
+		if err != nil {
+			t.Fatalf("Could not read replayed broadcast: %v", err)
+		}
+		seqs = append(seqs, res.Seq)
+		if res.Type == api.ResponseTypeQuestion {
+			questions++
+		}
+		if res.Type == api.ResponseTypeReview {
+			break
+		}
+	}
+
+	for i, seq := range seqs {
+		if want := startSeq + uint64(i) + 1; seq != want {
+			t.Fatalf("Unexpected replayed broadcasts: got seqs %v, want them to follow %d", seqs, startSeq)
+		}
+	}
+	if got, want := questions, 3; got != want {
+		t.Errorf("Unexpected replayed questions: got %d, want %d", got, want)
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+		mw   = mws.Chain(handler, mws.Subprotocols, mws.NewLobby(lobbies))
+	)
+
+	// Players are served apart so dropping player2 conns keeps the owner.
+	s := newTestServer("GET /lobby/{id}", mw)
+	t.Cleanup(s.Close)
+	mux := http.NewServeMux()
+	mux.Handle("GET /lobby/{id}", mw)
+	s2 := httptest.NewUnstartedServer(mux)
+	tracker := &connTracker{Listener: s2.Listener}
+	s2.Listener = tracker
+	s2.Start()
+	t.Cleanup(s2.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	cli2, _ := mustDialTestServer(t, s2, path)
+	mustRegisterPlayer(t, cli2, &wantLobby, "player2")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	res := mustReadResponseType(t, cli2, api.ResponseTypeStart)
+	start, err := api.DecodeJSON[api.StartResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode start response: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	url := "ws" + strings.TrimPrefix(s2.URL, "http") + path
+	events, err := client.DialReconnecting(ctx, url, start.Token, client.Backoff{Min: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Could not dial: %v", err)
+	}
+
+	mustReadEventType(t, events, api.ResponseTypeLogin)
+
+	tracker.closeAll()
+
+	// The login is replayed and broadcasts resume on the new conn.
+	mustReadEventType(t, events, api.ResponseTypeLogin)
+	mustReadEventType(t, events, api.ResponseTypePlayerList)
+
+	if alive := lobby.GetPlayerPresence()["player2"]; !alive {
+		t.Error("Player was not restituted after reconnect")
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestClientReconnectLoginFailure(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.Subprotocols, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, cli, api.ResponseTypeStart)
+
+	// A valid token for a player that never joined cannot be restituted.
+	token, err := lobby.NewToken("ghost")
+	if err != nil {
+		t.Fatalf("Could not create token: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	events, err := client.DialReconnecting(ctx, url, token, client.Backoff{Min: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Could not dial: %v", err)
+	}
+
+	res := mustReadEventType(t, events, api.ResponseTypeError)
+	data, err := api.DecodeJSON[api.WebsocketErrorData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode error: %v", err)
+	}
+	if data.Request != api.RequestTypeLogin {
+		t.Errorf("Unexpected error request: got %s, want %s", data.Request, api.RequestTypeLogin)
+	}
+
+	for range events {
+	}
+	if ctx.Err() != nil {
+		t.Error("Events were not closed on login failure")
+	}
+}
+
+// connTracker records accepted conns to drop them, including the hijacked
+// websocket conns that httptest does not track.
+type connTracker struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *connTracker) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (l *connTracker) closeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = nil
+}
+
+func mustReadEventType(t *testing.T, events <-chan api.Response[json.RawMessage], want api.ResponseType) api.Response[json.RawMessage] {
+	t.Helper()
+
+	for res := range events {
+		if res.Type == want {
+			return res
+		}
+	}
+	t.Fatalf("Events closed before %s", want)
+	return api.Response[json.RawMessage]{}
+}
+
+func TestQuizzesHandler(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/quizzes", nil)
+	rec := httptest.NewRecorder()
+
+	handlers.QuizzesHandler(defaultTestQuizStore)(rec, req)
+
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+
+	got := api.QuizzesResponseData{}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("Could not decode quizzes response: %v", err)
+	}
+
+	want := api.QuizzesResponseData{
+		Quizzes: []api.QuizSummary{
+			{
+				Name: "cars",
+				QuizInfo: api.QuizInfo{
+					Title:         "Cars",
+					Description:   "Test your car knowledge.",
+					Author:        "SevenQuiz",
+					Difficulty:    "easy",
+					QuestionCount: 3,
+				},
+			},
+			{Name: "custom"},
+			{Name: "default"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected quizzes response (-want+got):\n%v", diff)
+	}
+}
+
+func TestQuizHandler(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/quizzes/cars", nil)
+	req.SetPathValue("name", "cars")
+	rec := httptest.NewRecorder()
+
+	handlers.QuizHandler(defaultTestQuizStore)(rec, req)
+
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+	if strings.Contains(rec.Body.String(), `"answer"`) {
+		t.Errorf("Quiz preview contains answers: %s", rec.Body)
+	}
+
+	got := api.QuizResponseData{}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("Could not decode quiz response: %v", err)
+	}
+
+	if got.Name != "cars" || got.QuestionCount != 3 || len(got.Questions) != 3 {
+		t.Errorf("Unexpected quiz response: %+v", got)
+	}
+	for _, question := range got.Questions {
+		if question.Title == "" || !question.Type.IsValid() {
+			t.Errorf("Unexpected question preview: %+v", question)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/quizzes/unknown", nil)
+	req.SetPathValue("name", "unknown")
+	rec = httptest.NewRecorder()
+
+	handlers.QuizHandler(defaultTestQuizStore)(rec, req)
+
+	if got, want := rec.Code, http.StatusNotFound; got != want {
+		t.Errorf("Unexpected status code for unknown quiz: got %d, want %d", got, want)
+	}
+}
+
+func TestLobbyShuffle(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers: defaultTestLobbyOptions.MaxPlayers,
+			Quizzes:    defaultTestLobbyOptions.Quizzes,
+			Shuffle:    true,
+			Seed:       1,
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	fileOrder := []string{}
+	for _, question := range lobby.Quiz().Questions {
+		fileOrder = append(fileOrder, question.Title)
+	}
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	played := []string{}
+	answered := -1
+	for i := range fileOrder {
+		res := mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+
+		data, err := api.DecodeJSON[api.QuestionResponseData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode question broadcast: %v", err)
+		}
+		if got := data.Question.ID; got != i {
+			t.Errorf("Unexpected question id: got %d, want %d", got, i)
+		}
+		if i == 0 {
+			answered = data.Question.ID
+			mustWriteRequest(t, conn, api.RequestTypeAnswer, json.RawMessage(`{"answer":{"text":"shuffled"}}`))
+		}
+		played = append(played, data.Question.Title)
+	}
+
+	if slices.Equal(fileOrder, played) {
+		t.Errorf("Questions were played in file order: %v", played)
+	}
+
+	// Questions IDs must match the played order so answers are linked
+	// to the question they were sent for.
+	questions := lobby.Quiz().Questions
+	for i, title := range played {
+		if questions[i].ID != i || questions[i].Title != title {
+			t.Errorf("Question %d does not match played question %s: %+v", i, title, questions[i])
+		}
+	}
+
+	_, player, ok := lobby.GetPlayer("owner")
+	if !ok {
+		t.Fatal("Owner not found in lobby")
+	}
+	if got, want := player.GetAnswer(answered).Text, "shuffled"; got != want {
+		t.Errorf("Unexpected answer for question %d: got %s, want %s", answered, got, want)
+	}
+}
+
+func TestLobbyShuffleChoices(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers:     defaultTestLobbyOptions.MaxPlayers,
+			Quizzes:        defaultTestLobbyOptions.Quizzes,
+			ShuffleChoices: true,
+			Seed:           1,
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	for {
+		res, err := cli.ReadResponse()
+		if err != nil {
+			t.Fatalf("Could not read quiz broadcast: %v", err)
+		}
+
+		switch res.Type {
+		case api.ResponseTypeQuestion:
+			data, err := api.DecodeJSON[api.QuestionResponseData](res.Data)
+			if err != nil {
+				t.Fatalf("Could not decode question broadcast: %v", err)
+			}
+			if data.Question.Type != api.QuestionTypeChoices {
+				continue
+			}
+			if got, want := data.Question.Choices, []string{"Audi", "Renault", "BMW", "Fiat"}; slices.Equal(got, want) {
+				t.Errorf("Choices were not shuffled: %v", got)
+			}
+
+			// Answer with the correct choices in their shuffled order.
+			answer := api.AnswerRequestData{}
+			for _, choice := range data.Question.Choices {
+				if choice == "Audi" || choice == "BMW" {
+					answer.Answer.Choices = append(answer.Answer.Choices, choice)
+				}
+			}
+			payload, err := json.Marshal(answer)
+			if err != nil {
+				t.Fatalf("Could not encode answer: %v", err)
+			}
+			mustWriteRequest(t, conn, api.RequestTypeAnswer, payload)
+		case api.ResponseTypeReview:
+			data, err := api.DecodeJSON[api.ReviewResponseData](res.Data)
+			if err != nil {
+				t.Fatalf("Could not decode review broadcast: %v", err)
+			}
+			if data.Validated != (data.Question.Type == api.QuestionTypeChoices) {
+				t.Errorf("Unexpected validation of %s question: %t", data.Question.Type, data.Validated)
+			}
+			if !data.Validated {
+				mustWriteRequest(t, conn, api.RequestTypeReview, json.RawMessage(`{"validate":false}`))
+			}
+		case api.ResponseTypeResults:
+			data, err := api.DecodeJSON[api.ResultsResponseData](res.Data)
+			if err != nil {
+				t.Fatalf("Could not decode results broadcast: %v", err)
+			}
+			if got, want := data.Results["owner"], 1.0; got != want {
+				t.Errorf("Unexpected owner score: got %g, want %g", got, want)
+			}
+			return
+		}
+	}
+}
+
+func TestLobbyRevealAfterEach(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers:      defaultTestLobbyOptions.MaxPlayers,
+			Quizzes:         defaultTestLobbyOptions.Quizzes,
+			RevealAfterEach: true,
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	res := mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+	question, err := api.DecodeJSON[api.QuestionResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode question broadcast: %v", err)
+	}
+	mustWriteRequest(t, conn, api.RequestTypeAnswer, json.RawMessage(`{"answer":{"text":"porsche"}}`))
+
+	res = mustReadResponseType(t, cli, api.ResponseTypeAnswerReveal)
+	reveal, err := api.DecodeJSON[api.AnswerRevealResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode answer reveal broadcast: %v", err)
+	}
+
+	if got, want := reveal.QuestionID, question.Question.ID; got != want {
+		t.Errorf("Unexpected revealed question: got %d, want %d", got, want)
+	}
+	if got, want := reveal.Answer.Text, "Porsche"; got != want {
+		t.Errorf("Unexpected revealed answer: got %s, want %s", got, want)
+	}
+	if !reveal.Correct["owner"] {
+		t.Errorf("Owner answer not revealed as correct: %+v", reveal.Correct)
+	}
+}
+
+func TestLobbyAnswerAfterReveal(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers:         defaultTestLobbyOptions.MaxPlayers,
+			RevealAfterEach:    true,
+			InterQuestionDelay: time.Second,
+			Quizzes: map[string]api.Quiz{
+				"capitals": {
+					Name: "capitals",
+					Questions: []api.Question{
+						{Title: "first", Type: api.QuestionTypeText, Time: 100 * time.Millisecond, Answer: &api.Answer{Text: "Paris"}},
+						{Title: "second", Type: api.QuestionTypeText, Time: 100 * time.Millisecond, Answer: &api.Answer{Text: "Rome"}},
+					},
+				},
+			},
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+	mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	mustRegister(t, cli, "owner")
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+
+	res := mustReadResponseType(t, cli, api.ResponseTypeAnswerReveal)
+	reveal, err := api.DecodeJSON[api.AnswerRevealResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode answer reveal broadcast: %v", err)
+	}
+
+	// The revealed answer is sent before the next question starts.
+	req := fmt.Sprintf(`{"questionId":%d,"answer":{"text":%q}}`, reveal.QuestionID, reveal.Answer.Text)
+	mustWriteRequest(t, conn, api.RequestTypeAnswer, json.RawMessage(req))
+	mustReadResponseType(t, cli, api.ResponseTypeError)
+
+	if got := lobby.ComputeResults().Results["owner"]; got != 0 {
+		t.Errorf("Answer sent after the reveal was scored: got %g, want 0", got)
+	}
+}
+
+func TestLobbyQuizEnd(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, cli, api.ResponseTypeStart)
+
+	var (
+		questions int
+		end       *api.QuizEndResponseData
+	)
+	for {
+		res, err := cli.ReadResponse()
+		if err != nil {
+			t.Fatalf("Could not read quiz broadcast: %v", err)
+		}
+		if res.Type == api.ResponseTypeReview {
+			break
+		}
+		switch res.Type {
+		case api.ResponseTypeQuestion:
+			if end != nil {
+				t.Fatal("Question broadcast after the quiz end")
+			}
+			questions++
+		case api.ResponseTypeQuizEnd:
+			data, err := api.DecodeJSON[api.QuizEndResponseData](res.Data)
+			if err != nil {
+				t.Fatalf("Could not decode quiz end: %v", err)
+			}
+			end = &data
+		}
+	}
+
+	if end == nil {
+		t.Fatal("Review started without a quiz end broadcast")
+	}
+	want := api.QuizEndResponseData{Questions: questions, Next: "review"}
+	if diff := cmp.Diff(want, *end); diff != "" {
+		t.Errorf("Unexpected quiz end: (-want +got):\n%s", diff)
+	}
+}
+
+func TestLobbyResults(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	mux.Handle("GET /lobby/{id}/results", handlers.LobbyResultsHandler(lobbies))
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	ownerToken, err := lobby.NewOwnerToken()
+	if err != nil {
+		t.Fatalf("Could not create owner token: %v", err)
+	}
+	url := s.URL + path + "/results"
+
+	// Results are rejected until the quiz ends.
+	res := mustHTTPRequest(t, http.MethodGet, url, ownerToken)
+	if got, want := res.StatusCode, http.StatusConflict; got != want {
+		t.Errorf("Unexpected status code before the quiz end: got %d, want %d", got, want)
+	}
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	start, err := api.DecodeJSON[api.StartResponseData](mustReadResponseType(t, cli, api.ResponseTypeStart).Data)
+	if err != nil {
+		t.Fatalf("Could not decode start response: %v", err)
+	}
+	mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+	mustWriteRequest(t, conn, api.RequestTypeAnswer, json.RawMessage(`{"answer":{"text":"porsche"}}`))
+	mustReadResponseType(t, cli, api.ResponseTypeReview)
+
+	res = mustHTTPRequest(t, http.MethodGet, url, "")
+	if got, want := res.StatusCode, http.StatusUnauthorized; got != want {
+		t.Errorf("Unexpected status code without token: got %d, want %d", got, want)
+	}
+
+	// The owner player token is accepted as well as the owner token.
+	res = mustHTTPRequest(t, http.MethodGet, url, start.Token)
+	if got, want := res.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+	results := api.LobbyResultsResponseData{}
+	if err := json.NewDecoder(res.Body).Decode(&results); err != nil {
+		t.Fatalf("Could not decode results: %v", err)
+	}
+	if got, want := results.Results["owner"], 1.0; got != want {
+		t.Errorf("Unexpected owner score: got %g, want %g", got, want)
+	}
+	if got, want := len(results.Questions), 3; got != want {
+		t.Fatalf("Unexpected number of questions: got %d, want %d", got, want)
+	}
+	if !results.Questions[0].Correct["owner"] || results.Questions[1].Correct["owner"] {
+		t.Errorf("Unexpected owner correctness: %+v", results.Questions)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("Could not create http request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Accept", "text/csv, application/json;q=0.5")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Could not send http request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if got, want := res.Header.Get("Content-Type"), "text/csv; charset=utf-8"; got != want {
+		t.Errorf("Unexpected content type: got %s, want %s", got, want)
+	}
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Could not read results csv: %v", err)
+	}
+	want := [][]string{
+		{"rank", "username", "score", results.Questions[0].Title, results.Questions[1].Title, results.Questions[2].Title},
+		{"1", "owner", "1", "true", "false", "false"},
+	}
+	if diff := cmp.Diff(want, records); diff != "" {
+		t.Errorf("Unexpected results csv: (-want +got):\n%s", diff)
+	}
+}
+
+func TestLobbyHTTPAnswer(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	mux.Handle("POST /lobby/{id}/answer", handlers.AnswerHandler(defaultTestConfig, lobbies))
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	url := s.URL + path + "/answer"
+	postAnswer := func(token, body string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Could not create http request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Could not send http request: %v", err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+
+		return res
+	}
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	start, err := api.DecodeJSON[api.StartResponseData](mustReadResponseType(t, cli, api.ResponseTypeStart).Data)
+	if err != nil {
+		t.Fatalf("Could not decode start response: %v", err)
+	}
+	question, err := api.DecodeJSON[api.QuestionResponseData](mustReadResponseType(t, cli, api.ResponseTypeQuestion).Data)
+	if err != nil {
+		t.Fatalf("Could not decode question response: %v", err)
+	}
+
+	res := postAnswer("invalid", `{"answer":{"text":"porsche"}}`)
+	if got, want := res.StatusCode, http.StatusForbidden; got != want {
+		t.Errorf("Unexpected status code with an invalid token: got %d, want %d", got, want)
+	}
+
+	res = postAnswer(start.Token, fmt.Sprintf(`{"questionId":%d,"answer":{"text":"porsche"}}`, question.Question.ID+1))
+	if got, want := res.StatusCode, http.StatusConflict; got != want {
+		t.Errorf("Unexpected status code for another question: got %d, want %d", got, want)
+	}
+
+	res = postAnswer(start.Token, fmt.Sprintf(`{"questionId":%d,"answer":{"text":"porsche"}}`, question.Question.ID))
+	if got, want := res.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("Unexpected status code: got %d, want %d", got, want)
+	}
+	ack := api.AnswerResponseData{}
+	if err := json.NewDecoder(res.Body).Decode(&ack); err != nil {
+		t.Fatalf("Could not decode answer response: %v", err)
+	}
+	want := api.AnswerResponseData{
+		QuestionID: question.Question.ID,
+		Answer:     api.Answer{Text: "porsche"},
+	}
+	if diff := cmp.Diff(want, ack); diff != "" {
+		t.Errorf("Unexpected answer response: (-want +got):\n%s", diff)
+	}
+
+	_, player, ok := lobby.GetPlayer("owner")
+	if !ok {
+		t.Fatal("Owner player not found")
+	}
+	if diff := cmp.Diff(want.Answer, player.GetAnswer(question.Question.ID)); diff != "" {
+		t.Errorf("Unexpected stored answer: (-want +got):\n%s", diff)
+	}
+}
+
+func TestLobbyPlayerReadLimit(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers: defaultTestLobbyOptions.MaxPlayers,
+			Quizzes: map[string]api.Quiz{
+				"long": {
+					Name: "long",
+					Questions: []api.Question{
+						{Title: "first", Type: api.QuestionTypeText, Time: time.Minute},
+					},
+				},
+			},
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	mustRegister(t, cli, "owner")
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+
+	// Over the read limit of unregistered conns.
+	answer := strings.Repeat("x", 2*int(defaultTestConfig.Lobby.WebsocketReadLimit))
+	mustWriteRequest(t, conn, api.RequestTypeAnswer, json.RawMessage(`{"answer":{"text":"`+answer+`"}}`))
+
+	_, player, ok := lobby.GetPlayer("owner")
+	if !ok {
+		t.Fatal("Could not get player")
+	}
+	deadline := time.Now().Add(time.Second)
+	for player.GetAnswer(0).Text != answer {
+		if time.Now().After(deadline) {
+			t.Fatal("Answer over the unregistered read limit was not accepted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The conn is still usable.
+	mustWriteRequest(t, conn, api.RequestTypePause, nil)
+	mustReadResponseType(t, cli, api.ResponseTypePause)
+}
+
+func TestLobbyCompression(t *testing.T) {
+	t.Parallel()
+
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:  defaultTestConfig,
+			Lobbies: lobbies,
+			AcceptOptions: websocket.AcceptOptions{
+				InsecureSkipVerify: true,
+				CompressionMode:    websocket.CompressionContextTakeover,
+			},
+		}
+		path = "/lobby/" + lobby.ID()
+	)
 
-	mustRegisterPlayer(t, cli2, &wantLobby, player)
-	mustBroadcastPlayerUpdate(t, cli, player, "join")
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
 
-	// Player is not owner, kick must not be possible.
-	res, err := cli2.Kick(owner)
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	cli, res, err := client.Dial(context.Background(), url, client.WithCompression(nil))
 	if err != nil {
-		t.Fatalf("Unexpected error while trying to kick %s: %v", owner, err)
+		t.Fatalf("Error while dialing test server: %v", err)
 	}
-	if got, want := res.Type, api.ResponseTypeError; got != want {
-		t.Errorf("Invalid kick command response, got %s, want %s, response %+v", got, want, res)
+	t.Cleanup(cli.Close)
+
+	if ext := res.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("Compression was not negotiated: %q", ext)
 	}
 
-	res, err = cli.Kick(player)
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	if _, err := cli.Start(); err != nil {
+		t.Fatalf("Could not start quiz: %v", err)
+	}
+
+	apiRes := mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+	question, err := api.DecodeJSON[api.QuestionResponseData](apiRes.Data)
 	if err != nil {
-		t.Fatalf("Unexpected error while trying to kick %s: %v", player, err)
+		t.Fatalf("Could not decode question broadcast: %v", err)
 	}
-	if got, want := res.Type, api.ResponseTypeKick; got != want {
-		t.Errorf("Invalid kick command response, got %s, want %s, response %+v", got, want, res)
+	if got, want := question.Question.Title, "Which brand makes the 911 ?"; got != want {
+		t.Errorf("Unexpected question title: got %q, want %q", got, want)
 	}
-
-	mustBroadcastPlayerUpdate(t, cli, player, "kick")
 }
 
-func TestLobbyConfigure(t *testing.T) {
+func TestLobbySubprotocol(t *testing.T) {
 	t.Parallel()
 
 	var (
 		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
-		mw             = mws.NewLobby(lobbies)
 		handler        = handlers.LobbyHandler{
-			Config:        defaultTestConfig,
-			Lobbies:       lobbies,
-			AcceptOptions: defaultTestAcceptOptions,
+			Config:  defaultTestConfig,
+			Lobbies: lobbies,
+			AcceptOptions: websocket.AcceptOptions{
+				InsecureSkipVerify: true,
+				Subprotocols:       []string{api.Subprotocol},
+			},
 		}
 		path = "/lobby/" + lobby.ID()
 	)
 
-	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mw), path)
+	token, err := lobby.NewOwnerToken()
+	if err != nil {
+		t.Fatalf("Could not issue owner token: %v", err)
+	}
 
-	// Setup lobby owner
-	owner := "owner"
-	wantLobby := defaultTestWantLobby
-	mustRegisterOwner(t, cli, &wantLobby, owner)
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.Subprotocols, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
 
-	res, err := cli.Configure(wantLobby.Quizzes[1])
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
+	cli, res, err := client.DialWithToken(context.Background(), url, token)
 	if err != nil {
-		t.Fatalf("Error while sending configure command: %v", err)
-	}
-	if got, want := res.Type, api.ResponseTypeConfigure; got != want {
-		t.Errorf("Invalid configure response type: got %s, want %s", got, want)
+		t.Fatalf("Could not dial with token: %v", err)
 	}
+	t.Cleanup(cli.Close)
 
-	mustBroadcastConfigure(t, cli, wantLobby.Quizzes[1])
+	if got := res.Header.Get("Sec-WebSocket-Protocol"); got != api.Subprotocol {
+		t.Fatalf("Unexpected negotiated subprotocol: got %q, want %q", got, api.Subprotocol)
+	}
 
-	if got, want := lobby.Quiz().Name, wantLobby.Quizzes[1]; got != want {
-		t.Errorf("Invalid configured quiz in lobby: got %s, want %s", got, want)
+	// The token offered alongside is still forwarded.
+	banner := mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	data, err := api.DecodeJSON[api.LobbyResponseData](banner.Data)
+	if err != nil {
+		t.Fatalf("Could not decode lobby banner: %v", err)
+	}
+	if !data.OwnerClaimed {
+		t.Error("Owner token offered with the subprotocol was not claimed")
 	}
 }
 
-func TestLobbyPassword(t *testing.T) {
+func TestLobbyResetGame(t *testing.T) {
 	t.Parallel()
 
 	var (
 		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
-			Quizzes:  defaultTestLobbyOptions.Quizzes,
-			Password: "1234",
+			MaxPlayers:  defaultTestLobbyOptions.MaxPlayers,
+			ResultsHold: time.Minute,
+			Quizzes: map[string]api.Quiz{
+				"short": {
+					Name: "short",
+					Questions: []api.Question{
+						{Title: "Capital of France ?", Type: api.QuestionTypeText, Time: 200 * time.Millisecond, Answer: &api.Answer{Text: "Paris"}},
+					},
+				},
+			},
 		})
-		middlewares = []mws.Middleware{mws.Subprotocols, mws.NewLobby(lobbies)}
-		handler     = handlers.LobbyHandler{
+		handler = handlers.LobbyHandler{
 			Config:        defaultTestConfig,
 			Lobbies:       lobbies,
 			AcceptOptions: defaultTestAcceptOptions,
@@ -557,170 +4301,322 @@ func TestLobbyPassword(t *testing.T) {
 		path = "/lobby/" + lobby.ID()
 	)
 
-	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, middlewares...))
-	defer s.Close()
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
 
-	url := "ws" + strings.TrimPrefix(s.URL, "http") + path
-	cli, res, err := client.Dial(context.Background(), url, nil)
-	if cli != nil {
-		cli.Close()
+	conn, cli := mustDialRawTestServer(t, s, path)
+	mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	mustRegister(t, cli, "owner")
+
+	_, cli2 := mustDialRawTestServer(t, s, path)
+	mustReadResponseType(t, cli2, api.ResponseTypeLobby)
+	mustRegister(t, cli2, "player2")
+
+	// Resetting is only allowed once the quiz is over.
+	mustWriteRequest(t, conn, api.RequestTypeReset, nil)
+	mustReadResponseType(t, cli, api.ResponseTypeError)
+
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	res := mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+	question, err := api.DecodeJSON[api.QuestionResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode question broadcast: %v", err)
 	}
-	if err == nil {
-		t.Fatalf("Player was able to join a password protected lobby")
+	if _, err := cli.Answer(question.Question.ID, api.Answer{Text: "Paris"}); err != nil {
+		t.Fatalf("Could not answer: %v", err)
 	}
-	if got, want := res.StatusCode, http.StatusUnauthorized; got != want {
-		t.Errorf("Unexpected status code during ws handshake: got %d, want %d", got, want)
+	if _, err := cli2.Answer(question.Question.ID, api.Answer{Text: "Lyon"}); err != nil {
+		t.Fatalf("Could not answer: %v", err)
 	}
 
-	url += "?p=1234"
-	cli, res, err = client.Dial(context.Background(), url, nil)
-	if cli != nil {
-		cli.Close()
+	// The wrong answer is validated by the owner, scoring a point.
+	for {
+		res := mustReadResponseType(t, cli, api.ResponseTypeReview)
+		review, err := api.DecodeJSON[api.ReviewResponseData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode review broadcast: %v", err)
+		}
+		if !review.Validated {
+			break
+		}
 	}
+	mustWriteRequest(t, conn, api.RequestTypeReview, json.RawMessage(`{"validate":true}`))
+
+	res = mustReadResponseType(t, cli, api.ResponseTypeResults)
+	results, err := api.DecodeJSON[api.ResultsResponseData](res.Data)
 	if err != nil {
-		t.Fatalf("Player was not able to join lobby with password: %v", err)
+		t.Fatalf("Could not decode results broadcast: %v", err)
 	}
-	if got, want := res.StatusCode, http.StatusSwitchingProtocols; got != want {
-		t.Errorf("Unexpected status code during ws handshake: got %d, want %d", got, want)
+	if diff := cmp.Diff(map[string]float64{"owner": 1, "player2": 1}, results.Results); diff != "" {
+		t.Fatalf("Unexpected results before reset (-want +got):\n%s", diff)
 	}
-}
 
-func mustRegisterLobby(t *testing.T, opts quiz.LobbyOptions) (quiz.LobbyRepository, *quiz.Lobby) {
-	t.Helper()
+	if err := cli.Reset(); err != nil {
+		t.Fatalf("Could not reset the game: %v", err)
+	}
+	mustReadResponseType(t, cli, api.ResponseTypeReset)
+	mustReadResponseType(t, cli2, api.ResponseTypeReset)
 
-	lobbies := quiz.NewLobbiesCache()
-	lobby, err := lobbies.Register(opts)
-	if err != nil {
-		t.Fatalf("Could not register lobby: %v", err)
+	if got, want := lobby.State(), quiz.LobbyStateRegister; got != want {
+		t.Errorf("Unexpected lobby state after reset: got %s, want %s", got, want)
 	}
-	return lobbies, lobby
+	if diff := cmp.Diff([]string{"owner", "player2"}, lobby.GetPlayerList()); diff != "" {
+		t.Errorf("Unexpected players after reset (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]float64{"owner": 0, "player2": 0}, lobby.ComputeResults().Results); diff != "" {
+		t.Errorf("Scores were not cleared by the reset (-want +got):\n%s", diff)
+	}
+
+	// The same players play again.
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, cli2, api.ResponseTypeQuestion)
 }
 
-func mustLobby(t *testing.T, cli *client.Client, want api.LobbyResponseData) {
-	t.Helper()
+func TestLobbyDeleteMidQuiz(t *testing.T) {
+	t.Parallel()
 
-	res, err := cli.Lobby()
-	if err != nil {
-		t.Fatalf("Error while sending lobby command: %v", err)
-	}
-	if res.Type != api.ResponseTypeLobby {
-		t.Fatalf("Could not read lobby response: got api response: %+v", res)
+	var (
+		lobbies, lobby = mustRegisterLobby(t, quiz.LobbyOptions{
+			MaxPlayers: defaultTestLobbyOptions.MaxPlayers,
+			Quizzes: map[string]api.Quiz{
+				"long": {
+					Name: "long",
+					Questions: []api.Question{
+						{Title: "first", Type: api.QuestionTypeText, Time: time.Minute},
+						{Title: "second", Type: api.QuestionTypeText, Time: 100 * time.Millisecond},
+					},
+				},
+			},
+		})
+		handler = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	conn, cli := mustDialRawTestServer(t, s, path)
+
+	mustReadResponseType(t, cli, api.ResponseTypeLobby)
+	mustRegister(t, cli, "owner")
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+
+	// Keep reading so the close handshake is not blocked.
+	types := make(chan api.ResponseType, 10)
+	go func() {
+		defer close(types)
+		for {
+			res, err := cli.ReadResponse()
+			if err != nil {
+				return
+			}
+			types <- res.Type
+		}
+	}()
+
+	lobbies.Delete(lobby.ID())
+
+	for typ := range types {
+		if typ == api.ResponseTypeQuestion {
+			t.Error("Question broadcast after lobby deletion")
+		}
 	}
 
-	mustDecodeLobbyData(t, res, want)
+	// Leave time for the next question to be played if the runner did not stop.
+	time.Sleep(200 * time.Millisecond)
+
+	if got, want := lobby.State(), quiz.LobbyStateEnded; got != want {
+		t.Errorf("Unexpected lobby state: got %s, want %s", got, want)
+	}
+	if q := lobby.CurrentQuestion(); q == nil || q.Title != "first" {
+		t.Errorf("Quiz runner kept playing after lobby deletion: %+v", q)
+	}
 }
 
-func mustLobbyBanner(t *testing.T, cli *client.Client, want api.LobbyResponseData) {
-	t.Helper()
+func TestClientQuiz(t *testing.T) {
+	t.Parallel()
 
-	res, err := cli.ReadResponse()
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
+
+	cli, _ := mustDialTestServer(t, s, path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	res, err := cli.Start()
 	if err != nil {
-		t.Fatalf("Could not read lobby banner: %v", err)
+		t.Fatalf("Could not start quiz: %v", err)
 	}
-	if res.Type != api.ResponseTypeLobby {
-		t.Fatalf("Could not read lobby banner: got api response: %+v", res)
+	if res.Type != api.ResponseTypeStart {
+		t.Fatalf("Unexpected start response: %+v", res)
 	}
 
-	mustDecodeLobbyData(t, res, want)
-}
-
-func mustDecodeLobbyData(t *testing.T, res api.Response[json.RawMessage], want api.LobbyResponseData) {
-	t.Helper()
-
-	data, err := api.DecodeJSON[api.LobbyResponseData](res.Data)
+	res = mustReadResponseType(t, cli, api.ResponseTypeQuestion)
+	question, err := api.DecodeJSON[api.QuestionResponseData](res.Data)
 	if err != nil {
-		t.Fatalf("Could not decode lobby data: %v", data)
+		t.Fatalf("Could not decode question broadcast: %v", err)
 	}
-	if got, want := data.Owner, want.Owner; !cmp.Equal(got, want) {
-		t.Fatalf("Unexpected owner in lobby banner: got %v, want %v", got, want)
+	ack, err := cli.Answer(question.Question.ID, api.Answer{Text: "Porsche"})
+	if err != nil {
+		t.Fatalf("Could not answer question: %v", err)
 	}
-	if got, want := data.MaxPlayers, want.MaxPlayers; got != want {
-		t.Fatalf("Unexpected max players in lobby banner: got %d, want %d", got, want)
+	wantAck := api.AnswerResponseData{
+		QuestionID: question.Question.ID,
+		Answer:     api.Answer{Text: "Porsche"},
 	}
-	if len(data.ID) != 5 {
-		t.Fatalf("Unexpected lobby id in lobby banner: %s", data.ID)
+	if diff := cmp.Diff(wantAck, ack); diff != "" {
+		t.Errorf("Unexpected answer acknowledgement (-want +got):\n%s", diff)
 	}
-	if data.Created == "" {
-		t.Fatal("Missing created field in lobby banner")
+
+	// Unanswered questions wait for the owner review.
+	res = mustReadResponseType(t, cli, api.ResponseTypeReview)
+	for res.Type != api.ResponseTypeResults {
+		review, err := api.DecodeJSON[api.ReviewResponseData](res.Data)
+		if err != nil {
+			t.Fatalf("Could not decode review broadcast: %v", err)
+		}
+		if review.Validated {
+			res, err = cli.ReadResponse()
+		} else {
+			res, err = cli.Review(false)
+		}
+		if err != nil {
+			t.Fatalf("Could not read review: %v", err)
+		}
 	}
-	if diff := cmp.Diff(want.Quizzes, data.Quizzes); diff != "" {
-		t.Fatalf("Unexpected quizzes list in lobby banner (-want+got):\n%v", diff)
+
+	results, err := api.DecodeJSON[api.ResultsResponseData](res.Data)
+	if err != nil {
+		t.Fatalf("Could not decode results broadcast: %v", err)
 	}
-	if got, want := data.CurrentQuiz, want.CurrentQuiz; got != want {
-		t.Fatalf("Unexpected current quiz in lobby banner: got %s, want %s", got, want)
+	if got, want := results.Results["owner"], 1.0; got != want {
+		t.Errorf("Unexpected owner score: got %g, want %g", got, want)
 	}
 }
 
-func mustRegisterPlayer(t *testing.T, cli *client.Client, wantLobby *api.LobbyResponseData, username string) {
-	t.Helper()
-
-	mustLobbyBanner(t, cli, *wantLobby)
-	mustRegister(t, cli, username)
-	mustBroadcastPlayerUpdate(t, cli, username, "join")
+func TestLobbyPauseResume(t *testing.T) {
+	t.Parallel()
 
-	wantLobby.PlayerList = append(wantLobby.PlayerList, username)
-}
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
 
-func mustRegisterOwner(t *testing.T, cli *client.Client, wantLobby *api.LobbyResponseData, username string) {
-	t.Helper()
+	s := newTestServer("GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)))
+	t.Cleanup(s.Close)
 
-	mustRegisterPlayer(t, cli, wantLobby, username)
-	mustBroadcastPlayerUpdate(t, cli, username, "new owner")
+	conn, cli := mustDialRawTestServer(t, s, path)
 
-	wantLobby.Owner = &username
-}
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
 
-func mustRegister(t *testing.T, cli *client.Client, username string) {
-	t.Helper()
+	mustWriteRequest(t, conn, api.RequestTypeStart, json.RawMessage("{}"))
+	mustReadResponseType(t, cli, api.ResponseTypeQuestion)
 
-	res, err := cli.Register(username)
-	if err != nil {
-		t.Fatalf("Could not register username: %v", err)
+	mustWriteRequest(t, conn, api.RequestTypePause, nil)
+	mustReadResponseType(t, cli, api.ResponseTypePause)
+	if !lobby.Paused() {
+		t.Fatal("Lobby was not paused")
 	}
-	if res.Type != api.ResponseTypeRegister {
-		t.Fatalf("Could not register username: got api response: %+v", res)
+
+	mustWriteRequest(t, conn, api.RequestTypePause, nil)
+	mustReadResponseType(t, cli, api.ResponseTypeError)
+
+	mustWriteRequest(t, conn, api.RequestTypeResume, nil)
+	mustReadResponseType(t, cli, api.ResponseTypeResume)
+	if lobby.Paused() {
+		t.Fatal("Lobby was not resumed")
 	}
+
+	mustReadResponseType(t, cli, api.ResponseTypeQuestion)
 }
 
-func mustBroadcastPlayerUpdate(t *testing.T, cli *client.Client, username, action string) {
+// testSpanRecorder records the spans of all tests once registered as the
+// global tracer provider, which can only be delegated to once.
+var testSpanRecorder = sync.OnceValue(func() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+})
+
+// waitSpan returns the first ended span named name matching attrs,
+// waiting for spans ended after the response was read.
+func waitSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string, attrs ...attribute.KeyValue) sdktrace.ReadOnlySpan {
 	t.Helper()
 
-	res, err := cli.ReadResponse()
-	if err != nil {
-		t.Fatalf("Could not read lobby update broadcast: %v", err)
-	}
-	if res.Type != api.ResponseTypePlayerUpdate {
-		t.Fatalf("Could not read lobby update broadcast: got api response: %+v", res)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, span := range recorder.Ended() {
+			if span.Name() == name && hasAttributes(span, attrs) {
+				return span
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
+	t.Fatalf("No %s span with attributes %v", name, attrs)
+	return nil
+}
 
-	data, err := api.DecodeJSON[api.PlayerUpdateResponseData](res.Data)
-	if err != nil {
-		t.Fatalf("Could not decode lobby update broadcast data: %v", data)
-	}
-	if username != data.Username {
-		t.Fatalf("Unexpected username returned in lobby update broadcast: %s", data.Username)
-	}
-	if action != data.Action {
-		t.Fatalf("Unexpected action returned in lobby update broadcast: %s", data.Action)
+func hasAttributes(span sdktrace.ReadOnlySpan, attrs []attribute.KeyValue) bool {
+	for _, want := range attrs {
+		if !slices.Contains(span.Attributes(), want) {
+			return false
+		}
 	}
+	return true
 }
 
-func mustBroadcastConfigure(t *testing.T, cli *client.Client, quiz string) {
-	t.Helper()
+func TestLobbyTracing(t *testing.T) {
+	t.Parallel()
 
-	res, err := cli.ReadResponse()
-	if err != nil {
-		t.Fatalf("Could not read configure broadcast: %v", err)
-	}
-	if res.Type != api.ResponseTypeConfigure {
-		t.Fatalf("Could not read configure broadcast: got api response: %+v", res)
-	}
+	recorder := testSpanRecorder()
 
-	data, err := api.DecodeJSON[api.LobbyUpdateResponseData](res.Data)
-	if err != nil {
-		t.Fatalf("Could not decode configure broadcast data: %v", data)
-	}
-	if quiz != data.Quiz {
-		t.Fatalf("Unexpected quiz returned in configure broadcast: %s", data.Quiz)
+	var (
+		lobbies, lobby = mustRegisterLobby(t, defaultTestLobbyOptions)
+		handler        = handlers.LobbyHandler{
+			Config:        defaultTestConfig,
+			Lobbies:       lobbies,
+			AcceptOptions: defaultTestAcceptOptions,
+		}
+		path = "/lobby/" + lobby.ID()
+	)
+
+	_, cli, _ := mustCreateAndDialTestServer(t, "GET /lobby/{id}", mws.Chain(handler, mws.NewLobby(lobbies)), path)
+
+	wantLobby := defaultTestWantLobby
+	mustRegisterOwner(t, cli, &wantLobby, "owner")
+
+	request := waitSpan(t, recorder, "lobby.request",
+		quiz.AttributeLobbyID.String(lobby.ID()),
+		quiz.AttributeLobbyState.String(quiz.LobbyStateRegister.String()),
+		attribute.String("request.type", string(api.RequestTypeRegister)))
+
+	// The player update broadcast by the register request is a child span.
+	broadcast := waitSpan(t, recorder, "lobby.broadcast",
+		quiz.AttributeLobbyID.String(lobby.ID()),
+		attribute.String("response.type", string(api.ResponseTypePlayerUpdate)))
+	if got, want := broadcast.Parent().SpanID(), request.SpanContext().SpanID(); got != want {
+		t.Errorf("Unexpected broadcast parent span: got %v, want %v", got, want)
 	}
 }
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/quiz"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	maxIdempotencyKeyLength = 255
+	defaultIdempotencyTTL   = time.Minute
+)
+
+// idempotencyKeys remembers the lobby created for each Idempotency-Key
+// so a retried creation returns the same lobby instead of a new one.
+type idempotencyKeys struct {
+	ttl  time.Duration
+	mu   sync.Mutex
+	keys map[string]idempotentLobby
+}
+
+type idempotentLobby struct {
+	res     api.CreateLobbyResponseData
+	expires time.Time
+}
+
+func newIdempotencyKeys(ttl time.Duration) *idempotencyKeys {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &idempotencyKeys{
+		ttl:  ttl,
+		keys: map[string]idempotentLobby{},
+	}
+}
+
+// do returns the response stored for key if its lobby still exists,
+// otherwise it calls create and stores the response on success.
+//
+// Creations are serialized while the lock is held so concurrent retries
+// of the same key cannot both create a lobby. An empty key calls create.
+func (k *idempotencyKeys) do(key string, lobbies quiz.LobbyRepository, create func() (api.CreateLobbyResponseData, error)) (api.CreateLobbyResponseData, error) {
+	if key == "" {
+		return create()
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range k.keys {
+		if now.After(entry.expires) {
+			delete(k.keys, key)
+		}
+	}
+
+	if entry, ok := k.keys[key]; ok {
+		if _, exists := lobbies.Get(entry.res.LobbyID); exists {
+			return entry.res, nil
+		}
+	}
+
+	res, err := create()
+	if err != nil {
+		return res, err
+	}
+	k.keys[key] = idempotentLobby{res: res, expires: now.Add(k.ttl)}
+
+	return res, nil
+}
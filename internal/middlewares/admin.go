@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+	errs "sevenquiz-backend/internal/errors"
+	"strings"
+)
+
+// NewAdmin restricts access to requests bearing the admin token in
+// the Authorization header.
+//
+// An empty token disables admin access entirely.
+func NewAdmin(token []byte) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || len(token) == 0 || subtle.ConstantTimeCompare([]byte(bearer), token) != 1 {
+				errs.WriteHTTPError(ctx, w, errs.UnauthorizedError("invalid admin token"))
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
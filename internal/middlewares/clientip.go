@@ -0,0 +1,60 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// NewClientIP stores the client IP of the request in its context,
+// retrieved with ClientIP.
+//
+// With trustProxy, the last X-Forwarded-For address is used as it is
+// the one appended by the proxy, the others being set by the client.
+// It must only be enabled behind a proxy setting the header, or any
+// client could pick its IP.
+func NewClientIP(trustProxy bool) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := remoteIP(r.RemoteAddr)
+			if trustProxy {
+				if forwarded := forwardedIP(r.Header.Values("X-Forwarded-For")); forwarded != "" {
+					ip = forwarded
+				}
+			}
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ClientIPKey, ip)))
+		})
+	}
+}
+
+// ClientIP returns the client IP stored by NewClientIP, empty if none.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(ClientIPKey).(string)
+	return ip
+}
+
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// forwardedIP returns the last address of X-Forwarded-For headers,
+// empty if it is not a valid IP.
+func forwardedIP(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	last := values[len(values)-1]
+	if i := strings.LastIndexByte(last, ','); i >= 0 {
+		last = last[i+1:]
+	}
+	ip := net.ParseIP(strings.TrimSpace(last))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"net/http"
+	errs "sevenquiz-backend/internal/errors"
+	"sync/atomic"
+)
+
+// Drain is set ahead of a shutdown to refuse new lobbies while the ones
+// in progress are played until their end.
+//
+// The zero value is not draining.
+type Drain struct {
+	draining atomic.Bool
+}
+
+// Set starts or stops draining.
+func (d *Drain) Set(draining bool) {
+	d.draining.Store(draining)
+}
+
+// Toggle flips the drain state and returns the new one.
+func (d *Drain) Toggle() bool {
+	for {
+		draining := d.draining.Load()
+		if d.draining.CompareAndSwap(draining, !draining) {
+			return !draining
+		}
+	}
+}
+
+func (d *Drain) Draining() bool {
+	return d.draining.Load()
+}
+
+// NewDrain rejects the requests with a 503 while draining.
+func NewDrain(drain *Drain) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if drain.Draining() {
+				errs.WriteHTTPError(r.Context(), w, errs.DrainingError())
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
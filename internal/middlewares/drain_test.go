@@ -0,0 +1,37 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	mws "sevenquiz-backend/internal/middlewares"
+	"testing"
+)
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	drain := &mws.Drain{}
+	handler := mws.Chain(ok, mws.NewDrain(drain))
+
+	tests := []struct {
+		draining bool
+		want     int
+	}{
+		{draining: true, want: http.StatusServiceUnavailable},
+		{draining: false, want: http.StatusOK},
+	}
+	for _, tt := range tests { // Sequential as the cases share the drain.
+		if got := drain.Toggle(); got != tt.draining {
+			t.Fatalf("Unexpected toggled drain: got %t, want %t", got, tt.draining)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/lobby", nil))
+		if got := rec.Code; got != tt.want {
+			t.Errorf("Unexpected status code while draining %t: got %d, want %d", tt.draining, got, tt.want)
+		}
+	}
+}
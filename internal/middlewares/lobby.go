@@ -4,8 +4,10 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"sevenquiz-backend/api"
 	errs "sevenquiz-backend/internal/errors"
 	"sevenquiz-backend/internal/quiz"
+	"strings"
 )
 
 type ctxKey int
@@ -16,14 +18,20 @@ const (
 	LobbyStateKey
 	LobbyUsernameKey
 	LobbyRequestKey
+	LobbySpectatorKey
+	LobbyTokenKey
+	ClientIPKey
 )
 
+// RoleSpectator is the role query value used to join a lobby as spectator.
+const RoleSpectator = "spectator"
+
 func NewLobby(lobbies quiz.LobbyRepository) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
 
-			id := r.PathValue("id")
+			id := strings.TrimSpace(r.PathValue("id"))
 			if id == "" {
 				errs.WriteHTTPError(ctx, w, errs.MissingURLQueryError("id"))
 				return
@@ -31,7 +39,7 @@ func NewLobby(lobbies quiz.LobbyRepository) func(http.Handler) http.Handler {
 
 			lobby, ok := lobbies.Get(id)
 			if !ok || lobby == nil {
-				errs.WriteHTTPError(ctx, w, errs.LobbyNotFoundError(id))
+				errs.WriteHTTPError(ctx, w, errs.HTTPLobbyNotFoundError(id))
 				return
 			}
 
@@ -41,15 +49,25 @@ func NewLobby(lobbies quiz.LobbyRepository) func(http.Handler) http.Handler {
 				return
 			}
 
+			// Spectators do not occupy a player slot.
+			spectator := r.URL.Query().Get("role") == RoleSpectator
+
 			switch lobby.State() {
 			case quiz.LobbyStateRegister:
-				if lobby.IsFull() {
-					errs.WriteHTTPError(ctx, w, errs.TooManyPlayersError(lobby.MaxPlayers()))
+				if !spectator && lobby.IsFull() {
+					errs.WriteHTTPError(ctx, w, errs.HTTPTooManyPlayersError(lobby.MaxPlayers()))
 					return
 				}
-			case quiz.LobbyStateQuiz:
-				// TODO: check JWT
-				// TODO: re-assign conn to player
+			case quiz.LobbyStateQuiz, quiz.LobbyStateAnswers:
+				// Reject early a token normalized by the Subprotocols middleware
+				// that was not issued by this lobby. The conn is re-assigned to
+				// its player on login.
+				if token := r.Header.Get("Authorization"); token != "" {
+					if _, err := lobby.CheckToken(token); err != nil {
+						errs.WriteHTTPError(ctx, w, errs.InvalidTokenError(err, api.RequestTypeLogin))
+						return
+					}
+				}
 			}
 
 			// TODO: restitute via token and pass the LobbyPlayerKey to context
@@ -57,6 +75,8 @@ func NewLobby(lobbies quiz.LobbyRepository) func(http.Handler) http.Handler {
 			ctx = context.WithValue(ctx, LobbyKey, lobby)
 			ctx = context.WithValue(ctx, LobbyIDKey, slog.String("lobby_id", lobby.ID()))
 			ctx = context.WithValue(ctx, LobbyStateKey, slog.String("lobby_state", lobby.State().String()))
+			ctx = context.WithValue(ctx, LobbySpectatorKey, spectator)
+			ctx = context.WithValue(ctx, LobbyTokenKey, r.Header.Get("Authorization"))
 
 			h.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -0,0 +1,18 @@
+package middlewares
+
+import (
+	"net/http"
+	errs "sevenquiz-backend/internal/errors"
+)
+
+// Locale localizes the error messages of the request to the language
+// preferred in its Accept-Language header.
+//
+// Browsers send the header along the websocket handshake, so lobby
+// errors are localized for the whole websocket lifetime.
+func Locale(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := errs.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+		h.ServeHTTP(w, r.WithContext(errs.WithLocale(r.Context(), locale)))
+	})
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"net/http"
+	errs "sevenquiz-backend/internal/errors"
+	"sevenquiz-backend/internal/rate"
+)
+
+// NewRateLimit rejects the requests over the limiter limit with a 429
+// and a Retry-After hinting when a slot frees up.
+func NewRateLimit(limiter *rate.Limiter) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.Allow() {
+				errs.WriteHTTPError(r.Context(), w, errs.TooManyRequestsError(limiter.RetryAfter()))
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NewIPRateLimit rejects the requests of a client IP over its limit
+// with a 429, other clients being unaffected. NewClientIP must run
+// first, the requests without client IP sharing a single limiter.
+func NewIPRateLimit(limiters *rate.KeyedLimiter) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			limiter := limiters.Get(ClientIP(ctx))
+			if !limiter.Allow() {
+				errs.WriteHTTPError(ctx, w, errs.RateLimitedError(limiter.RetryAfter()))
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	mws "sevenquiz-backend/internal/middlewares"
+	"sevenquiz-backend/internal/rate"
+	"testing"
+	"time"
+)
+
+func TestIPRateLimit(t *testing.T) {
+	t.Parallel()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	limiters := rate.NewKeyedLimiter(time.Minute, 1)
+
+	tests := []struct {
+		name       string
+		trustProxy bool
+		remoteAddr string
+		forwarded  string
+		want       int
+	}{
+		{name: "first client", remoteAddr: "192.0.2.1:1234", want: http.StatusOK},
+		{name: "first client again", remoteAddr: "192.0.2.1:4321", want: http.StatusTooManyRequests},
+		{name: "second client", remoteAddr: "192.0.2.2:1234", want: http.StatusOK},
+		{name: "spoofed header untrusted", remoteAddr: "192.0.2.1:1234", forwarded: "198.51.100.1", want: http.StatusTooManyRequests},
+		{name: "trusted proxy", trustProxy: true, remoteAddr: "192.0.2.1:1234", forwarded: "203.0.113.7, 198.51.100.1", want: http.StatusOK},
+		{name: "trusted proxy same client", trustProxy: true, remoteAddr: "192.0.2.3:1234", forwarded: "198.51.100.1", want: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests { // Sequential as the cases share limiters.
+		handler := mws.Chain(ok, mws.NewClientIP(tt.trustProxy), mws.NewIPRateLimit(limiters))
+
+		req := httptest.NewRequest(http.MethodPost, "/lobby", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Code; got != tt.want {
+			t.Errorf("%s: unexpected status code: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// Redacted replaces sensitive values in logs.
+const Redacted = "REDACTED"
+
+// LogRedactor masks sensitive request values logged by the http logger.
+//
+// It is meant to be set as slog.HandlerOptions.ReplaceAttr so values are
+// sanitized whatever the logger configuration, while handlers still read
+// the original request.
+type LogRedactor struct {
+	// QueryParams lists the query params to mask, such as the
+	// lobby password.
+	QueryParams []string
+
+	// Headers lists the request headers to mask, such as tokens
+	// smuggled in Sec-WebSocket-Protocol.
+	Headers []string
+}
+
+// DefaultLogRedactor masks the lobby password and bearer tokens.
+var DefaultLogRedactor = LogRedactor{
+	QueryParams: []string{"p"},
+	Headers:     []string{"Authorization", "Sec-WebSocket-Protocol"},
+}
+
+// ReplaceAttr masks the configured query params and headers.
+func (r LogRedactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if slices.Contains(groups, "header") {
+		for _, header := range r.Headers {
+			if http.CanonicalHeaderKey(a.Key) == http.CanonicalHeaderKey(header) {
+				return slog.String(a.Key, Redacted)
+			}
+		}
+		return a
+	}
+	if a.Key == "query" && a.Value.Kind() == slog.KindString {
+		return slog.String(a.Key, r.redactQuery(a.Value.String()))
+	}
+	return a
+}
+
+func (r LogRedactor) redactQuery(raw string) string {
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		// Never log a query that could not be sanitized.
+		return Redacted
+	}
+	redacted := false
+	for _, param := range r.QueryParams {
+		if query.Has(param) {
+			query.Set(param, Redacted)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return raw
+	}
+	return query.Encode()
+}
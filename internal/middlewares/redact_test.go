@@ -0,0 +1,50 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mws "sevenquiz-backend/internal/middlewares"
+
+	sloghttp "github.com/samber/slog-http"
+)
+
+func TestLogRedactor(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: mws.DefaultLogRedactor.ReplaceAttr,
+	}))
+
+	var gotPassword string
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		gotPassword = r.URL.Query().Get("p")
+	})
+	logged := mws.Chain(handler,
+		sloghttp.NewWithConfig(logger, sloghttp.Config{WithRequestHeader: true}),
+		mws.Subprotocols,
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/lobby/abcde?p=hunter2&role=spectator", nil)
+	req.Header.Set("Sec-WebSocket-Protocol", "Bearer mytoken1234")
+	logged.ServeHTTP(httptest.NewRecorder(), req)
+
+	if gotPassword != "hunter2" {
+		t.Errorf("Handler did not receive the original password: %q", gotPassword)
+	}
+
+	out := buf.String()
+	for _, secret := range []string{"hunter2", "mytoken1234"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Log output leaks %q: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "role=spectator") {
+		t.Errorf("Log output lost non sensitive query params: %s", out)
+	}
+}
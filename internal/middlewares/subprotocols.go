@@ -11,18 +11,36 @@ import (
 // This is one way to overcome the Browser clients API not being able to set
 // additional headers in the websocket handshake.
 //
+// Only the first valid bearer token is used, and an Authorization header
+// set by the client takes precedence. Either way the header is left with
+// the bare token, its Bearer scheme stripped.
+//
 // See https://stackoverflow.com/questions/4361173/http-headers-in-websockets-client-api
 func Subprotocols(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		subprotocols := r.Header.Get("Sec-WebSocket-Protocol")
-
-		for _, protocol := range strings.Split(subprotocols, ",") {
-			protocol = strings.TrimSpace(protocol)
-			if strings.HasPrefix(protocol, "Bearer ") {
-				r.Header.Set("Authorization", protocol[7:])
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+				r.Header.Set("Authorization", strings.TrimSpace(token))
 			}
+		} else if token, ok := bearerSubprotocol(r.Header.Values("Sec-WebSocket-Protocol")); ok {
+			r.Header.Set("Authorization", token)
 		}
 
 		h.ServeHTTP(w, r)
 	})
 }
+
+// bearerSubprotocol returns the first bearer token of the offered
+// subprotocols. Empty entries and blank tokens are skipped.
+func bearerSubprotocol(values []string) (string, bool) {
+	for _, value := range values {
+		for _, protocol := range strings.Split(value, ",") {
+			token, ok := strings.CutPrefix(strings.TrimSpace(protocol), "Bearer ")
+			token = strings.TrimSpace(token)
+			if ok && token != "" && !strings.ContainsAny(token, " \t") {
+				return token, true
+			}
+		}
+	}
+	return "", false
+}
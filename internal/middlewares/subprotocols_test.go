@@ -0,0 +1,52 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	mws "sevenquiz-backend/internal/middlewares"
+	"testing"
+)
+
+func TestSubprotocols(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		protocols     []string
+		authorization string
+		want          string
+	}{
+		{name: "no protocol", want: ""},
+		{name: "empty protocol list", protocols: []string{""}, want: ""},
+		{name: "empty entries", protocols: []string{" , ,sevenquiz"}, want: ""},
+		{name: "single bearer", protocols: []string{"sevenquiz, Bearer token1"}, want: "token1"},
+		{name: "multiple bearers", protocols: []string{"Bearer token1, Bearer token2"}, want: "token1"},
+		{name: "multiple headers", protocols: []string{"sevenquiz", "Bearer token1", "Bearer token2"}, want: "token1"},
+		{name: "blank bearer skipped", protocols: []string{"Bearer , Bearer token2"}, want: "token2"},
+		{name: "malformed bearer skipped", protocols: []string{"Bearer to ken1, Bearer token2"}, want: "token2"},
+		{name: "existing authorization", protocols: []string{"Bearer token1"}, authorization: "Bearer token0", want: "token0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got string
+			handler := mws.Subprotocols(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("Authorization")
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/lobby/abcde", nil)
+			for _, protocol := range tt.protocols {
+				req.Header.Add("Sec-WebSocket-Protocol", protocol)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("Unexpected Authorization header: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package quiz
 
 import (
+	crand "crypto/rand"
 	"errors"
-	"fmt"
+	"iter"
+	"maps"
+	"math/rand/v2"
 	"sevenquiz-backend/api"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,9 +27,34 @@ func NewLobbiesCache() LobbyRepository {
 	}
 }
 
-var errNoLobbySlotAvailable = errors.New("no lobby slot available")
+// ErrNoLobbySlotAvailable is returned when no unique lobby id could be
+// generated after all retries.
+var ErrNoLobbySlotAvailable = errors.New("no lobby slot available")
+
+// ErrTooManyLobbies is returned when the maximum amount of registered
+// lobbies is reached.
+var ErrTooManyLobbies = errors.New("too many lobbies")
+
+const (
+	defaultLobbyIDLength = 5
+	maxLobbyIDLength     = 22 // Length of a shortuuid.
+	lobbyIDRetries       = 50
+	lobbyIDGrowthRetries = 10 // Collisions before growing the id length.
+)
 
 type LobbyOptions struct {
+	// IDLength defines the length of the generated lobby id.
+	//
+	// Default is 5.
+	IDLength int
+
+	// MaxIDLength caps the id length growth when collisions are frequent.
+	// On too many collisions, the id length is grown by one until it
+	// reaches MaxIDLength.
+	//
+	// Default is 22, the length of a shortuuid.
+	MaxIDLength int
+
 	// Owner represents the lobby's owner.
 	//
 	// This priviledged user has the rights to start a lobby and credit
@@ -35,18 +64,44 @@ type LobbyOptions struct {
 	Owner string
 
 	// MaxPlayers defines the maximum amount of players allowed to join a lobby.
-	// This limit is reached even with a lobby filled with unregistered users.
+	// This limit is reached even with a lobby filled with unregistered users,
+	// unless CountRegisteredOnly is set.
 	//
 	// Default is set to 25. Negative value means no limit.
 	MaxPlayers int
 
+	// CountRegisteredOnly applies MaxPlayers to the registered players
+	// instead of all the conns, so that conns which never register do not
+	// fill the lobby. Unregistered conns are then bounded by the register
+	// timeout only.
+	//
+	// Default counts all the conns.
+	CountRegisteredOnly bool
+
+	// MaxLobbies caps the amount of lobbies registered at once, this
+	// lobby included. Deleted lobbies free up their slot.
+	//
+	// Default is zero, no limit.
+	MaxLobbies int
+
+	// MinPlayers defines the amount of registered players, owner included,
+	// required to start the quiz. It is capped to MaxPlayers.
+	//
+	// Default is 1.
+	MinPlayers int
+
 	// Quizzes registers all available quizzes to be selected.
 	Quizzes map[string]api.Quiz
 
+	// Quiz selects the quiz loaded at creation.
+	//
+	// Default is the first quiz by name.
+	Quiz string
+
 	// JWTSalt is an optional salt to be used while generating the lobby's jwt key.
 	//
-	// It helps making the key more unique otherwise only a combination of
-	// the ID and timestamp is used.
+	// It is prepended to random bytes drawn for each lobby so tokens can't
+	// be forged from the public lobby id and creation date.
 	JWTSalt []byte
 
 	// RegisterTimeout sets a duration before a lobby expires.
@@ -61,14 +116,84 @@ type LobbyOptions struct {
 	// Default is 45 minutes. Set a negative value to disable it.
 	Timeout time.Duration
 
+	// WriteTimeout bounds each broadcast write to a websocket. A conn
+	// failing to receive a broadcast in time is evicted from the lobby.
+	//
+	// Default is 2 seconds.
+	WriteTimeout time.Duration
+
+	// QueueSize sets the number of broadcasts queued for each conn with
+	// a writer. A conn whose queue is full is evicted from the lobby.
+	//
+	// Default is 64.
+	QueueSize int
+
+	// HistorySize caps the broadcasts recorded to be replayed to players
+	// logging in again.
+	//
+	// Default is 256. Negative value disables the history.
+	HistorySize int
+
+	// StartCountdown delays the first question after the quiz start,
+	// the remaining seconds being broadcasted each second.
+	//
+	// Default is zero, the first question follows the start.
+	StartCountdown time.Duration
+
+	// InterQuestionDelay pauses the quiz between two questions, once the
+	// answer of the previous one is revealed if enabled.
+	//
+	// Default is zero, the next question follows the deadline.
+	InterQuestionDelay time.Duration
+
+	// ResultsHold keeps the lobby open once the results are broadcasted,
+	// for the owner to reset the game and play again.
+	//
+	// Default is zero, the lobby closes along the results.
+	ResultsHold time.Duration
+
+	// QuestionDurations sets the time of questions omitting it, by type.
+	// Durations of the played quiz take precedence over these.
+	//
+	// Types without any duration default to DefaultQuestionTime.
+	QuestionDurations map[api.QuestionType]time.Duration
+
 	// Password sets a lobby password to be check with lobby.CheckPassword().
 	Password string
+
+	// MediaBaseURL is the base URL used to resolve questions media paths.
+	//
+	// Empty value resolves media paths on the current host.
+	MediaBaseURL string
+
+	// Shuffle plays the quiz questions in a random order.
+	//
+	// Default is false, questions are played in file order.
+	Shuffle bool
+
+	// ShuffleChoices presents the choices of each question in a random order.
+	//
+	// Default is false, choices are presented in file order.
+	ShuffleChoices bool
+
+	// RevealAfterEach broadcasts the correct answer of each question
+	// as soon as its deadline passes.
+	//
+	// Default is false, answers are only shown during the review.
+	RevealAfterEach bool
+
+	// Seed sets the seed used to shuffle the quiz questions and choices,
+	// and to pick random quizzes.
+	//
+	// Zero value generates a random seed at lobby creation.
+	Seed int64
 }
 
 type LobbyRepository interface {
 	Register(opts LobbyOptions) (*Lobby, error)
 	Get(id string) (*Lobby, bool)
 	Delete(id string)
+	All() iter.Seq2[string, *Lobby]
 }
 
 // Register tries to register a new lobby and returns an error
@@ -77,32 +202,81 @@ func (l *lobbies) Register(opts LobbyOptions) (*Lobby, error) {
 	if opts.MaxPlayers == 0 {
 		opts.MaxPlayers = 25
 	}
+	if opts.MinPlayers <= 0 {
+		opts.MinPlayers = 1
+	}
+	if opts.MaxPlayers > 0 {
+		opts.MinPlayers = min(opts.MinPlayers, opts.MaxPlayers)
+	}
 	if opts.RegisterTimeout == 0 {
 		opts.RegisterTimeout = 15 * time.Minute
 	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 2 * time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 64
+	}
+	if opts.HistorySize == 0 {
+		opts.HistorySize = 256
+	}
+	if opts.IDLength <= 0 {
+		opts.IDLength = defaultLobbyIDLength
+	}
+	if opts.MaxIDLength <= 0 || opts.MaxIDLength > maxLobbyIDLength {
+		opts.MaxIDLength = maxLobbyIDLength
+	}
+	opts.IDLength = min(opts.IDLength, opts.MaxIDLength)
 
-	id := newLobbyID()
+	id := newLobbyID(opts.IDLength)
 	created := time.Now()
 
+	if opts.Seed == 0 {
+		opts.Seed = created.UnixNano()
+	}
+
 	lobby := &Lobby{
-		id:         id,
-		owner:      opts.Owner,
-		maxPlayers: opts.MaxPlayers,
-		quizzes:    opts.Quizzes,
-		password:   opts.Password,
-		jwtKey:     newLobbyTokenKey(opts.JWTSalt, id, created),
-		players:    map[*websocket.Conn]*Player{},
-		created:    created,
-		state:      LobbyStateCreated,
-		doneCh:     make(chan struct{}),
-		review:     make(chan bool),
+		id:              id,
+		owner:           opts.Owner,
+		maxPlayers:      opts.MaxPlayers,
+		registeredOnly:  opts.CountRegisteredOnly,
+		minPlayers:      opts.MinPlayers,
+		quizzes:         opts.Quizzes,
+		password:        newPasswordHash(opts.Password),
+		mediaURL:        opts.MediaBaseURL,
+		shuffle:         opts.Shuffle,
+		shuffleChoices:  opts.ShuffleChoices,
+		revealAfterEach: opts.RevealAfterEach,
+		seed:            opts.Seed,
+		rand:            rand.New(rand.NewPCG(uint64(opts.Seed), randomQuizStream)), //nolint:gosec
+		writeTimeout:    opts.WriteTimeout,
+		queueSize:       opts.QueueSize,
+		historySize:     opts.HistorySize,
+		startCountdown:  opts.StartCountdown,
+		questionDelay:   opts.InterQuestionDelay,
+		resultsHold:     opts.ResultsHold,
+		durations:       maps.Clone(opts.QuestionDurations),
+		jwtKey:          newLobbyTokenKey(opts.JWTSalt),
+		players:         map[*websocket.Conn]*Player{},
+		spectators:      map[*websocket.Conn]struct{}{},
+		banned:          map[string]struct{}{},
+		outboxes:        map[*websocket.Conn]*outbox{},
+		created:         created,
+		state:           LobbyStateCreated,
+		doneCh:          make(chan struct{}),
+		review:          make(chan bool, 1),
+		pauseCh:         make(chan struct{}, 1),
+		resetCh:         make(chan struct{}),
 	}
 
 	quizzes := lobby.listQuizzes()
 	if len(opts.Quizzes) == 0 {
 		return nil, errors.New("lobby has no quizzes")
 	}
-	q, ok := lobby.LoadQuiz(quizzes[0])
+	if opts.Quiz == "" {
+		opts.Quiz = quizzes[0]
+	}
+	q, ok := lobby.LoadQuiz(opts.Quiz)
 	if !ok {
 		return nil, errors.New("quiz does not exists")
 	}
@@ -114,19 +288,15 @@ func (l *lobbies) Register(opts LobbyOptions) (*Lobby, error) {
 	if l.lobbies == nil {
 		l.lobbies = map[string]*Lobby{}
 	}
-
-	retries := 50
-	for retries > 0 {
-		if _, exist := l.lobbies[lobby.id]; !exist {
-			break
-		}
-		lobby.id = newLobbyID()
-
-		retries--
+	if opts.MaxLobbies > 0 && len(l.lobbies) >= opts.MaxLobbies {
+		return nil, ErrTooManyLobbies
 	}
-	if retries <= 0 {
-		return nil, errNoLobbySlotAvailable
+
+	id, err := l.uniqueLobbyID(lobby.id, opts.IDLength, opts.MaxIDLength)
+	if err != nil {
+		return nil, err
 	}
+	lobby.id = id
 
 	l.lobbies[lobby.id] = lobby
 
@@ -148,34 +318,83 @@ func (l *lobbies) lobbyTimeout(lobby *Lobby, timeout time.Duration) {
 	}
 }
 
-func newLobbyID() string {
+// uniqueLobbyID returns an id not yet registered, starting from id.
+// The id length grows adaptively when collisions are frequent.
+//
+// l.mu must be held by the caller.
+func (l *lobbies) uniqueLobbyID(id string, length, maxLength int) (string, error) {
+	for retries := range lobbyIDRetries {
+		if _, exist := l.lobbies[id]; !exist {
+			return id, nil
+		}
+		if retries > 0 && retries%lobbyIDGrowthRetries == 0 && length < maxLength {
+			length++
+		}
+		id = newLobbyID(length)
+	}
+	return "", ErrNoLobbySlotAvailable
+}
+
+func newLobbyID(length int) string {
 	shortid := shortuuid.New()
-	return shortid[:5]
+	return shortid[:min(length, len(shortid))]
 }
 
-// newLobbyTokenKey creates a dedicated jwt key associated to a lobby.
-func newLobbyTokenKey(secret []byte, id string, created time.Time) []byte {
-	key := fmt.Sprintf("%s%s%d", secret, id, created.Unix())
-	hexkey := fmt.Sprintf("%x", key)
-	return []byte(hexkey)
+const lobbyTokenKeySize = 32
+
+// newLobbyTokenKey creates a dedicated jwt key associated to a lobby,
+// made of the secret followed by random bytes.
+func newLobbyTokenKey(secret []byte) []byte {
+	key := make([]byte, len(secret), len(secret)+lobbyTokenKeySize)
+	copy(key, secret)
+	random := make([]byte, lobbyTokenKeySize)
+	_, _ = crand.Read(random) // Never returns an error.
+	return append(key, random...)
 }
 
-// Get retrieves a lobby by unique id.
+// Get retrieves a lobby by unique id. Surrounding whitespace is ignored
+// as ids are often typed or pasted by players.
 func (l *lobbies) Get(id string) (*Lobby, bool) {
+	id = strings.TrimSpace(id)
+
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 	lobby, ok := l.lobbies[id]
 	return lobby, ok
 }
 
-// Delete closes all lobby conns before deleting it.
+// All returns an iterator over a snapshot of all registered lobbies.
+//
+// The snapshot is taken under lock so the iteration itself does not block
+// lobbies registration or deletion.
+func (l *lobbies) All() iter.Seq2[string, *Lobby] {
+	l.mu.RLock()
+	snapshot := make(map[string]*Lobby, len(l.lobbies))
+	for id, lobby := range l.lobbies {
+		snapshot[id] = lobby
+	}
+	l.mu.RUnlock()
+
+	return func(yield func(string, *Lobby) bool) {
+		for id, lobby := range snapshot {
+			if !yield(id, lobby) {
+				return
+			}
+		}
+	}
+}
+
+// Delete removes a lobby then closes all its conns.
+//
+// The lobby is closed once unlocked as flushing its conns may take up to
+// the write timeout, which must not block the other lobbies.
 func (l *lobbies) Delete(id string) {
 	l.mu.Lock()
-	defer l.mu.Unlock()
+	lobby := l.lobbies[id]
+	delete(l.lobbies, id)
+	l.mu.Unlock()
 
-	if lobby := l.lobbies[id]; lobby != nil {
+	if lobby != nil {
 		_ = lobby.Close()
 	}
-
-	delete(l.lobbies, id)
 }
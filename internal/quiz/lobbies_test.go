@@ -0,0 +1,166 @@
+package quiz_test
+
+import (
+	"errors"
+	"fmt"
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/quiz"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/go-cmp/cmp"
+)
+
+var defaultTestQuizzes = map[string]api.Quiz{
+	"default": {Name: "default"},
+}
+
+func TestLobbiesRegisterIDLength(t *testing.T) {
+	t.Parallel()
+
+	lobbies := quiz.NewLobbiesCache()
+
+	lobby, err := lobbies.Register(quiz.LobbyOptions{
+		IDLength: 8,
+		Quizzes:  defaultTestQuizzes,
+	})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+	t.Cleanup(func() { lobbies.Delete(lobby.ID()) })
+
+	if got, want := len(lobby.ID()), 8; got != want {
+		t.Errorf("Invalid lobby id length, got %d, want %d", got, want)
+	}
+}
+
+func TestLobbiesRegisterIDGrowth(t *testing.T) {
+	t.Parallel()
+
+	lobbies := quiz.NewLobbiesCache()
+
+	// A single char keyspace is exhausted quickly, ids must grow.
+	grown := false
+	for range 200 {
+		lobby, err := lobbies.Register(quiz.LobbyOptions{
+			IDLength: 1,
+			Quizzes:  defaultTestQuizzes,
+		})
+		if err != nil {
+			t.Fatalf("Could not register lobby: %v", err)
+		}
+		t.Cleanup(func() { lobbies.Delete(lobby.ID()) })
+
+		if len(lobby.ID()) > 1 {
+			grown = true
+		}
+	}
+	if !grown {
+		t.Error("Lobby id length did not grow on collisions")
+	}
+}
+
+func TestLobbiesRegisterExhausted(t *testing.T) {
+	t.Parallel()
+
+	lobbies := quiz.NewLobbiesCache()
+
+	// 1000 registrations largely exceed the 57 chars keyspace.
+	for range 1000 {
+		lobby, err := lobbies.Register(quiz.LobbyOptions{
+			IDLength:    1,
+			MaxIDLength: 1,
+			Quizzes:     defaultTestQuizzes,
+		})
+		if err != nil {
+			if !errors.Is(err, quiz.ErrNoLobbySlotAvailable) {
+				t.Fatalf("Unexpected error on exhausted keyspace: %v", err)
+			}
+			return
+		}
+		t.Cleanup(func() { lobbies.Delete(lobby.ID()) })
+
+		if got, want := len(lobby.ID()), 1; got != want {
+			t.Fatalf("Invalid lobby id length, got %d, want %d", got, want)
+		}
+	}
+
+	t.Error("Lobby registration did not fail on exhausted keyspace")
+}
+
+func TestLobbiesAll(t *testing.T) {
+	t.Parallel()
+
+	lobbies := quiz.NewLobbiesCache()
+
+	want := map[string]bool{}
+	for range 5 {
+		lobby, err := lobbies.Register(quiz.LobbyOptions{Quizzes: defaultTestQuizzes})
+		if err != nil {
+			t.Fatalf("Could not register lobby: %v", err)
+		}
+		want[lobby.ID()] = true
+	}
+
+	// The cache is not locked while iterating, lobbies may be deleted
+	// from the loop without deadlocking.
+	visited := map[string]bool{}
+	for id, lobby := range lobbies.All() {
+		if visited[id] {
+			t.Errorf("Lobby %s visited twice", id)
+		}
+		if lobby == nil || lobby.ID() != id {
+			t.Errorf("Unexpected lobby for id %s: %v", id, lobby)
+		}
+		visited[id] = true
+		lobbies.Delete(id)
+	}
+	if diff := cmp.Diff(want, visited); diff != "" {
+		t.Errorf("Unexpected visited lobbies (-want+got):\n%v", diff)
+	}
+
+	for id := range lobbies.All() {
+		t.Errorf("Lobby %s still registered after deletion", id)
+	}
+}
+
+func TestLobbiesRegisterTokenKey(t *testing.T) {
+	t.Parallel()
+
+	lobbies := quiz.NewLobbiesCache()
+
+	lobby, err := lobbies.Register(quiz.LobbyOptions{Quizzes: defaultTestQuizzes})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+	t.Cleanup(func() { lobbies.Delete(lobby.ID()) })
+
+	// The lobby id and creation date are public, a key derived from them
+	// only must not be able to forge an owner token.
+	key := fmt.Sprintf("%x", fmt.Sprintf("%s%d", lobby.ID(), lobby.CreationDate().Unix()))
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"lobbyId": lobby.ID(),
+		"owner":   true,
+	}).SignedString([]byte(key))
+	if err != nil {
+		t.Fatalf("Could not sign forged token: %v", err)
+	}
+
+	if _, err := lobby.CheckToken(forged); err == nil {
+		t.Error("Forged token was accepted")
+	}
+	if lobby.IsOwnerToken(forged) {
+		t.Error("Forged token was granted the ownership")
+	}
+	if lobby.ClaimOwnerConn(nil, forged) {
+		t.Error("Forged token claimed the ownership")
+	}
+
+	token, err := lobby.NewOwnerToken()
+	if err != nil {
+		t.Fatalf("Could not create owner token: %v", err)
+	}
+	if !lobby.IsOwnerToken(token) {
+		t.Error("Owner token was not accepted")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"iter"
+	"maps"
+	"math/rand/v2"
 	"sort"
 	"sync"
 	"time"
@@ -15,6 +17,9 @@ import (
 	"github.com/coder/websocket/wsjson"
 
 	"github.com/golang-jwt/jwt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -47,39 +52,264 @@ func (ls LobbyState) String() string {
 //
 // Multiple goroutines may invoke methods on a Lobby simultaneously.
 type Lobby struct {
-	id         string
-	owner      string
-	maxPlayers int
-	quizzes    map[string]api.Quiz
-	quiz       api.Quiz
-	question   *api.Question
-	password   string
+	id              string
+	owner           string
+	maxPlayers      int
+	minPlayers      int
+	quizzes         map[string]api.Quiz
+	quiz            api.Quiz
+	question        *api.Question
+	password        passwordHash
+	mediaURL        string
+	shuffle         bool
+	shuffleChoices  bool
+	revealAfterEach bool
+	startCountdown  time.Duration
+	questionDelay   time.Duration
+	resultsHold     time.Duration
+	durations       map[api.QuestionType]time.Duration
+	registeredOnly  bool // MaxPlayers only counts registered players.
+	seed            int64
+	rand            *rand.Rand // Picks random quizzes, guarded by mu.
+	writeTimeout    time.Duration
+	queueSize       int
+
+	// ownerReserved is set once an owner token was issued. Ownership
+	// is then only granted to the bearer of that token.
+	ownerReserved bool
+
+	// ownerConn is the conn which presented the owner token on connect.
+	// It is granted the ownership once registered.
+	ownerConn *websocket.Conn
+
+	// banned holds the usernames kicked with a ban, which may not
+	// register again.
+	banned map[string]struct{}
 
 	// players represents all the active players in a lobby.
 	// A LobbyPlayer != nil means a websocket has issued the register cmd.
 	players map[*websocket.Conn]*Player
 
+	// spectators represents websockets watching the lobby without playing.
+	// They receive broadcasts but never occupy a player slot.
+	spectators map[*websocket.Conn]struct{}
+
+	// outboxes holds the queued broadcasts of each conn with a writer.
+	outboxes map[*websocket.Conn]*outbox
+
+	// joinSeq is incremented for each registered player to keep track
+	// of join order.
+	joinSeq uint64
+
+	// seq numbers the broadcasts, the last historySize of them being
+	// recorded in history at the index seq % historySize.
+	seq         uint64
+	history     []Event
+	historySize int
+
 	jwtKey  []byte
 	created time.Time
 	mu      sync.RWMutex
 	state   LobbyState
 	doneCh  chan struct{}
 	review  chan bool
+	paused  bool
+	pauseCh chan struct{} // signals pause state changes
+	resetCh chan struct{} // closed when the game is reset
+
+	// reviewPending is set while the review loop waits for a review.
+	reviewPending bool
+
+	// questionDeadline is when the current question closes, zero while
+	// paused with questionRemaining left.
+	questionDeadline  time.Time
+	questionRemaining time.Duration
+}
+
+// ErrLobbyClosed is returned when a lobby is closed while waiting.
+var ErrLobbyClosed = errors.New("lobby closed")
+
+// Paused returns if the running quiz is paused.
+func (l *Lobby) Paused() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.paused
+}
+
+// SetPaused pauses or resumes the running quiz and returns false
+// if the quiz was already in the requested state.
+func (l *Lobby) SetPaused(paused bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.paused == paused {
+		return false
+	}
+	l.paused = paused
+
+	select {
+	case l.pauseCh <- struct{}{}:
+	default: // A change is already pending, Paused reports the latest state.
+	}
+
+	return true
+}
+
+// WaitQuestion blocks for the duration of a question. The timer is
+// suspended while the quiz is paused and resumes with the remaining
+// duration. It returns ErrLobbyClosed if the lobby is closed meanwhile.
+func (l *Lobby) WaitQuestion(duration time.Duration) error {
+	remaining := duration
+	for remaining > 0 {
+		if l.Paused() {
+			l.setQuestionTimer(time.Time{}, remaining)
+			select {
+			case <-l.doneCh:
+				return ErrLobbyClosed
+			case <-l.pauseCh:
+			}
+			continue
+		}
+
+		start := time.Now()
+		l.setQuestionTimer(start.Add(remaining), 0)
+		timer := time.NewTimer(remaining)
+		select {
+		case <-l.doneCh:
+			timer.Stop()
+			return ErrLobbyClosed
+		case <-timer.C:
+			return nil
+		case <-l.pauseCh:
+			timer.Stop()
+			remaining -= time.Since(start)
+		}
+	}
+	return nil
+}
+
+// ErrNoReviewPending is returned when a review is sent while the
+// review loop is not waiting for one.
+var ErrNoReviewPending = errors.New("no review pending")
+
+// RequestReview marks the lobby as waiting for the owner's review,
+// to be received on NextReview.
+func (l *Lobby) RequestReview() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reviewPending = true
 }
 
-func (l *Lobby) SendReview(validate bool) {
-	l.review <- validate
+// SendReview delivers the owner's review to the review loop without
+// blocking. It returns ErrNoReviewPending if no review was requested.
+func (l *Lobby) SendReview(validate bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.reviewPending {
+		return ErrNoReviewPending
+	}
+	l.reviewPending = false
+	l.review <- validate // Buffered for the single pending review.
+
+	return nil
 }
 
 func (l *Lobby) NextReview() <-chan bool {
 	return l.review
 }
 
+// ErrGameNotOver is returned when resetting a game which did not reach
+// the answers review.
+var ErrGameNotOver = errors.New("game is not over")
+
+// ResetGame sets the lobby back to registration once the quiz is over,
+// keeping the connected players with their answers and scores cleared
+// so that the same players can play again. Players who left during the
+// game are removed.
+//
+// The channel returned by GameReset before the reset is closed.
+func (l *Lobby) ResetGame() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.state != LobbyStateAnswers {
+		return ErrGameNotOver
+	}
+
+	for conn, p := range l.players {
+		if p == nil { // Connected, it may still register.
+			continue
+		}
+		if !p.Alive() {
+			delete(l.players, conn) // Closed on disconnect already.
+			if conn == l.ownerConn {
+				l.ownerConn = nil
+			}
+			continue
+		}
+		p.reset()
+	}
+	l.question = nil
+	l.questionDeadline, l.questionRemaining = time.Time{}, 0
+	l.paused = false
+	l.reviewPending = false
+	select {
+	case <-l.review: // Drop a review sent to the aborted review loop.
+	default:
+	}
+	l.state = LobbyStateRegister
+
+	close(l.resetCh)
+	l.resetCh = make(chan struct{})
+
+	return nil
+}
+
+// GameReset returns a channel closed once the current game is reset.
+func (l *Lobby) GameReset() <-chan struct{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.resetCh
+}
+
+// EndGame closes the lobby once its game is over, unless the game was
+// reset meanwhile. It reports if the lobby was closed.
+func (l *Lobby) EndGame() bool {
+	l.mu.Lock()
+	if l.state != LobbyStateAnswers {
+		l.mu.Unlock()
+		return false
+	}
+	l.state = LobbyStateEnded // ResetGame may not race the close.
+	l.mu.Unlock()
+
+	_ = l.Close()
+
+	return true
+}
+
+// ResultsHold returns how long the lobby stays open once the results
+// are broadcasted, for the game to be reset.
+func (l *Lobby) ResultsHold() time.Duration {
+	return l.resultsHold
+}
+
 // Close shutdowns a lobby and closes all registered websockets.
+// Closing an already closed lobby is a no-op.
 func (l *Lobby) Close() error {
+	// Flush pending broadcasts, such as the closing reason, first.
+	l.stopWriters()
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	select {
+	case <-l.doneCh:
+		return nil
+	default:
+	}
+
 	l.state = LobbyStateEnded
 
 	var err error
@@ -91,6 +321,12 @@ func (l *Lobby) Close() error {
 			}
 		}
 	}
+	for c := range l.spectators {
+		err2 := c.Close(websocket.StatusNormalClosure, "lobby closes")
+		if err == nil && err2 != nil {
+			err = err2
+		}
+	}
 
 	close(l.doneCh)
 
@@ -144,17 +380,22 @@ func (l *Lobby) SetOwner(username string) {
 func (l *Lobby) CheckPassword(password string) bool {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	if l.password == "" {
-		return true
-	}
-	return password == l.password
+	return l.password.check(password)
+}
+
+// HasPassword returns if the lobby is password protected.
+func (l *Lobby) HasPassword() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.password.isSet()
 }
 
-// SetPassword sets a lobby password.
+// SetPassword sets a lobby password. Only its salted hash is kept.
+// An empty password removes the lobby protection.
 func (l *Lobby) SetPassword(password string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.password = password
+	l.password = newPasswordHash(password)
 }
 
 // State returns the current lobby state.
@@ -171,11 +412,39 @@ func (l *Lobby) SetState(state LobbyState) {
 	l.state = state
 }
 
-// SetCurrentQuestion updates a lobby question.
+// SetCurrentQuestion updates a lobby question. Its time starts running
+// until refined by WaitQuestion.
 func (l *Lobby) SetCurrentQuestion(question *api.Question) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	l.question = question
+	l.questionDeadline, l.questionRemaining = time.Time{}, 0
+	if question != nil {
+		l.questionDeadline = time.Now().Add(question.Time)
+	}
+}
+
+// QuestionRemaining returns the time left to answer the current
+// question, zero if none is in progress.
+func (l *Lobby) QuestionRemaining() time.Duration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.question == nil {
+		return 0
+	}
+	if l.questionDeadline.IsZero() {
+		return l.questionRemaining
+	}
+	return max(time.Until(l.questionDeadline), 0)
+}
+
+// setQuestionTimer records the current question timer, either running
+// until deadline or paused with remaining left.
+func (l *Lobby) setQuestionTimer(deadline time.Time, remaining time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.questionDeadline, l.questionRemaining = deadline, remaining
 }
 
 func (l *Lobby) CurrentQuestion() *api.Question {
@@ -184,6 +453,117 @@ func (l *Lobby) CurrentQuestion() *api.Question {
 	return l.question
 }
 
+// Shuffle returns if the quiz questions are played in a random order.
+func (l *Lobby) Shuffle() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.shuffle
+}
+
+// SetShuffle enables or disables the quiz questions shuffling.
+func (l *Lobby) SetShuffle(shuffle bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.shuffle = shuffle
+}
+
+// ShuffleChoices returns if questions choices are presented in a random order.
+func (l *Lobby) ShuffleChoices() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.shuffleChoices
+}
+
+// SetShuffleChoices enables or disables the questions choices shuffling.
+func (l *Lobby) SetShuffleChoices(shuffle bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.shuffleChoices = shuffle
+}
+
+// DefaultQuestionTime is the time of questions omitting it when neither
+// the quiz nor the lobby sets a duration for their type.
+const DefaultQuestionTime = 30 * time.Second
+
+// QuestionTime returns the time given to answer question. Questions
+// omitting it get the duration of their type set by the quiz, then by
+// the lobby options, then DefaultQuestionTime.
+func (l *Lobby) QuestionTime(question api.Question) time.Duration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.questionTime(question)
+}
+
+func (l *Lobby) questionTime(question api.Question) time.Duration {
+	if question.Time > 0 {
+		return question.Time
+	}
+	if d, ok := l.quiz.Durations[question.Type]; ok && d > 0 {
+		return d
+	}
+	if d, ok := l.durations[question.Type]; ok && d > 0 {
+		return d
+	}
+
+	return DefaultQuestionTime
+}
+
+// EstimatedDuration returns how long playing the lobby quiz takes, from
+// the start countdown to the last question deadline. Pauses and the
+// review are left out.
+func (l *Lobby) EstimatedDuration() time.Duration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.quiz.Questions) == 0 {
+		return 0
+	}
+
+	d := l.startCountdown + time.Duration(len(l.quiz.Questions)-1)*l.questionDelay
+	for _, question := range l.quiz.Questions {
+		d += l.questionTime(question)
+	}
+
+	return d
+}
+
+// StartCountdown returns the delay between the quiz start and the first
+// question.
+func (l *Lobby) StartCountdown() time.Duration {
+	return l.startCountdown
+}
+
+// InterQuestionDelay returns the delay between the deadline of a question
+// and the next one.
+func (l *Lobby) InterQuestionDelay() time.Duration {
+	return l.questionDelay
+}
+
+// RevealAfterEach returns if answers are revealed after each question.
+func (l *Lobby) RevealAfterEach() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.revealAfterEach
+}
+
+// SetRevealAfterEach enables or disables revealing answers after each question.
+func (l *Lobby) SetRevealAfterEach(reveal bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.revealAfterEach = reveal
+}
+
+// Seed returns the lobby seed used to shuffle questions and choices.
+func (l *Lobby) Seed() int64 {
+	return l.seed
+}
+
+// MediaBaseURL returns the base URL used to resolve questions media paths.
+func (l *Lobby) MediaBaseURL() string {
+	return l.mediaURL
+}
+
 // CreationDate returns when a lobby was originally created.
 func (l *Lobby) CreationDate() time.Time {
 	return l.created
@@ -191,32 +571,117 @@ func (l *Lobby) CreationDate() time.Time {
 
 // MaxPlayers returns the maximum allowed players in a lobby.
 func (l *Lobby) MaxPlayers() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	return l.maxPlayers
 }
 
+// ErrMaxPlayersTooLow is returned when setting a maximum of players below
+// the slots taken in the lobby or the players required to start it.
+var ErrMaxPlayersTooLow = errors.New("maximum players too low")
+
+// SetMaxPlayers sets the maximum allowed players in a lobby. It can not
+// be lowered below the slots already taken nor MinPlayers.
+func (l *Lobby) SetMaxPlayers(maxPlayers int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if maxPlayers < l.numSlots() || maxPlayers < l.minPlayers {
+		return ErrMaxPlayersTooLow
+	}
+	l.maxPlayers = maxPlayers
+
+	return nil
+}
+
+// MinPlayers returns the amount of players required to start a lobby.
+func (l *Lobby) MinPlayers() int {
+	return l.minPlayers
+}
+
+// Quiz returns a copy of the lobby's quiz, safe to be modified.
 func (l *Lobby) Quiz() api.Quiz {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	return l.quiz
+	return l.quiz.Clone()
 }
 
+// SetQuiz sets a copy of quiz as the lobby's quiz.
 func (l *Lobby) SetQuiz(quiz api.Quiz) {
+	quiz = quiz.Clone()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.quiz = quiz
+}
+
+// ErrQuizLocked is returned when changing the quiz of a lobby which is
+// not registering players anymore.
+var ErrQuizLocked = errors.New("quiz can only be changed while registering")
+
+// ChangeQuiz replaces the lobby quiz while registering players. Any
+// lingering question and recorded answers are reset since they refer
+// to the previous quiz.
+func (l *Lobby) ChangeQuiz(quiz api.Quiz) error {
+	quiz = quiz.Clone()
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
+
+	if l.state != LobbyStateCreated && l.state != LobbyStateRegister {
+		return ErrQuizLocked
+	}
 	l.quiz = quiz
+	l.question = nil
+	for _, p := range l.players {
+		if p != nil {
+			p.ClearAnswers()
+		}
+	}
+
+	return nil
 }
 
+// LoadQuiz returns a copy of an available quiz. Available quizzes are
+// shared between lobbies and never modified.
 func (l *Lobby) LoadQuiz(quiz string) (api.Quiz, bool) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 	q, ok := l.quizzes[quiz]
-	return q, ok
+	return q.Clone(), ok
+}
+
+// randomQuizStream is the PCG stream of the lobby random quiz picks,
+// apart from the shuffles streams.
+const randomQuizStream = 1 << 32
+
+// RandomQuiz picks one of the lobby quizzes at random and returns it
+// along its name. Picks follow the lobby seed to be reproducible.
+func (l *Lobby) RandomQuiz() (string, api.Quiz) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	quizzes := l.listQuizzes()
+	name := quizzes[l.rand.IntN(len(quizzes))]
+
+	return name, l.quizzes[name].Clone()
 }
 
 func (l *Lobby) ListQuizzes() []string {
 	return l.listQuizzes()
 }
 
+// ListQuizInfo returns the metadata of each lobby quiz keyed by name.
+func (l *Lobby) ListQuizInfo() map[string]api.QuizInfo {
+	infos := make(map[string]api.QuizInfo, len(l.quizzes))
+	for name, quiz := range l.quizzes {
+		info := quiz.QuizInfo
+		info.QuestionCount = len(quiz.Questions)
+		infos[name] = info
+	}
+	return infos
+}
+
 func (l *Lobby) listQuizzes() []string {
 	quizzes := make([]string, 0, len(l.quizzes))
 
@@ -234,7 +699,22 @@ func (l *Lobby) listQuizzes() []string {
 func (l *Lobby) IsFull() bool {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	return l.maxPlayers >= 0 && l.numConns() >= l.maxPlayers
+	return l.maxPlayers >= 0 && l.numSlots() >= l.maxPlayers
+}
+
+// CanRegister reports if a player slot is left for a conn to register.
+func (l *Lobby) CanRegister() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.maxPlayers < 0 || l.numPlayers() < l.maxPlayers
+}
+
+// numSlots returns the slots taken against MaxPlayers.
+func (l *Lobby) numSlots() int {
+	if l.registeredOnly {
+		return l.numPlayers()
+	}
+	return l.numConns()
 }
 
 // NumConns returns the number of websockets registered in a lobby.
@@ -248,6 +728,23 @@ func (l *Lobby) numConns() int {
 	return len(l.players)
 }
 
+// NumPlayers returns the number of registered players still connected.
+func (l *Lobby) NumPlayers() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.numPlayers()
+}
+
+func (l *Lobby) numPlayers() int {
+	n := 0
+	for _, p := range l.players {
+		if p != nil && p.Alive() {
+			n++
+		}
+	}
+	return n
+}
+
 // GetPlayer finds a user by username and returns his associated websocket.
 // A third return value specifies if a player was found.
 func (l *Lobby) GetPlayer(username string) (*websocket.Conn, *Player, bool) {
@@ -286,6 +783,32 @@ func (l *Lobby) GetPlayerList() []string {
 	return players
 }
 
+// NextOwnerCandidate returns the earliest joined alive player other
+// than the current owner.
+// A second return value specifies if a candidate was found.
+func (l *Lobby) NextOwnerCandidate() (string, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.nextOwnerCandidate()
+}
+
+func (l *Lobby) nextOwnerCandidate() (string, bool) {
+	var candidate *Player
+	for _, player := range l.players {
+		if player == nil || !player.Alive() || player.username == l.owner {
+			continue
+		}
+		if candidate == nil || player.joined < candidate.joined {
+			candidate = player
+		}
+	}
+	if candidate == nil {
+		return "", false
+	}
+
+	return candidate.username, true
+}
+
 // GetPlayerByConn finds a player by his associated websocket.
 // A second return value specifies if the conn was associated to a lobby player.
 func (l *Lobby) GetPlayerByConn(conn *websocket.Conn) (*Player, bool) {
@@ -295,51 +818,186 @@ func (l *Lobby) GetPlayerByConn(conn *websocket.Conn) (*Player, bool) {
 	return c, ok
 }
 
-// AddPlayerWithConn registers a conn to a lobby player.
+// AddPlayerWithConn registers a conn to a solo lobby player.
 func (l *Lobby) AddPlayerWithConn(conn *websocket.Conn, username string) *Player {
+	return l.AddPlayerWithTeam(conn, username, "")
+}
+
+// AddPlayerWithTeam registers a conn to a lobby player member of team.
+// An empty team registers a solo player.
+func (l *Lobby) AddPlayerWithTeam(conn *websocket.Conn, username, team string) *Player {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	cli := &Player{username: username, alive: true, answers: map[int]api.Answer{}}
+	l.joinSeq++
+
+	cli := NewPlayer(username)
+	cli.team, cli.joined = team, l.joinSeq
 	l.players[conn] = cli
 
 	return cli
 }
 
-// AddConn registers a new websocket in the lobby that is not associated
-// to a lobby player yet.
-func (l *Lobby) AddConn(conn *websocket.Conn) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.players[conn] = nil
+// GetPlayerTeams returns the team of each lobby player with a team.
+// It returns nil if all players are playing solo.
+func (l *Lobby) GetPlayerTeams() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var teams map[string]string
+	for _, player := range l.players {
+		if player == nil || player.team == "" {
+			continue
+		}
+		if teams == nil {
+			teams = map[string]string{}
+		}
+		teams[player.username] = player.team
+	}
+
+	return teams
 }
 
-func (l *Lobby) AllPlayers() iter.Seq2[*websocket.Conn, *Player] {
+// ComputeResults returns the score of each lobby player.
+//
+// A player scores the points of each answer given by ScoreAnswer, added
+// to the points credited by the owner during the review.
+// Scores of players with a team are also summed per team.
+func (l *Lobby) ComputeResults() api.ResultsResponseData {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	return l.allPlayers()
+
+	results := api.ResultsResponseData{Results: map[string]float64{}}
+	for _, player := range l.allPlayers() {
+		if player == nil {
+			continue
+		}
+		score := l.playerScore(player)
+		results.Results[player.username] = roundPoints(score)
+		if player.team == "" {
+			continue
+		}
+		if results.Teams == nil {
+			results.Teams = map[string]float64{}
+		}
+		results.Teams[player.team] = roundPoints(results.Teams[player.team] + score)
+	}
+	results.Leaderboard = Leaderboard(results.Results)
+
+	return results
 }
 
-func (l *Lobby) allPlayers() iter.Seq2[*websocket.Conn, *Player] {
-	return func(yield func(*websocket.Conn, *Player) bool) {
-		for i, v := range l.players {
-			if i == nil {
-				continue
-			}
-			if !yield(i, v) {
-				return
-			}
+// playerScore returns the points credited by the owner to player added
+// to the points of each answer given by ScoreAnswer.
+//
+// l.mu must be held by the caller.
+func (l *Lobby) playerScore(player *Player) float64 {
+	score := float64(player.Score())
+	for _, question := range l.quiz.Questions {
+		if answer, ok := player.LookupAnswer(question.ID); ok {
+			score += ScoreAnswer(question, answer)
 		}
 	}
+	return score
 }
 
-// BroadcastPlayerUpdate broadcast a player event to all players
-// and websockets active in the lobby.
-func (l *Lobby) BroadcastPlayerUpdate(ctx context.Context, username, action string) error {
-	return l.Broadcast(ctx, func(_ *Player) any {
-		return api.Response[api.PlayerUpdateResponseData]{
-			Type: api.ResponseTypePlayerUpdate,
-			Data: api.PlayerUpdateResponseData{
+// ExportResults returns the computed results of the lobby quiz along
+// whether each player answered each question correctly.
+func (l *Lobby) ExportResults() api.LobbyResultsResponseData {
+	q := l.Quiz()
+
+	res := api.LobbyResultsResponseData{
+		ResultsResponseData: l.ComputeResults(),
+		Quiz:                q.Name,
+		Questions:           make([]api.QuestionResult, 0, len(q.Questions)),
+	}
+	for _, question := range q.Questions {
+		res.Questions = append(res.Questions, api.QuestionResult{
+			ID:      question.ID,
+			Title:   question.Title,
+			Correct: l.answersCorrectness(question),
+		})
+	}
+
+	return res
+}
+
+// Leaderboard returns the players ranked by their current results.
+func (l *Lobby) Leaderboard() []api.LeaderboardEntry {
+	return l.ComputeResults().Leaderboard
+}
+
+// AddConn registers a new websocket in the lobby that is not associated
+// to a lobby player yet.
+func (l *Lobby) AddConn(conn *websocket.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.players[conn] = nil
+}
+
+// AddSpectator registers a new websocket watching the lobby.
+// Spectators are not counted as players and cannot register.
+func (l *Lobby) AddSpectator(conn *websocket.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.spectators[conn] = struct{}{}
+}
+
+// DeleteSpectator removes a spectator websocket from the lobby.
+func (l *Lobby) DeleteSpectator(conn *websocket.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.spectators, conn)
+}
+
+// IsSpectator returns true if conn is watching the lobby as a spectator.
+func (l *Lobby) IsSpectator(conn *websocket.Conn) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.spectators[conn]
+	return ok
+}
+
+// NumSpectators returns the number of spectators watching a lobby.
+func (l *Lobby) NumSpectators() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.spectators)
+}
+
+// AllPlayers returns an iterator over a snapshot of the lobby conns and
+// their player, nil if not registered yet.
+//
+// The snapshot is taken under lock so the iteration may block, e.g. on
+// reviews, while players join or the game is reset.
+func (l *Lobby) AllPlayers() iter.Seq2[*websocket.Conn, *Player] {
+	l.mu.RLock()
+	snapshot := maps.Collect(l.allPlayers())
+	l.mu.RUnlock()
+
+	return maps.All(snapshot)
+}
+
+func (l *Lobby) allPlayers() iter.Seq2[*websocket.Conn, *Player] {
+	return func(yield func(*websocket.Conn, *Player) bool) {
+		for i, v := range l.players {
+			if i == nil {
+				continue
+			}
+			if !yield(i, v) {
+				return
+			}
+		}
+	}
+}
+
+// BroadcastPlayerUpdate broadcast a player event to all players
+// and websockets active in the lobby.
+func (l *Lobby) BroadcastPlayerUpdate(ctx context.Context, username, action string) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
+		return api.Response[api.PlayerUpdateResponseData]{
+			Type: api.ResponseTypePlayerUpdate,
+			Data: api.PlayerUpdateResponseData{
 				Username: username,
 				Action:   action,
 			},
@@ -347,81 +1005,494 @@ func (l *Lobby) BroadcastPlayerUpdate(ctx context.Context, username, action stri
 	})
 }
 
-func (l *Lobby) BroadcastConfigure(ctx context.Context, quiz string) error {
-	return l.Broadcast(ctx, func(_ *Player) any {
+// GetPlayerScores returns the current score of each alive player,
+// computed the same way as ComputeResults.
+func (l *Lobby) GetPlayerScores() map[string]float64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	scores := make(map[string]float64, l.numConns())
+	for _, player := range l.players {
+		if player == nil || !player.Alive() {
+			continue
+		}
+		scores[player.username] = roundPoints(l.playerScore(player))
+	}
+
+	return scores
+}
+
+// GetPlayerPresence returns if each registered player is connected,
+// including players away during the quiz.
+func (l *Lobby) GetPlayerPresence() map[string]bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	presence := make(map[string]bool, l.numConns())
+	for _, player := range l.players {
+		if player == nil {
+			continue
+		}
+		presence[player.username] = player.Alive()
+	}
+
+	return presence
+}
+
+// BroadcastPlayerKick broadcast a kicked player and the kick reason.
+func (l *Lobby) BroadcastPlayerKick(ctx context.Context, username, reason string) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
+		return api.Response[api.PlayerUpdateResponseData]{
+			Type: api.ResponseTypePlayerUpdate,
+			Data: api.PlayerUpdateResponseData{
+				Username: username,
+				Action:   "kick",
+				Reason:   reason,
+			},
+		}
+	})
+}
+
+// BroadcastPlayerList broadcast the authoritative player list, scores and
+// presence to all players and websockets active in the lobby.
+func (l *Lobby) BroadcastPlayerList(ctx context.Context) error {
+	data := api.PlayerListResponseData{
+		PlayerList: l.GetPlayerList(),
+		Scores:     l.GetPlayerScores(),
+		Alive:      l.GetPlayerPresence(),
+	}
+	return l.broadcastEvent(ctx, func(_ *Player) any {
+		return api.Response[api.PlayerListResponseData]{
+			Type: api.ResponseTypePlayerList,
+			Data: data,
+		}
+	})
+}
+
+// BroadcastPlayerJoin broadcast a newly registered player and his team
+// to all players and websockets active in the lobby.
+func (l *Lobby) BroadcastPlayerJoin(ctx context.Context, username, team string) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
+		return api.Response[api.PlayerUpdateResponseData]{
+			Type: api.ResponseTypePlayerUpdate,
+			Data: api.PlayerUpdateResponseData{
+				Username: username,
+				Team:     team,
+				Action:   "join",
+			},
+		}
+	})
+}
+
+// BroadcastConfigure broadcast the lobby settings changed by the owner.
+func (l *Lobby) BroadcastConfigure(ctx context.Context, update api.LobbyUpdateResponseData) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
 		return api.Response[api.LobbyUpdateResponseData]{
 			Type: api.ResponseTypeConfigure,
-			Data: api.LobbyUpdateResponseData{
-				Quiz: quiz,
+			Data: update,
+		}
+	})
+}
+
+// BroadcastCountdown broadcasts the seconds remaining before the first question.
+func (l *Lobby) BroadcastCountdown(ctx context.Context, remaining int) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
+		return api.Response[api.CountdownResponseData]{
+			Type: api.ResponseTypeCountdown,
+			Data: api.CountdownResponseData{
+				Remaining: remaining,
 			},
 		}
 	})
 }
 
-func (l *Lobby) BroadcastQuestion(ctx context.Context, question api.Question) error {
-	return l.Broadcast(ctx, func(_ *Player) any {
+// BroadcastQuestion broadcast a question along its progress out of the
+// total questions played.
+func (l *Lobby) BroadcastQuestion(ctx context.Context, question api.Question, total int) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
 		return api.Response[api.QuestionResponseData]{
 			Type: api.ResponseTypeQuestion,
 			Data: api.QuestionResponseData{
 				Question: question,
+				Index:    question.ID,
+				Total:    total,
+			},
+		}
+	})
+}
+
+// BroadcastQuizEnd broadcast the end of the quiz, once the last of the
+// played questions closed and before the review starts.
+func (l *Lobby) BroadcastQuizEnd(ctx context.Context, questions int) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
+		return api.Response[api.QuizEndResponseData]{
+			Type: api.ResponseTypeQuizEnd,
+			Data: api.QuizEndResponseData{
+				Questions: questions,
+				Next:      "review",
 			},
 		}
 	})
 }
 
-func (l *Lobby) BroadcastReview(ctx context.Context, question api.Question, player string, answer api.Answer) error {
-	return l.Broadcast(ctx, func(_ *Player) any {
+// BroadcastReview broadcast a player answer to review. Answers already
+// validated are only shown and must not be reviewed by the owner.
+func (l *Lobby) BroadcastReview(ctx context.Context, question api.Question, player string, answer api.Answer, validated bool) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
 		return api.Response[api.ReviewResponseData]{
 			Type: api.ResponseTypeReview,
 			Data: api.ReviewResponseData{
-				Question: question,
-				Player:   player,
-				Answer:   answer,
+				Question:  question,
+				Player:    player,
+				Answer:    answer,
+				Validated: validated,
 			},
 		}
 	})
 }
 
-func (l *Lobby) BroadcastResults(ctx context.Context, results map[string]int) error {
-	return l.Broadcast(ctx, func(_ *Player) any {
+// BroadcastAnswerReveal broadcast the correct answer of a closed question
+// and whether each player answered it correctly.
+func (l *Lobby) BroadcastAnswerReveal(ctx context.Context, question api.Question) error {
+	data := api.AnswerRevealResponseData{
+		QuestionID: question.ID,
+		Correct:    l.answersCorrectness(question),
+	}
+	if question.Answer != nil {
+		data.Answer = *question.Answer
+	}
+	return l.broadcastEvent(ctx, func(_ *Player) any {
+		return api.Response[api.AnswerRevealResponseData]{
+			Type: api.ResponseTypeAnswerReveal,
+			Data: data,
+		}
+	})
+}
+
+func (l *Lobby) answersCorrectness(question api.Question) map[string]bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	correct := make(map[string]bool, l.numConns())
+	for _, player := range l.players {
+		if player == nil {
+			continue
+		}
+		answer, ok := player.LookupAnswer(question.ID)
+		correct[player.username] = ok && ValidateAnswer(question, answer)
+	}
+
+	return correct
+}
+
+// BroadcastPause notifies all websockets the quiz was paused or resumed
+// so clients can freeze their timers.
+func (l *Lobby) BroadcastPause(ctx context.Context, paused bool) error {
+	resType := api.ResponseTypeResume
+	if paused {
+		resType = api.ResponseTypePause
+	}
+	return l.broadcastEvent(ctx, func(_ *Player) any {
+		return api.Response[api.EmptyResponseData]{
+			Type: resType,
+		}
+	})
+}
+
+// BroadcastReset notifies all websockets the game was reset so clients
+// return to the lobby.
+func (l *Lobby) BroadcastReset(ctx context.Context) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
+		return api.Response[api.EmptyResponseData]{
+			Type: api.ResponseTypeReset,
+		}
+	})
+}
+
+func (l *Lobby) BroadcastResults(ctx context.Context, results api.ResultsResponseData) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
 		return api.Response[api.ResultsResponseData]{
 			Type: api.ResponseTypeResults,
-			Data: api.ResultsResponseData{
-				Results: results,
+			Data: results,
+		}
+	})
+}
+
+// BroadcastClosed notifies all websockets the lobby is about to be closed.
+func (l *Lobby) BroadcastClosed(ctx context.Context, reason string) error {
+	return l.broadcastEvent(ctx, func(_ *Player) any {
+		return api.Response[api.LobbyClosedResponseData]{
+			Type: api.ResponseTypeLobbyClosed,
+			Data: api.LobbyClosedResponseData{
+				Reason: reason,
 			},
 		}
 	})
 }
 
+// Broadcast sends the result of fn to all websockets in the lobby.
+// Spectators are included and fn is called with a nil player for them.
+//
+// Messages are neither numbered nor recorded in the lobby history, unlike
+// those of the lobby broadcast methods.
+//
+// Recipients are snapshotted under lock and written to without holding
+// it, so a slow client never blocks the lobby mutations.
+//
+// Broadcasts to conns with a writer are queued, see StartWriter. Other
+// conns are written to directly, each write bounded by the lobby write
+// timeout. A conn failing to receive the broadcast, or whose queue is
+// full, is evicted so it does not degrade the others.
 func (l *Lobby) Broadcast(ctx context.Context, fn func(player *Player) any) error {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-
 	errs := errgroup.Group{}
-	for conn, player := range l.allPlayers() {
+	for _, r := range l.recipients() {
 		errs.Go(func() error {
-			res := fn(player)
-			err := wsjson.Write(ctx, conn, res)
-			if err != nil && player != nil {
-				err = fmt.Errorf("%s: %w", player.username, err)
+			err := l.send(ctx, r, fn(r.player))
+			if err == nil {
+				return nil
+			}
+			if ctx.Err() == nil { // The conn failed, not the broadcast.
+				l.evict(r)
+			}
+			if r.player != nil {
+				err = fmt.Errorf("%s: %w", r.player.Username(), err)
 			}
 			return err
 		})
 	}
-
 	return errs.Wait()
 }
 
-func (l *Lobby) BroadcastStart(ctx context.Context) error {
-	return l.Broadcast(ctx, func(player *Player) any {
+// broadcastEvent numbers the broadcast of fn and records it in the lobby
+// history. The recorded message is the one of spectators, fn(nil), so the
+// history never holds the data of a single player.
+func (l *Lobby) broadcastEvent(ctx context.Context, fn func(player *Player) any) error {
+	msg := fn(nil)
+
+	ctx, span := tracer.Start(ctx, "lobby.broadcast", trace.WithAttributes(l.SpanAttributes()...))
+	defer span.End()
+	if t, ok := msg.(typed); ok {
+		span.SetAttributes(attribute.String("response.type", string(t.ResponseType())))
+	}
+
+	seq := l.record(msg)
+	err := l.Broadcast(ctx, func(player *Player) any {
+		return withSeq(fn(player), seq)
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "broadcast failed")
+	}
+	return err
+}
+
+// Event is a broadcast recorded in the lobby history.
+type Event struct {
+	Seq     uint64
+	Message any
+}
+
+// typed is implemented by broadcast messages exposing their type.
+type typed interface {
+	ResponseType() api.ResponseType
+}
+
+// sequenced is implemented by broadcast messages carrying their seq.
+type sequenced interface {
+	WithSeq(seq uint64) any
+}
+
+func withSeq(msg any, seq uint64) any {
+	if s, ok := msg.(sequenced); ok {
+		return s.WithSeq(seq)
+	}
+	return msg
+}
+
+// record numbers a broadcast and adds msg to the history, overwriting
+// the oldest event once the history is full.
+func (l *Lobby) record(msg any) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	if l.historySize > 0 {
+		if l.history == nil {
+			l.history = make([]Event, l.historySize)
+		}
+		l.history[l.seq%uint64(l.historySize)] = Event{Seq: l.seq, Message: withSeq(msg, l.seq)}
+	}
+
+	return l.seq
+}
+
+// History returns the recorded broadcasts following seq, oldest first.
+// Broadcasts overwritten in the bounded history are missing.
+func (l *Lobby) History(seq uint64) []Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.historySize <= 0 || seq >= l.seq {
+		return nil
+	}
+	first := seq + 1
+	if size := uint64(l.historySize); l.seq > size {
+		first = max(first, l.seq-size+1)
+	}
+
+	events := make([]Event, 0, l.seq-first+1)
+	for s := first; s <= l.seq; s++ {
+		events = append(events, l.history[s%uint64(l.historySize)])
+	}
+
+	return events
+}
+
+// Replay writes the recorded broadcasts following seq to conn.
+//
+// Events are written directly, not queued, so broadcasts made during the
+// replay may be received in between. Clients order events by their seq.
+func (l *Lobby) Replay(ctx context.Context, conn *websocket.Conn, seq uint64) error {
+	r := recipient{conn: conn}
+	for _, event := range l.History(seq) {
+		if err := l.send(ctx, r, event.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Lobby) send(ctx context.Context, r recipient, msg any) error {
+	if r.outbox != nil {
+		return r.outbox.enqueue(msg)
+	}
+	ctx, cancel := context.WithTimeout(ctx, l.writeTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, r.conn, msg)
+}
+
+// evict closes a conn which failed to receive a broadcast. Spectators
+// are removed right away, players are left to the conn's reader which
+// handles the disconnect once its read fails.
+func (l *Lobby) evict(r recipient) {
+	r.conn.CloseNow()
+	if r.player == nil {
+		l.DeleteSpectator(r.conn)
+	}
+}
+
+// StartWriter starts a goroutine writing the broadcasts queued for conn,
+// so a slow reader never delays the broadcaster. Up to the lobby queue
+// size broadcasts are queued before the conn is evicted.
+//
+// The writer must be stopped with StopWriter once the conn is done.
+func (l *Lobby) StartWriter(conn *websocket.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.outboxes[conn]; ok {
+		return
+	}
+	o := newOutbox(conn, l.queueSize)
+	l.outboxes[conn] = o
+	go o.run(l.writeTimeout)
+}
+
+// StopWriter stops the writer of conn once its queued broadcasts
+// are written.
+func (l *Lobby) StopWriter(conn *websocket.Conn) {
+	l.mu.Lock()
+	o, ok := l.outboxes[conn]
+	delete(l.outboxes, conn)
+	l.mu.Unlock()
+
+	if ok {
+		o.close()
+		o.wait()
+	}
+}
+
+// stopWriters stops all writers once their queued broadcasts are written.
+func (l *Lobby) stopWriters() {
+	l.mu.Lock()
+	outboxes := l.outboxes
+	l.outboxes = map[*websocket.Conn]*outbox{}
+	l.mu.Unlock()
+
+	for _, o := range outboxes {
+		o.close()
+	}
+	for _, o := range outboxes {
+		o.wait()
+	}
+}
+
+// recipient is a websocket to broadcast to. The player is nil for
+// unregistered conns and spectators, the outbox is nil for conns
+// without a writer.
+type recipient struct {
+	conn   *websocket.Conn
+	player *Player
+	outbox *outbox
+}
+
+// recipients returns a snapshot of all lobby websockets.
+func (l *Lobby) recipients() []recipient {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	recipients := make([]recipient, 0, len(l.players)+len(l.spectators))
+	for conn, player := range l.allPlayers() {
+		recipients = append(recipients, recipient{conn: conn, player: player, outbox: l.outboxes[conn]})
+	}
+	for conn := range l.spectators {
+		recipients = append(recipients, recipient{conn: conn, outbox: l.outboxes[conn]})
+	}
+	return recipients
+}
+
+// ErrStartToken is returned by Start when a player token could not be
+// minted. The lobby is left untouched in that case.
+var ErrStartToken = errors.New("start token")
+
+// Start mints a token for each registered player then sets the lobby
+// state to quiz, both under lock so no player registers meanwhile.
+// The tokens are returned to be sent by BroadcastStart.
+//
+// A failure aborts the start before any state change.
+func (l *Lobby) Start() (map[*Player]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tokens := map[*Player]string{}
+	for _, player := range l.allPlayers() {
+		if player == nil {
+			continue
+		}
 		token, err := l.NewToken(player.Username())
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("%w: %s: %w", ErrStartToken, player.Username(), err)
+		}
+		tokens[player] = token
+	}
+	l.state = LobbyStateQuiz
+
+	return tokens, nil
+}
+
+// BroadcastStart tells each conn the quiz started, along with the token
+// minted by Start for players to restore their session.
+func (l *Lobby) BroadcastStart(ctx context.Context, tokens map[*Player]string) error {
+	return l.broadcastEvent(ctx, func(player *Player) any {
+		if player == nil { // Spectators have no token to restore.
+			return api.Response[api.StartResponseData]{
+				Type: api.ResponseTypeStart,
+			}
 		}
 		return api.Response[api.StartResponseData]{
 			Type: api.ResponseTypeStart,
 			Data: api.StartResponseData{
-				Token: token,
+				Token: tokens[player],
 			},
 		}
 	})
@@ -466,10 +1537,67 @@ func (l *Lobby) deletePlayer(username string) bool {
 	if conn != nil {
 		conn.CloseNow()
 	}
+	l.removePlayer(conn, username)
+	return true
+}
+
+// removePlayer removes the player of conn without closing it. The
+// ownership claimed by conn is released and, if the player owned the
+// lobby, it goes to the longest present player.
+//
+// l.mu must be held by the caller.
+func (l *Lobby) removePlayer(conn *websocket.Conn, username string) {
 	delete(l.players, conn)
+	if conn == l.ownerConn {
+		l.ownerConn = nil // The owner token may claim it again.
+	}
+	if username == l.owner {
+		l.owner, _ = l.nextOwnerCandidate()
+	}
+}
+
+// KickPlayer removes a player from the lobby and tells it the reason
+// before closing its conn. If ban is set, the username may no longer
+// register in the lobby.
+//
+// It returns false if there is no such player.
+func (l *Lobby) KickPlayer(ctx context.Context, username, reason string, ban bool) bool {
+	l.mu.Lock()
+	conn, _, ok := l.getPlayer(username)
+	if ok {
+		l.removePlayer(conn, username)
+		if ban {
+			l.banned[username] = struct{}{}
+		}
+	}
+	l.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	if conn != nil {
+		res := api.Response[api.KickedResponseData]{
+			Type: api.ResponseTypeKicked,
+			Data: api.KickedResponseData{
+				Reason: reason,
+				Banned: ban,
+			},
+		}
+		_ = l.send(ctx, recipient{conn: conn}, res)
+		conn.CloseNow()
+	}
+
 	return true
 }
 
+// IsBanned returns if username was kicked with a ban.
+func (l *Lobby) IsBanned(username string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, banned := l.banned[username]
+	return banned
+}
+
 // DeletePlayerByConn removes a player in the lobby by finding
 // the associated websocket.
 func (l *Lobby) DeletePlayerByConn(conn *websocket.Conn) {
@@ -483,15 +1611,123 @@ func (l *Lobby) deleteConn(conn *websocket.Conn) {
 		conn.CloseNow()
 	}
 	delete(l.players, conn)
+	if conn == l.ownerConn {
+		l.ownerConn = nil // The owner token may claim it again.
+	}
 }
 
 // NewToken generates a new jwt token associated to a username.
 func (l *Lobby) NewToken(username string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	return l.signToken(jwt.MapClaims{
 		"lobbyId":  l.id,
 		"username": username,
 	})
-	return token.SignedString(l.jwtKey)
+}
+
+var errNoTokenKey = errors.New("lobby has no token key")
+
+// signToken signs claims with the lobby key. An empty key is refused as
+// anyone could forge the tokens it signs.
+func (l *Lobby) signToken(claims jwt.MapClaims) (string, error) {
+	if len(l.jwtKey) == 0 {
+		return "", errNoTokenKey
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(l.jwtKey)
+}
+
+// NewOwnerToken generates a jwt token reserving the lobby ownership
+// to its bearer. Once issued, the first player to register is no longer
+// granted ownership without presenting it.
+func (l *Lobby) NewOwnerToken() (string, error) {
+	signed, err := l.signToken(jwt.MapClaims{
+		"lobbyId": l.id,
+		"owner":   true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	l.mu.Lock()
+	l.ownerReserved = true
+	l.mu.Unlock()
+
+	return signed, nil
+}
+
+// ClaimOwner grants username registering on conn the lobby ownership if
+// there is no owner yet. If an owner token was issued, token must be that
+// owner token or conn must have claimed the ownership on connect.
+//
+// It returns false if the ownership was not granted.
+func (l *Lobby) ClaimOwner(conn *websocket.Conn, username, token string) bool {
+	if l.Owner() != "" {
+		return false
+	}
+
+	owner := false
+	if claims, err := l.CheckToken(token); err == nil {
+		owner, _ = claims["owner"].(bool)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	claimed := conn != nil && conn == l.ownerConn
+	if l.owner != "" || (l.ownerConn != nil && !claimed) || (l.ownerReserved && !owner && !claimed) {
+		return false
+	}
+	l.owner = username
+	l.ownerConn = nil
+
+	return true
+}
+
+// ClaimOwnerConn reserves the ownership to conn if token is the owner
+// token and there is no owner yet, so that the creator is recognized
+// as soon as it connects. The conn is granted the ownership once
+// registered, whoever registers first.
+//
+// It returns false if the ownership was not reserved.
+func (l *Lobby) ClaimOwnerConn(conn *websocket.Conn, token string) bool {
+	claims, err := l.CheckToken(token)
+	if err != nil {
+		return false
+	}
+	if owner, _ := claims["owner"].(bool); !owner {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.owner != "" || (l.ownerConn != nil && l.ownerConn != conn) {
+		return false
+	}
+	l.ownerConn = conn
+
+	return true
+}
+
+// IsOwnerConn returns if conn claimed the ownership on connect and
+// did not register yet.
+func (l *Lobby) IsOwnerConn(conn *websocket.Conn) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return conn != nil && conn == l.ownerConn
+}
+
+// IsOwnerToken returns if token is the owner token of the lobby or the
+// token of the player currently owning it.
+func (l *Lobby) IsOwnerToken(token string) bool {
+	claims, err := l.CheckToken(token)
+	if err != nil {
+		return false
+	}
+	if owner, _ := claims["owner"].(bool); owner {
+		return true
+	}
+	username, ok := getStringClaim(claims, "username")
+	return ok && username != "" && username == l.Owner()
 }
 
 // CheckToken validates a token against the configured jwt secret.
@@ -0,0 +1,935 @@
+package quiz_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/quiz"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/google/go-cmp/cmp"
+)
+
+// mustRegisterTestLobby registers a lobby that is never closed as
+// its players are bound to placeholder conns that cannot be closed.
+func mustRegisterTestLobby(t *testing.T) *quiz.Lobby {
+	t.Helper()
+
+	lobby, err := quiz.NewLobbiesCache().Register(quiz.LobbyOptions{Quizzes: defaultTestQuizzes})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+
+	return lobby
+}
+
+func TestLobbyComputeResultsTeams(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+
+	// Conns are only used as player keys and are never written to.
+	lobby.AddPlayerWithTeam(&websocket.Conn{}, "alice", "red").AddScore(2)
+	lobby.AddPlayerWithTeam(&websocket.Conn{}, "bob", "red").AddScore(1)
+	lobby.AddPlayerWithTeam(&websocket.Conn{}, "carol", "blue").AddScore(3)
+	lobby.AddPlayerWithTeam(&websocket.Conn{}, "dave", "blue")
+
+	want := api.ResultsResponseData{
+		Results: map[string]float64{"alice": 2, "bob": 1, "carol": 3, "dave": 0},
+		Teams:   map[string]float64{"red": 3, "blue": 3},
+		Leaderboard: []api.LeaderboardEntry{
+			{Username: "carol", Score: 3, Rank: 1},
+			{Username: "alice", Score: 2, Rank: 2},
+			{Username: "bob", Score: 1, Rank: 3},
+			{Username: "dave", Score: 0, Rank: 4},
+		},
+	}
+	if diff := cmp.Diff(want, lobby.ComputeResults()); diff != "" {
+		t.Errorf("Unexpected results (-want+got):\n%v", diff)
+	}
+
+	wantTeams := map[string]string{"alice": "red", "bob": "red", "carol": "blue", "dave": "blue"}
+	if diff := cmp.Diff(wantTeams, lobby.GetPlayerTeams()); diff != "" {
+		t.Errorf("Unexpected player teams (-want+got):\n%v", diff)
+	}
+}
+
+func TestLobbyLeaderboardTies(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "carol").AddScore(1)
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "bob").AddScore(3)
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "alice").AddScore(3)
+
+	want := []api.LeaderboardEntry{
+		{Username: "alice", Score: 3, Rank: 1},
+		{Username: "bob", Score: 3, Rank: 1},
+		{Username: "carol", Score: 1, Rank: 3},
+	}
+	if diff := cmp.Diff(want, lobby.Leaderboard()); diff != "" {
+		t.Errorf("Unexpected leaderboard (-want+got):\n%v", diff)
+	}
+}
+
+func TestLobbyComputeResultsSolo(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "alice").AddScore(2)
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "bob")
+
+	want := api.ResultsResponseData{
+		Results: map[string]float64{"alice": 2, "bob": 0},
+		Leaderboard: []api.LeaderboardEntry{
+			{Username: "alice", Score: 2, Rank: 1},
+			{Username: "bob", Score: 0, Rank: 2},
+		},
+	}
+	if diff := cmp.Diff(want, lobby.ComputeResults()); diff != "" {
+		t.Errorf("Unexpected results (-want+got):\n%v", diff)
+	}
+	if teams := lobby.GetPlayerTeams(); teams != nil {
+		t.Errorf("Unexpected teams in solo mode: %v", teams)
+	}
+}
+
+func TestLobbyComputeResultsAnswerVariants(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+	lobby.SetQuiz(api.Quiz{
+		Name: "capitals",
+		Questions: []api.Question{{
+			ID:      0,
+			Title:   "Capital of France ?",
+			Type:    api.QuestionTypeText,
+			Answer:  &api.Answer{Text: "Paris"},
+			Answers: []api.Answer{{Text: "Lutece"}},
+		}},
+	})
+
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "alice").RegisterAnswer(0, api.Answer{Text: "Paris"})
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "bob").RegisterAnswer(0, api.Answer{Text: "Lutèce"})
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "carol").RegisterAnswer(0, api.Answer{Text: "Rome"})
+
+	want := map[string]float64{"alice": 1, "bob": 1, "carol": 0}
+	if diff := cmp.Diff(want, lobby.ComputeResults().Results); diff != "" {
+		t.Errorf("Unexpected results (-want+got):\n%v", diff)
+	}
+}
+
+func TestLobbyGetPlayerScores(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+	lobby.SetQuiz(api.Quiz{
+		Name: "capitals",
+		Questions: []api.Question{{
+			ID:     0,
+			Title:  "Capital of France ?",
+			Type:   api.QuestionTypeText,
+			Answer: &api.Answer{Text: "Paris"},
+		}},
+	})
+
+	// Auto-scored answers count along the points credited on review,
+	// the scoreboard must agree with the results.
+	alice := lobby.AddPlayerWithConn(&websocket.Conn{}, "alice")
+	alice.RegisterAnswer(0, api.Answer{Text: "Paris"})
+	alice.AddScore(2)
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "bob").RegisterAnswer(0, api.Answer{Text: "Rome"})
+
+	want := map[string]float64{"alice": 3, "bob": 0}
+	if diff := cmp.Diff(want, lobby.GetPlayerScores()); diff != "" {
+		t.Errorf("Unexpected scores (-want+got):\n%v", diff)
+	}
+	if diff := cmp.Diff(lobby.ComputeResults().Results, lobby.GetPlayerScores()); diff != "" {
+		t.Errorf("Scores do not match results (-results+scores):\n%v", diff)
+	}
+}
+
+func TestLobbyAllPlayersSnapshot(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "alice")
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "bob")
+
+	// Players join while the iteration blocks, as during reviews.
+	joined := make(chan struct{})
+	go func() {
+		defer close(joined)
+		for range 10 {
+			lobby.AddConn(&websocket.Conn{})
+		}
+	}()
+
+	visited := 0
+	for _, player := range lobby.AllPlayers() {
+		if player != nil {
+			visited++
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-joined
+
+	if got, want := visited, 2; got != want {
+		t.Errorf("Unexpected visited players: got %d, want %d", got, want)
+	}
+}
+
+func TestLobbyWaitQuestionPause(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+
+	done := make(chan time.Time, 1)
+	start := time.Now()
+	go func() {
+		if err := lobby.WaitQuestion(200 * time.Millisecond); err != nil {
+			t.Errorf("Unexpected wait error: %v", err)
+		}
+		done <- time.Now()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if !lobby.SetPaused(true) {
+		t.Fatal("Could not pause lobby")
+	}
+	if lobby.SetPaused(true) {
+		t.Error("Lobby was paused twice")
+	}
+
+	// The deadline must not fire while paused.
+	select {
+	case <-done:
+		t.Fatal("Question deadline fired while paused")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	resumed := time.Now()
+	if !lobby.SetPaused(false) {
+		t.Fatal("Could not resume lobby")
+	}
+
+	select {
+	case end := <-done:
+		// About 150ms were remaining when paused.
+		if elapsed := end.Sub(resumed); elapsed < 100*time.Millisecond {
+			t.Errorf("Question resumed with a too short remaining time: %s", elapsed)
+		}
+		if total := end.Sub(start); total < 500*time.Millisecond {
+			t.Errorf("Paused time was not excluded from the question: %s", total)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Question deadline did not fire after resume")
+	}
+}
+
+func TestLobbyCheckPassword(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+
+	if lobby.HasPassword() || !lobby.CheckPassword("") {
+		t.Fatal("Lobby without password is protected")
+	}
+
+	lobby.SetPassword("secret")
+
+	if !lobby.HasPassword() {
+		t.Error("Lobby is not password protected")
+	}
+	if !lobby.CheckPassword("secret") {
+		t.Error("Correct password was rejected")
+	}
+	for _, pwd := range []string{"", "Secret", "secret ", "wrong"} {
+		if lobby.CheckPassword(pwd) {
+			t.Errorf("Incorrect password %q was accepted", pwd)
+		}
+	}
+
+	lobby.SetPassword("")
+
+	if lobby.HasPassword() || !lobby.CheckPassword("wrong") {
+		t.Error("Lobby password was not removed")
+	}
+}
+
+// mustDialTestConn dials a websocket whose server side conn is passed
+// to add. The server conn lives until the test ends.
+func mustDialTestConn(t *testing.T, add func(conn *websocket.Conn)) *websocket.Conn {
+	t.Helper()
+
+	accepted := make(chan struct{})
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Errorf("Could not accept websocket: %v", err)
+			return
+		}
+		defer conn.CloseNow()
+		add(conn)
+		close(accepted)
+		<-done
+	}))
+	t.Cleanup(func() {
+		close(done)
+		s.Close()
+	})
+
+	conn, _, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Could not dial: %v", err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	<-accepted
+
+	return conn
+}
+
+func TestLobbyBroadcastStalledConn(t *testing.T) {
+	// Not parallel, stalling large writes would skew timing sensitive tests.
+
+	lobby := mustRegisterTestLobby(t)
+
+	// The client never reads so large writes stall once buffers are full.
+	mustDialTestConn(t, lobby.AddConn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	payload := strings.Repeat("x", 16<<20)
+	broadcasted := make(chan struct{})
+	go func() {
+		defer close(broadcasted)
+		_ = lobby.Broadcast(ctx, func(*quiz.Player) any { return payload })
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	added := make(chan struct{})
+	go func() {
+		lobby.AddPlayerWithConn(&websocket.Conn{}, "alice")
+		close(added)
+	}()
+
+	select {
+	case <-added:
+	case <-broadcasted:
+		t.Fatal("Broadcast did not stall, the test is inconclusive")
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Player registration blocked by a stalled broadcast")
+	}
+}
+
+func TestLobbyBroadcastEvictsStalledConn(t *testing.T) {
+	// Not parallel, stalling large writes would skew timing sensitive tests.
+
+	lobby, err := quiz.NewLobbiesCache().Register(quiz.LobbyOptions{
+		Quizzes:      defaultTestQuizzes,
+		WriteTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+
+	var stalledConn *websocket.Conn
+	mustDialTestConn(t, func(conn *websocket.Conn) {
+		stalledConn = conn
+		lobby.AddPlayerWithConn(conn, "stalled")
+	})
+	alice := mustDialTestConn(t, func(conn *websocket.Conn) {
+		lobby.AddPlayerWithConn(conn, "alice")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Alice reads all broadcasts while the stalled client never reads.
+	received := make(chan string)
+	go func() {
+		for {
+			msg := ""
+			if err := wsjson.Read(ctx, alice, &msg); err != nil {
+				return
+			}
+			received <- msg
+		}
+	}()
+
+	payload := strings.Repeat("x", 16<<20)
+	err = lobby.Broadcast(ctx, func(p *quiz.Player) any {
+		if p.Username() == "stalled" {
+			return payload
+		}
+		return "first"
+	})
+	if err == nil {
+		t.Fatal("Broadcast to a stalled conn did not fail")
+	}
+	if got := <-received; got != "first" {
+		t.Fatalf("Got broadcast %q, want %q", got, "first")
+	}
+
+	// The stalled conn is closed and subsequent broadcasts succeed.
+	if err := stalledConn.Ping(ctx); err == nil {
+		t.Fatal("Stalled conn was not closed")
+	}
+	lobby.DeletePlayer("stalled") // Done by the conn's reader in handlers.
+
+	if err := lobby.Broadcast(ctx, func(*quiz.Player) any { return "next" }); err != nil {
+		t.Fatalf("Broadcast after eviction failed: %v", err)
+	}
+	if got := <-received; got != "next" {
+		t.Fatalf("Got broadcast %q, want %q", got, "next")
+	}
+}
+
+func TestLobbyWriterOrder(t *testing.T) {
+	t.Parallel()
+
+	lobby, err := quiz.NewLobbiesCache().Register(quiz.LobbyOptions{
+		Quizzes:   defaultTestQuizzes,
+		QueueSize: 128,
+	})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+
+	conn := mustDialTestConn(t, func(conn *websocket.Conn) {
+		lobby.StartWriter(conn)
+		lobby.AddConn(conn)
+		t.Cleanup(func() { lobby.StopWriter(conn) })
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const n = 100
+	for i := range n {
+		if err := lobby.Broadcast(ctx, func(*quiz.Player) any { return i }); err != nil {
+			t.Fatalf("Could not broadcast: %v", err)
+		}
+	}
+
+	for want := range n {
+		got := 0
+		if err := wsjson.Read(ctx, conn, &got); err != nil {
+			t.Fatalf("Could not read broadcast: %v", err)
+		}
+		if got != want {
+			t.Fatalf("Got broadcast %d, want %d", got, want)
+		}
+	}
+}
+
+func TestLobbyWriterOverflow(t *testing.T) {
+	// Not parallel, stalling large writes would skew timing sensitive tests.
+
+	lobby, err := quiz.NewLobbiesCache().Register(quiz.LobbyOptions{
+		Quizzes:      defaultTestQuizzes,
+		QueueSize:    2,
+		WriteTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+
+	var stalledConn *websocket.Conn
+	mustDialTestConn(t, func(conn *websocket.Conn) {
+		stalledConn = conn
+		lobby.StartWriter(conn)
+		lobby.AddPlayerWithConn(conn, "stalled")
+		t.Cleanup(func() { lobby.StopWriter(conn) })
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The writer stalls on a large broadcast the client never reads,
+	// the next broadcasts are queued until the queue overflows.
+	payload := strings.Repeat("x", 16<<20)
+	if err := lobby.Broadcast(ctx, func(*quiz.Player) any { return payload }); err != nil {
+		t.Fatalf("Could not queue broadcast: %v", err)
+	}
+	for i := 0; ; i++ {
+		if i > 3 {
+			t.Fatal("Broadcast queue never overflowed")
+		}
+		if err := lobby.Broadcast(ctx, func(*quiz.Player) any { return i }); err != nil {
+			break
+		}
+	}
+
+	if err := stalledConn.Ping(ctx); err == nil {
+		t.Fatal("Overflowed conn was not closed")
+	}
+}
+
+func TestLobbyStartTokenFailure(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+	lobby.SetState(quiz.LobbyStateRegister)
+	conn := mustDialTestConn(t, func(conn *websocket.Conn) {
+		lobby.AddPlayerWithConn(conn, "alice")
+	})
+	unregistered := mustDialTestConn(t, lobby.AddConn)
+
+	quiz.SetTokenKey(lobby, nil)
+
+	_, err := lobby.Start()
+	if !errors.Is(err, quiz.ErrStartToken) {
+		t.Fatalf("Unexpected start error: got %v, want %v", err, quiz.ErrStartToken)
+	}
+
+	// The aborted start has no side effect.
+	if got, want := lobby.State(), quiz.LobbyStateRegister; got != want {
+		t.Errorf("Unexpected lobby state: got %s, want %s", got, want)
+	}
+	readCtx, readCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer readCancel()
+	if _, _, err := unregistered.Read(readCtx); websocket.CloseStatus(err) != -1 {
+		t.Errorf("Unregistered conn was closed: %v", err)
+	}
+
+	// Nothing is sent when a token cannot be minted.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var msg any
+	if err := wsjson.Read(ctx, conn, &msg); err == nil {
+		t.Fatalf("Unexpected message broadcasted on aborted start: %v", msg)
+	}
+}
+
+func TestLobbyRemovePlayerOwnership(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+	token, err := lobby.NewOwnerToken()
+	if err != nil {
+		t.Fatalf("Could not create owner token: %v", err)
+	}
+
+	// A kicked player releases the ownership its conn claimed.
+	var claimed *websocket.Conn
+	mustDialTestConn(t, func(conn *websocket.Conn) {
+		claimed = conn
+		lobby.ClaimOwnerConn(conn, token)
+		lobby.AddPlayerWithConn(conn, "alice")
+	})
+	if !lobby.KickPlayer(context.Background(), "alice", "", false) {
+		t.Fatal("Could not kick player")
+	}
+	if lobby.IsOwnerConn(claimed) {
+		t.Error("Kicked player conn still claims the ownership")
+	}
+
+	// A deleted owner hands the ownership over.
+	mustDialTestConn(t, func(conn *websocket.Conn) {
+		lobby.AddPlayerWithConn(conn, "bob")
+	})
+	lobby.AddPlayerWithConn(&websocket.Conn{}, "carol")
+	lobby.SetOwner("bob")
+	if !lobby.DeletePlayer("bob") {
+		t.Fatal("Could not delete player")
+	}
+	if got, want := lobby.Owner(), "carol"; got != want {
+		t.Errorf("Unexpected owner after deletion: got %q, want %q", got, want)
+	}
+}
+
+func TestLobbySendReview(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+
+	sent := make(chan error)
+	go func() { sent <- lobby.SendReview(true) }()
+
+	select {
+	case err := <-sent:
+		if !errors.Is(err, quiz.ErrNoReviewPending) {
+			t.Errorf("Unexpected error without pending review: got %v, want %v", err, quiz.ErrNoReviewPending)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Review without review loop did not return")
+	}
+
+	lobby.RequestReview()
+	if err := lobby.SendReview(true); err != nil {
+		t.Fatalf("Could not send pending review: %v", err)
+	}
+	if err := lobby.SendReview(false); !errors.Is(err, quiz.ErrNoReviewPending) {
+		t.Errorf("Review sent twice: got %v, want %v", err, quiz.ErrNoReviewPending)
+	}
+	if validate := <-lobby.NextReview(); !validate {
+		t.Error("Unexpected review received")
+	}
+}
+
+func TestLobbyQuizIsolation(t *testing.T) {
+	t.Parallel()
+
+	quizzes := map[string]api.Quiz{
+		"shared": {
+			Name: "shared",
+			Questions: []api.Question{{
+				Title:   "first",
+				Type:    api.QuestionTypeChoices,
+				Choices: []string{"a", "b"},
+				Answer:  &api.Answer{Choices: []string{"a"}},
+			}},
+		},
+	}
+	want := quizzes["shared"].Clone()
+
+	lobbies := quiz.NewLobbiesCache()
+	a, err := lobbies.Register(quiz.LobbyOptions{Quizzes: quizzes})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+	b, err := lobbies.Register(quiz.LobbyOptions{Quizzes: quizzes})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+	t.Cleanup(func() {
+		lobbies.Delete(a.ID())
+		lobbies.Delete(b.ID())
+	})
+
+	// Mutate the quiz as done when starting it.
+	q := a.Quiz()
+	q.Questions[0].ID = 42
+	q.Questions[0].Choices[0] = "c"
+	q.Questions[0].Answer.Choices[0] = "c"
+	a.SetQuiz(q)
+	q.Questions[0].Title = "mutated after set"
+
+	if diff := cmp.Diff(want, quizzes["shared"]); diff != "" {
+		t.Errorf("Shared quiz was modified (-want+got):\n%v", diff)
+	}
+	if diff := cmp.Diff(want, b.Quiz()); diff != "" {
+		t.Errorf("Other lobby quiz was modified (-want+got):\n%v", diff)
+	}
+	if got, want := a.Quiz().Questions[0].Title, "first"; got != want {
+		t.Errorf("Lobby quiz was modified after being set: got %s, want %s", got, want)
+	}
+}
+
+func TestLobbyCountPlayers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		registeredOnly bool
+		wantFull       bool
+		wantTooLow     bool
+	}{
+		{name: "All conns", wantFull: true, wantTooLow: true},
+		{name: "Registered only", registeredOnly: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			lobby, err := quiz.NewLobbiesCache().Register(quiz.LobbyOptions{
+				MaxPlayers:          3,
+				CountRegisteredOnly: tt.registeredOnly,
+				Quizzes:             defaultTestQuizzes,
+			})
+			if err != nil {
+				t.Fatalf("Could not register lobby: %v", err)
+			}
+
+			// Conns are only used as player keys and are never written to.
+			lobby.AddPlayerWithConn(&websocket.Conn{}, "alice")
+			lobby.AddPlayerWithConn(&websocket.Conn{}, "bob").Disconnect()
+			lobby.AddConn(&websocket.Conn{})
+
+			if got, want := lobby.NumConns(), 3; got != want {
+				t.Errorf("Unexpected conns: got %d, want %d", got, want)
+			}
+			if got, want := lobby.NumPlayers(), 1; got != want {
+				t.Errorf("Unexpected players: got %d, want %d", got, want)
+			}
+			if got := lobby.IsFull(); got != tt.wantFull {
+				t.Errorf("Unexpected full lobby: got %t, want %t", got, tt.wantFull)
+			}
+			if !lobby.CanRegister() {
+				t.Error("No slot left to register")
+			}
+			err = lobby.SetMaxPlayers(2)
+			if gotTooLow := errors.Is(err, quiz.ErrMaxPlayersTooLow); gotTooLow != tt.wantTooLow {
+				t.Errorf("Unexpected lowered maximum result: got %v, want too low %t", err, tt.wantTooLow)
+			}
+		})
+	}
+}
+
+func TestLobbyChangeQuiz(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+	lobby.SetState(quiz.LobbyStateRegister)
+
+	question := &api.Question{ID: 0, Title: "stale", Type: api.QuestionTypeText}
+	lobby.SetCurrentQuestion(question)
+	player := lobby.AddPlayerWithConn(&websocket.Conn{}, "alice")
+	player.RegisterAnswer(0, api.Answer{Text: "stale"})
+
+	if err := lobby.ChangeQuiz(api.Quiz{Name: "other"}); err != nil {
+		t.Fatalf("Could not change quiz: %v", err)
+	}
+	if got := lobby.Quiz().Name; got != "other" {
+		t.Errorf("Unexpected quiz: got %s, want other", got)
+	}
+	if q := lobby.CurrentQuestion(); q != nil {
+		t.Errorf("Current question was not reset: %+v", q)
+	}
+	for id, answer := range player.AllAnswers() {
+		t.Errorf("Answer to question %d was not cleared: %+v", id, answer)
+	}
+
+	lobby.SetState(quiz.LobbyStateQuiz)
+	if err := lobby.ChangeQuiz(api.Quiz{Name: "late"}); !errors.Is(err, quiz.ErrQuizLocked) {
+		t.Errorf("Unexpected error changing quiz while playing: got %v, want %v", err, quiz.ErrQuizLocked)
+	}
+	if got := lobby.Quiz().Name; got != "other" {
+		t.Errorf("Quiz changed while playing: got %s, want other", got)
+	}
+}
+
+func TestLobbyQuestionTime(t *testing.T) {
+	t.Parallel()
+
+	quizzes := map[string]api.Quiz{
+		"durations": {
+			Name: "durations",
+			QuizInfo: api.QuizInfo{
+				Durations: map[api.QuestionType]time.Duration{api.QuestionTypeOrder: 45 * time.Second},
+			},
+		},
+	}
+
+	lobbies := quiz.NewLobbiesCache()
+	lobby, err := lobbies.Register(quiz.LobbyOptions{
+		Quizzes: quizzes,
+		Quiz:    "durations",
+		QuestionDurations: map[api.QuestionType]time.Duration{
+			api.QuestionTypeChoices: 10 * time.Second,
+			api.QuestionTypeOrder:   20 * time.Second,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+	t.Cleanup(func() { lobbies.Delete(lobby.ID()) })
+
+	tests := []struct {
+		name     string
+		question api.Question
+		want     time.Duration
+	}{
+		{"Lobby default", api.Question{Type: api.QuestionTypeChoices}, 10 * time.Second},
+		{"Quiz default over lobby default", api.Question{Type: api.QuestionTypeOrder}, 45 * time.Second},
+		{"Global fallback", api.Question{Type: api.QuestionTypeText}, quiz.DefaultQuestionTime},
+		{"Explicit time", api.Question{Type: api.QuestionTypeChoices, Time: 5 * time.Second}, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := lobby.QuestionTime(tt.question); got != tt.want {
+				t.Errorf("Unexpected question time: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLobbyHistory(t *testing.T) {
+	t.Parallel()
+
+	lobbies := quiz.NewLobbiesCache()
+	lobby, err := lobbies.Register(quiz.LobbyOptions{Quizzes: defaultTestQuizzes, HistorySize: 3})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+	t.Cleanup(func() { lobbies.Delete(lobby.ID()) })
+
+	for remaining := 5; remaining > 0; remaining-- {
+		if err := lobby.BroadcastCountdown(context.Background(), remaining); err != nil {
+			t.Fatalf("Could not broadcast countdown: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		seq     uint64
+		wantSeq []uint64
+	}{
+		{"Oldest events overwritten", 0, []uint64{3, 4, 5}},
+		{"Events following seq", 3, []uint64{4, 5}},
+		{"No missed event", 5, []uint64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotSeq := []uint64{}
+			for _, event := range lobby.History(tt.seq) {
+				gotSeq = append(gotSeq, event.Seq)
+
+				res, ok := event.Message.(api.Response[api.CountdownResponseData])
+				if !ok {
+					t.Fatalf("Unexpected event message: %T", event.Message)
+				}
+				if res.Seq != event.Seq {
+					t.Errorf("Event message not numbered: got seq %d, want %d", res.Seq, event.Seq)
+				}
+				if got, want := res.Data.Remaining, 6-int(event.Seq); got != want {
+					t.Errorf("Unexpected event message: got remaining %d, want %d", got, want)
+				}
+			}
+			if diff := cmp.Diff(tt.wantSeq, gotSeq); diff != "" {
+				t.Errorf("Unexpected history (-want+got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestLobbyRandomQuiz(t *testing.T) {
+	t.Parallel()
+
+	quizzes := map[string]api.Quiz{
+		"cars":      {Name: "cars"},
+		"geography": {Name: "geography"},
+		"movies":    {Name: "movies"},
+	}
+	opts := quiz.LobbyOptions{Quizzes: quizzes, Seed: 42}
+
+	lobby, err := quiz.NewLobbiesCache().Register(opts)
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+	replay, err := quiz.NewLobbiesCache().Register(opts)
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+
+	picked := map[string]struct{}{}
+	for range 50 {
+		name, q := lobby.RandomQuiz()
+		if _, ok := quizzes[name]; !ok {
+			t.Fatalf("Random quiz %q is not a lobby quiz", name)
+		}
+		if q.Name != name {
+			t.Errorf("Random quiz %q returned quiz %q", name, q.Name)
+		}
+		if replayed, _ := replay.RandomQuiz(); replayed != name {
+			t.Errorf("Random quiz not reproduced with the same seed: got %q, want %q", replayed, name)
+		}
+		picked[name] = struct{}{}
+	}
+	if len(picked) != len(quizzes) {
+		t.Errorf("Random quizzes never picked some quizzes: picked %v", picked)
+	}
+}
+
+func TestLobbyResetGame(t *testing.T) {
+	t.Parallel()
+
+	lobby := mustRegisterTestLobby(t)
+	lobby.SetState(quiz.LobbyStateQuiz)
+
+	alice := lobby.AddPlayerWithConn(&websocket.Conn{}, "alice")
+	bob := lobby.AddPlayerWithConn(&websocket.Conn{}, "bob")
+	lobby.AddConn(&websocket.Conn{})
+	alice.AddScore(2)
+	alice.RegisterAnswer(0, api.Answer{Text: "Paris"})
+	bob.Disconnect()
+
+	if err := lobby.ResetGame(); !errors.Is(err, quiz.ErrGameNotOver) {
+		t.Fatalf("Unexpected reset error during the quiz: got %v, want %v", err, quiz.ErrGameNotOver)
+	}
+
+	reset := lobby.GameReset()
+	lobby.SetState(quiz.LobbyStateAnswers)
+	if err := lobby.ResetGame(); err != nil {
+		t.Fatalf("Could not reset game: %v", err)
+	}
+
+	select {
+	case <-reset:
+	default:
+		t.Error("Game reset channel was not closed")
+	}
+	if got, want := lobby.State(), quiz.LobbyStateRegister; got != want {
+		t.Errorf("Unexpected state: got %s, want %s", got, want)
+	}
+	if alice.Score() != 0 {
+		t.Errorf("Score was not cleared: %d", alice.Score())
+	}
+	for id := range alice.AllAnswers() {
+		t.Errorf("Answer to question %d was not cleared", id)
+	}
+	if _, _, ok := lobby.GetPlayer("bob"); ok {
+		t.Error("Player who left during the game was kept")
+	}
+	// The conn not registered yet is still connected and may register.
+	if got, want := lobby.NumConns(), 2; got != want {
+		t.Errorf("Unexpected conns after reset: got %d, want %d", got, want)
+	}
+	if lobby.EndGame() {
+		t.Error("Lobby closed after the game was reset")
+	}
+}
+
+func TestLobbyEstimatedDuration(t *testing.T) {
+	t.Parallel()
+
+	lobby, err := quiz.NewLobbiesCache().Register(quiz.LobbyOptions{
+		Quizzes: map[string]api.Quiz{
+			"geography": {
+				Name:     "geography",
+				QuizInfo: api.QuizInfo{Durations: map[api.QuestionType]time.Duration{api.QuestionTypeMap: time.Minute}},
+				Questions: []api.Question{
+					{Title: "Capital of France ?", Type: api.QuestionTypeText, Time: 20 * time.Second},
+					{Title: "Where is Paris ?", Type: api.QuestionTypeMap},
+					{Title: "Capital of Italy ?", Type: api.QuestionTypeText},
+				},
+			},
+		},
+		StartCountdown:     3 * time.Second,
+		InterQuestionDelay: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Could not register lobby: %v", err)
+	}
+
+	// Countdown, authored, quiz type and default times, then two delays.
+	want := 3*time.Second + 20*time.Second + time.Minute + quiz.DefaultQuestionTime + 2*5*time.Second
+	if got := lobby.EstimatedDuration(); got != want {
+		t.Errorf("Unexpected estimated duration: got %s, want %s", got, want)
+	}
+
+	if err := lobby.ChangeQuiz(api.Quiz{Name: "empty"}); err != nil {
+		t.Fatalf("Could not change quiz: %v", err)
+	}
+	if got := lobby.EstimatedDuration(); got != 0 {
+		t.Errorf("Unexpected estimated duration of an empty quiz: got %s, want 0", got)
+	}
+}
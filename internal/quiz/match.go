@@ -0,0 +1,106 @@
+package quiz
+
+import (
+	"sevenquiz-backend/api"
+	"strings"
+	"unicode"
+)
+
+// MatchText reports if text matches the expected text, compared with
+// mode. An empty mode compares normalized texts. Alternative texts are
+// listed as question answer variants.
+func MatchText(mode api.TextMatch, text, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	switch mode {
+	case api.MatchExact:
+		return strings.TrimSpace(text) == strings.TrimSpace(expected)
+	case api.MatchFuzzy:
+		text, expected = NormalizeText(text), NormalizeText(expected)
+		return levenshtein(text, expected) <= len([]rune(expected))/5
+	default:
+		return NormalizeText(text) == NormalizeText(expected)
+	}
+}
+
+// ligatures are expanded before folding accents, as they span two letters.
+var ligatures = strings.NewReplacer("œ", "oe", "æ", "ae", "ß", "ss")
+
+// NormalizeText lowercases text and strips its accents and punctuation.
+// Spaces and dashes separate words by a single space.
+func NormalizeText(text string) string {
+	var (
+		b         strings.Builder
+		separated bool
+	)
+	for _, r := range ligatures.Replace(strings.ToLower(text)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if separated && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			separated = false
+			b.WriteRune(foldAccent(r))
+		case unicode.IsSpace(r) || unicode.Is(unicode.Pd, r):
+			separated = true
+		}
+	}
+	return b.String()
+}
+
+// accents maps accented latin letters to their base letter.
+var accents = func() map[rune]rune {
+	folds := map[rune]string{
+		'a': "àáâãäåāăą",
+		'c': "çćĉċč",
+		'd': "ďđ",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'i': "ìíîïĩīĭįı",
+		'l': "ĺļľŀł",
+		'n': "ñńņňŉ",
+		'o': "òóôõöøōŏő",
+		'r': "ŕŗř",
+		's': "śŝşš",
+		't': "ţťŧ",
+		'u': "ùúûüũūŭůűų",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	}
+	accents := map[rune]rune{}
+	for base, accented := range folds {
+		for _, r := range accented {
+			accents[r] = base
+		}
+	}
+	return accents
+}()
+
+func foldAccent(r rune) rune {
+	if base, ok := accents[r]; ok {
+		return base
+	}
+	return r
+}
+
+// levenshtein returns the number of single rune edits turning a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev, curr := make([]int, len(rb)+1), make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
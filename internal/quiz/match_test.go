@@ -0,0 +1,41 @@
+package quiz_test
+
+import (
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/quiz"
+	"testing"
+)
+
+func TestMatchText(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		mode     api.TextMatch
+		text     string
+		expected string
+		want     bool
+	}{
+		{name: "Exact", mode: api.MatchExact, text: " Paris ", expected: "Paris", want: true},
+		{name: "Exact case", mode: api.MatchExact, text: "paris", expected: "Paris", want: false},
+		{name: "Normalized punctuation", mode: api.MatchNormalized, text: "paris,", expected: "Paris", want: true},
+		{name: "Normalized by default", text: "paris,", expected: "Paris", want: true},
+		{name: "Normalized accents", mode: api.MatchNormalized, text: "elephant", expected: "Éléphant", want: true},
+		{name: "Normalized spaces and dashes", mode: api.MatchNormalized, text: "Saint  Étienne", expected: "Saint-Étienne", want: true},
+		{name: "Normalized typo", mode: api.MatchNormalized, text: "colour", expected: "color", want: false},
+		{name: "Fuzzy typo", mode: api.MatchFuzzy, text: "colour", expected: "color", want: true},
+		{name: "Fuzzy short word", mode: api.MatchFuzzy, text: "car", expected: "cat", want: false},
+		{name: "Fuzzy too many typos", mode: api.MatchFuzzy, text: "colours", expected: "color", want: false},
+		{name: "Empty expected", text: "", expected: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := quiz.MatchText(tt.mode, tt.text, tt.expected); got != tt.want {
+				t.Errorf("Unexpected match of %q against %q: got %t, want %t", tt.text, tt.expected, got, tt.want)
+			}
+		})
+	}
+}
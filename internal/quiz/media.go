@@ -0,0 +1,45 @@
+package quiz
+
+import (
+	"net/url"
+	"sevenquiz-backend/api"
+	"slices"
+)
+
+// MediaDir is the directory of a quiz holding its media files.
+// Media paths in questions are relative to this directory.
+const MediaDir = "assets"
+
+// ResolveMediaURLs returns a copy of question with all relative media
+// paths rewritten to the URLs served by the media handler.
+// An empty baseURL resolves to absolute paths on the current host.
+func ResolveMediaURLs(question api.Question, baseURL, quizName string) api.Question {
+	if baseURL == "" {
+		baseURL = "/"
+	}
+
+	question.Medias = slices.Clone(question.Medias)
+	for i, media := range question.Medias {
+		question.Medias[i] = resolveMediaURL(media, baseURL, quizName)
+	}
+
+	question.OrderItems = slices.Clone(question.OrderItems)
+	for i, item := range question.OrderItems {
+		question.OrderItems[i].Media = resolveMediaURL(item.Media, baseURL, quizName)
+	}
+
+	return question
+}
+
+func resolveMediaURL(media api.Media, baseURL, quizName string) api.Media {
+	if media.Path == "" {
+		return media
+	}
+	if u, err := url.Parse(media.Path); err == nil && u.IsAbs() {
+		return media
+	}
+	if path, err := url.JoinPath(baseURL, "media", quizName, media.Path); err == nil {
+		media.Path = path
+	}
+	return media
+}
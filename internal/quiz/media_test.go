@@ -0,0 +1,41 @@
+package quiz_test
+
+import (
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/quiz"
+	"testing"
+)
+
+func TestResolveMediaURLs(t *testing.T) {
+	t.Parallel()
+
+	question := api.Question{
+		Medias: []api.Media{
+			{Path: "car.png", Type: "image"},
+			{Path: "https://cdn.example.com/engine.mp3", Type: "audio"},
+		},
+		OrderItems: []api.OrderItem{
+			{Name: "first", Media: api.Media{Path: "first.png"}},
+		},
+	}
+
+	got := quiz.ResolveMediaURLs(question, "https://quiz.example.com", "cars")
+
+	if got, want := got.Medias[0].Path, "https://quiz.example.com/media/cars/car.png"; got != want {
+		t.Errorf("Unexpected media url: got %s, want %s", got, want)
+	}
+	if got, want := got.Medias[1].Path, "https://cdn.example.com/engine.mp3"; got != want {
+		t.Errorf("Absolute media url was rewritten: got %s, want %s", got, want)
+	}
+	if got, want := got.OrderItems[0].Media.Path, "https://quiz.example.com/media/cars/first.png"; got != want {
+		t.Errorf("Unexpected order item media url: got %s, want %s", got, want)
+	}
+	if got, want := question.Medias[0].Path, "car.png"; got != want {
+		t.Errorf("Original question was modified: got %s, want %s", got, want)
+	}
+
+	got = quiz.ResolveMediaURLs(question, "", "cars")
+	if got, want := got.Medias[0].Path, "/media/cars/car.png"; got != want {
+		t.Errorf("Unexpected media path without base url: got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package quiz
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+var (
+	errOutboxFull   = errors.New("outbound queue full")
+	errOutboxClosed = errors.New("outbound queue closed")
+)
+
+// outbox queues the broadcasts of a conn, written in order by a
+// dedicated writer goroutine.
+type outbox struct {
+	conn     *websocket.Conn
+	msgs     chan any
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newOutbox(conn *websocket.Conn, size int) *outbox {
+	return &outbox{
+		conn: conn,
+		msgs: make(chan any, size),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// run writes queued messages until stopped, then flushes the remaining
+// ones. A failed write closes the conn and stops the writer.
+func (o *outbox) run(writeTimeout time.Duration) {
+	defer close(o.done)
+	for {
+		select {
+		case msg := <-o.msgs:
+			if !o.write(msg, writeTimeout) {
+				return
+			}
+		case <-o.stop:
+			for {
+				select {
+				case msg := <-o.msgs:
+					if !o.write(msg, writeTimeout) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (o *outbox) write(msg any, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := wsjson.Write(ctx, o.conn, msg); err != nil {
+		o.conn.CloseNow()
+		return false
+	}
+	return true
+}
+
+// enqueue queues msg without blocking.
+func (o *outbox) enqueue(msg any) error {
+	select {
+	case <-o.stop:
+		return errOutboxClosed
+	case <-o.done:
+		return errOutboxClosed
+	default:
+	}
+	select {
+	case o.msgs <- msg:
+		return nil
+	default:
+		return errOutboxFull
+	}
+}
+
+// close stops the writer once the queued messages are flushed.
+// Use wait to block until then.
+func (o *outbox) close() {
+	o.stopOnce.Do(func() { close(o.stop) })
+}
+
+func (o *outbox) wait() {
+	<-o.done
+}
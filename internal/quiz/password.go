@@ -0,0 +1,47 @@
+package quiz
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordHash holds a bcrypt hash of a lobby password so the password
+// itself is never kept in memory.
+//
+// The zero value represents no password.
+type passwordHash struct {
+	sum []byte
+}
+
+// newPasswordHash hashes password with bcrypt, which draws its own salt.
+// An empty password returns the zero value.
+func newPasswordHash(password string) passwordHash {
+	if password == "" {
+		return passwordHash{}
+	}
+	// Only fails on passwords over 72 bytes, prevented by the pre-hash.
+	sum, _ := bcrypt.GenerateFromPassword(preHashPassword(password), bcrypt.DefaultCost)
+	return passwordHash{sum: sum}
+}
+
+// preHashPassword digests password so that bcrypt, which is limited to
+// 72 bytes, accounts for every character of long passwords.
+func preHashPassword(password string) []byte {
+	digest := sha256.Sum256([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(digest[:]))
+}
+
+func (h passwordHash) isSet() bool {
+	return h.sum != nil
+}
+
+// check compares password against the hash in constant time.
+// Any password matches when none is set.
+func (h passwordHash) check(password string) bool {
+	if !h.isSet() {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword(h.sum, preHashPassword(password)) == nil
+}
@@ -2,6 +2,7 @@ package quiz
 
 import (
 	"iter"
+	"maps"
 	"sevenquiz-backend/api"
 	"sync"
 )
@@ -11,17 +12,32 @@ import (
 // Multiple goroutines may invoke methods on a Player simultaneously.
 type Player struct {
 	username string
+	team     string
+	joined   uint64 // join order in the lobby
 	answers  map[int]api.Answer
 	score    int
 	alive    bool
 	mu       sync.RWMutex
 }
 
+// NewPlayer returns a connected solo player without answers.
+func NewPlayer(username string) *Player {
+	return &Player{
+		username: username,
+		alive:    true,
+		answers:  map[int]api.Answer{},
+	}
+}
+
+// AllAnswers iterates over a snapshot of the player answers taken when
+// called, so answers registered meanwhile never race the iteration.
 func (p *Player) AllAnswers() iter.Seq2[int, api.Answer] {
 	p.mu.RLock()
-	defer p.mu.RUnlock()
+	answers := maps.Clone(p.answers)
+	p.mu.RUnlock()
+
 	return func(yield func(int, api.Answer) bool) {
-		for i, answer := range p.answers {
+		for i, answer := range answers {
 			if !yield(i, answer) {
 				return
 			}
@@ -45,6 +61,11 @@ func (p *Player) Username() string {
 	return p.username
 }
 
+// Team returns the player team, empty if playing solo.
+func (p *Player) Team() string {
+	return p.team
+}
+
 func (p *Player) Disconnect() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -66,11 +87,40 @@ func (p *Player) Connect() {
 func (p *Player) RegisterAnswer(questionID int, answer api.Answer) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if p.answers == nil {
+		p.answers = map[int]api.Answer{}
+	}
 	p.answers[questionID] = answer
 }
 
+// ClearAnswers forgets all the answers recorded by the player.
+func (p *Player) ClearAnswers() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear(p.answers)
+}
+
+// GetAnswer returns the player answer to a question, the zero Answer
+// if the player did not answer it.
 func (p *Player) GetAnswer(questionID int) api.Answer {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	return p.answers[questionID]
 }
+
+// LookupAnswer returns the player answer to a question and whether the
+// player answered it, the zero Answer being a valid map answer.
+func (p *Player) LookupAnswer(questionID int) (api.Answer, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	answer, ok := p.answers[questionID]
+	return answer, ok
+}
+
+// reset forgets the player answers and score for a new game.
+func (p *Player) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear(p.answers)
+	p.score = 0
+}
@@ -0,0 +1,107 @@
+package quiz_test
+
+import (
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/quiz"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/coder/websocket"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlayerAnswersConcurrency(t *testing.T) {
+	t.Parallel()
+
+	const questions = 100
+
+	lobby := mustRegisterTestLobby(t)
+	player := lobby.AddPlayerWithConn(&websocket.Conn{}, "alice")
+
+	var wg sync.WaitGroup
+	wg.Add(2*questions + 1)
+	for id := range questions {
+		go func() {
+			defer wg.Done()
+			player.RegisterAnswer(id, api.Answer{Text: strconv.Itoa(id)})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = player.GetAnswer(id)
+			for range player.AllAnswers() {
+			}
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		player.ClearAnswers()
+	}()
+	wg.Wait()
+
+	for id := range questions {
+		player.RegisterAnswer(id, api.Answer{Text: strconv.Itoa(id)})
+	}
+	n := 0
+	for id, answer := range player.AllAnswers() {
+		if answer.Text != strconv.Itoa(id) {
+			t.Errorf("Unexpected answer to question %d: %+v", id, answer)
+		}
+		n++
+	}
+	if n != questions {
+		t.Errorf("Unexpected number of answers: got %d, want %d", n, questions)
+	}
+}
+
+func TestPlayerZeroValueAnswer(t *testing.T) {
+	t.Parallel()
+
+	var player quiz.Player
+	if got := player.GetAnswer(0); !cmp.Equal(got, api.Answer{}) {
+		t.Errorf("Zero player has an answer: %+v", got)
+	}
+	for id := range player.AllAnswers() {
+		t.Errorf("Zero player has an answer to question %d", id)
+	}
+
+	if _, ok := player.LookupAnswer(0); ok {
+		t.Error("Zero player answered")
+	}
+
+	player.RegisterAnswer(0, api.Answer{Text: "Paris"})
+
+	if got := player.GetAnswer(0).Text; got != "Paris" {
+		t.Errorf("Unexpected answer: got %q, want %q", got, "Paris")
+	}
+
+	// The zero answer is a valid map answer.
+	player.RegisterAnswer(1, api.Answer{})
+	if _, ok := player.LookupAnswer(1); !ok {
+		t.Error("Zero answer was not registered")
+	}
+}
+
+func TestNewPlayer(t *testing.T) {
+	t.Parallel()
+
+	player := quiz.NewPlayer("alice")
+
+	if got := player.Username(); got != "alice" {
+		t.Errorf("Unexpected username: got %q, want %q", got, "alice")
+	}
+	if !player.Alive() {
+		t.Error("New player is not alive")
+	}
+	if got := player.GetAnswer(0); !cmp.Equal(got, api.Answer{}) {
+		t.Errorf("New player has an answer: %+v", got)
+	}
+	for id, answer := range player.AllAnswers() {
+		t.Errorf("New player has an answer to question %d: %+v", id, answer)
+	}
+
+	player.RegisterAnswer(0, api.Answer{Text: "Paris"})
+	if got := player.GetAnswer(0).Text; got != "Paris" {
+		t.Errorf("Unexpected answer: got %q, want %q", got, "Paris")
+	}
+}
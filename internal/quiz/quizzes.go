@@ -0,0 +1,206 @@
+package quiz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sevenquiz-backend/api"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// QuizLoader loads all available quizzes from a source.
+type QuizLoader interface {
+	Load() (map[string]api.Quiz, error)
+}
+
+// ErrMaxQuizzes is reported for each quiz skipped once the
+// loader maximum number of quizzes is reached.
+var ErrMaxQuizzes = errors.New("maximum number of quizzes reached")
+
+// LoaderLimits bounds the quizzes loaded to prevent exhausting memory.
+// A zero limit means no limit.
+type LoaderLimits struct {
+	MaxQuizzes          int
+	MaxQuestionsPerQuiz int
+}
+
+// FSLoader loads quizzes from a filesystem where each root directory
+// represents a quiz holding a questions.yml file and an optional
+// quiz.yml metadata file.
+type FSLoader struct {
+	fs     fs.FS
+	limits LoaderLimits
+}
+
+// NewFSLoader returns a loader reading quizzes from fsys, which
+// can be an embed.FS or any other filesystem.
+func NewFSLoader(fsys fs.FS) FSLoader {
+	return FSLoader{fs: fsys}
+}
+
+// NewDirLoader returns a loader reading quizzes from a system directory.
+func NewDirLoader(dir string) FSLoader {
+	return FSLoader{fs: os.DirFS(dir)}
+}
+
+// WithLimits returns a copy of the loader rejecting quizzes over limits.
+func (l FSLoader) WithLimits(limits LoaderLimits) FSLoader {
+	l.limits = limits
+	return l
+}
+
+// Load walks the loader filesystem and decodes all quizzes.
+//
+// Malformed, invalid or oversized quizzes are skipped and reported as
+// joined *QuizError alongside the valid quizzes. Quizzes past the maximum
+// number of quizzes are skipped with ErrMaxQuizzes. Any other error aborts
+// the loading and returns nil quizzes.
+func (l FSLoader) Load() (map[string]api.Quiz, error) {
+	quizzes := map[string]api.Quiz{}
+	quizErrs := []error{}
+
+	root := "."
+	depth := 0
+
+	err := fs.WalkDir(l.fs, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if d.IsDir() && strings.Count(path, "/") <= depth {
+			if l.limits.MaxQuizzes > 0 && len(quizzes) >= l.limits.MaxQuizzes {
+				quizErrs = append(quizErrs, &QuizError{Quiz: d.Name(), Err: ErrMaxQuizzes})
+				return nil
+			}
+			quiz, err := l.loadQuiz(d.Name())
+			if err == nil {
+				err = ValidateQuiz(quiz)
+			}
+			if err != nil {
+				quizErrs = append(quizErrs, &QuizError{Quiz: d.Name(), Err: err})
+				return nil
+			}
+			quizzes[quiz.Name] = quiz
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return quizzes, errors.Join(quizErrs...)
+}
+
+func (l FSLoader) loadQuiz(name string) (api.Quiz, error) {
+	info, err := l.loadQuizInfo(name)
+	if err != nil {
+		return api.Quiz{}, err
+	}
+
+	f, err := l.fs.Open(name + "/questions.yml")
+	if err != nil {
+		return api.Quiz{}, err
+	}
+	defer f.Close()
+
+	quiz := api.Quiz{QuizInfo: info, Name: name}
+	dec := yaml.NewDecoder(f)
+	for {
+		// Stop decoding early so oversized quizzes are never fully read.
+		if limit := l.limits.MaxQuestionsPerQuiz; limit > 0 && len(quiz.Questions) > limit {
+			return api.Quiz{}, fmt.Errorf("too many questions, maximum is %d", limit)
+		}
+		var q api.Question
+		if err := dec.Decode(&q); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return api.Quiz{}, err
+		}
+		quiz.Questions = append(quiz.Questions, q)
+	}
+
+	quiz.QuestionCount = len(quiz.Questions)
+
+	return quiz, nil
+}
+
+// loadQuizInfo decodes the optional quiz.yml metadata file of a quiz.
+func (l FSLoader) loadQuizInfo(name string) (api.QuizInfo, error) {
+	info := api.QuizInfo{}
+
+	f, err := l.fs.Open(name + "/quiz.yml")
+	if errors.Is(err, fs.ErrNotExist) {
+		return info, nil
+	}
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+
+	if err := yaml.NewDecoder(f).Decode(&info); err != nil && !errors.Is(err, io.EOF) {
+		return info, fmt.Errorf("quiz.yml: %w", err)
+	}
+
+	return info, nil
+}
+
+// MapLoader is a static loader returning its own quizzes.
+type MapLoader map[string]api.Quiz
+
+// Load returns the loader quizzes.
+func (l MapLoader) Load() (map[string]api.Quiz, error) {
+	return l, nil
+}
+
+// QuizStore holds the quizzes loaded by a QuizLoader and allows
+// reloading them.
+//
+// Multiple goroutines may invoke methods on a QuizStore simultaneously.
+type QuizStore struct {
+	loader  QuizLoader
+	quizzes atomic.Pointer[map[string]api.Quiz]
+}
+
+// NewQuizStore returns a store filled with the quizzes of loader.
+//
+// As with Reload, a non-nil store may be returned alongside an error
+// reporting the skipped invalid quizzes.
+func NewQuizStore(loader QuizLoader) (*QuizStore, error) {
+	s := &QuizStore{loader: loader}
+	err := s.Reload()
+	if s.quizzes.Load() == nil {
+		return nil, err
+	}
+	return s, err
+}
+
+// Reload loads the quizzes again and atomically swaps them.
+// Invalid quizzes are skipped and reported in the returned error.
+// If the loading fails entirely, previously loaded quizzes are kept.
+//
+// The previous quizzes map is never mutated so lobbies keep their snapshot.
+func (s *QuizStore) Reload() error {
+	quizzes, err := s.loader.Load()
+	if quizzes == nil && err != nil {
+		return err
+	}
+	s.quizzes.Store(&quizzes)
+	return err
+}
+
+// All returns the currently loaded quizzes.
+// The returned map must not be modified.
+func (s *QuizStore) All() map[string]api.Quiz {
+	if quizzes := s.quizzes.Load(); quizzes != nil {
+		return *quizzes
+	}
+	return nil
+}
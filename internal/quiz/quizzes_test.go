@@ -0,0 +1,199 @@
+package quiz_test
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/quiz"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+//go:embed tests/quizzes
+var quizzes embed.FS
+
+func mustWriteQuestions(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+		t.Fatalf("Could not create quiz dir: %v", err)
+	}
+	path := filepath.Join(dir, name, "questions.yml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Could not write quiz questions: %v", err)
+	}
+}
+
+func TestFSLoader(t *testing.T) {
+	t.Parallel()
+
+	quizzesFS, err := fs.Sub(quizzes, "tests/quizzes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := quiz.NewFSLoader(quizzesFS).Load()
+	if err != nil {
+		t.Fatalf("Could not load quizzes: %v", err)
+	}
+
+	names := make([]string, 0, len(got))
+	for name := range got {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	if diff := cmp.Diff([]string{"cars", "custom", "default"}, names); diff != "" {
+		t.Errorf("Unexpected loaded quizzes (-want+got):\n%v", diff)
+	}
+}
+
+func TestDirLoader(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	mustWriteQuestions(t, dir, "geo", "Title: Capital of France ?\nType: text\nAnswer:\n  Text: Paris\n---\nTitle: Capital of Italy ?\nType: text\nAnswer:\n  Text: Rome\n")
+
+	got, err := quiz.NewDirLoader(dir).Load()
+	if err != nil {
+		t.Fatalf("Could not load quizzes: %v", err)
+	}
+
+	q, ok := got["geo"]
+	if !ok {
+		t.Fatalf("Missing quiz geo in loaded quizzes: %+v", got)
+	}
+	if got, want := len(q.Questions), 2; got != want {
+		t.Fatalf("Unexpected number of questions: got %d, want %d", got, want)
+	}
+	if got, want := q.Questions[1].Title, "Capital of Italy ?"; got != want {
+		t.Errorf("Unexpected question title: got %s, want %s", got, want)
+	}
+}
+
+func TestQuizStoreReload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	mustWriteQuestions(t, dir, "geo", "Title: Capital of France ?\nType: text\nAnswer:\n  Text: Paris\n")
+
+	store, err := quiz.NewQuizStore(quiz.NewDirLoader(dir))
+	if err != nil {
+		t.Fatalf("Could not create quiz store: %v", err)
+	}
+
+	snapshot := store.All()
+	if got, want := len(snapshot), 1; got != want {
+		t.Fatalf("Unexpected number of quizzes: got %d, want %d", got, want)
+	}
+
+	mustWriteQuestions(t, dir, "geo", "Title: Capital of France ?\nType: text\nAnswer:\n  Text: Paris\n---\nTitle: Capital of Spain ?\nType: text\nAnswer:\n  Text: Madrid\n")
+	mustWriteQuestions(t, dir, "cars", "Title: Fastest car ?\nType: text\nAnswer:\n  Text: Bugatti\n")
+
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Could not reload quizzes: %v", err)
+	}
+
+	reloaded := store.All()
+	if got, want := len(reloaded), 2; got != want {
+		t.Fatalf("Unexpected number of reloaded quizzes: got %d, want %d", got, want)
+	}
+	if got, want := len(reloaded["geo"].Questions), 2; got != want {
+		t.Errorf("Unexpected number of reloaded questions: got %d, want %d", got, want)
+	}
+
+	// Previous snapshot must be left untouched for in-flight lobbies.
+	if got, want := len(snapshot), 1; got != want {
+		t.Errorf("Previous snapshot was modified: got %d quizzes, want %d", got, want)
+	}
+	if got, want := len(snapshot["geo"].Questions), 1; got != want {
+		t.Errorf("Previous snapshot questions were modified: got %d, want %d", got, want)
+	}
+
+	// A malformed quiz is skipped without discarding the others.
+	mustWriteQuestions(t, dir, "broken", "Title: [invalid\n")
+	if err := store.Reload(); err == nil {
+		t.Error("Expected reload error on malformed quiz")
+	}
+	if got, want := len(store.All()), 2; got != want {
+		t.Errorf("Unexpected number of quizzes after partial reload: got %d, want %d", got, want)
+	}
+}
+
+func TestLoaderLimits(t *testing.T) {
+	t.Parallel()
+
+	question := "Title: Capital of France ?\nType: text\nAnswer:\n  Text: Paris\n"
+
+	dir := t.TempDir()
+	mustWriteQuestions(t, dir, "a-small", question)
+	mustWriteQuestions(t, dir, "b-huge", strings.Repeat(question+"---\n", 4))
+	mustWriteQuestions(t, dir, "c-extra", question)
+	mustWriteQuestions(t, dir, "d-extra", question)
+
+	quizzes, err := quiz.NewDirLoader(dir).WithLimits(quiz.LoaderLimits{
+		MaxQuizzes:          2,
+		MaxQuestionsPerQuiz: 3,
+	}).Load()
+	if err == nil {
+		t.Fatal("Expected errors for quizzes over limits")
+	}
+
+	want := []string{"a-small", "c-extra"}
+	if diff := cmp.Diff(want, slices.Sorted(maps.Keys(quizzes))); diff != "" {
+		t.Errorf("Unexpected loaded quizzes (-want+got):\n%v", diff)
+	}
+
+	quizErr := &quiz.QuizError{}
+	if !errors.As(err, &quizErr) || quizErr.Quiz != "b-huge" {
+		t.Errorf("Oversized quiz was not reported: %v", err)
+	}
+	if !errors.Is(err, quiz.ErrMaxQuizzes) {
+		t.Errorf("Quizzes over maximum were not reported: %v", err)
+	}
+}
+
+func TestLoaderQuizInfo(t *testing.T) {
+	t.Parallel()
+
+	question := "Title: Capital of France ?\nType: text\nAnswer:\n  Text: Paris\n"
+
+	dir := t.TempDir()
+	mustWriteQuestions(t, dir, "geo", question)
+	mustWriteQuestions(t, dir, "plain", question)
+
+	metadata := "Title: Geography\nDescription: Capitals of the world.\nAuthor: Jane\nDifficulty: hard\nDurations:\n  text: 10s\n"
+	if err := os.WriteFile(filepath.Join(dir, "geo", "quiz.yml"), []byte(metadata), 0o600); err != nil {
+		t.Fatalf("Could not write quiz metadata: %v", err)
+	}
+
+	got, err := quiz.NewDirLoader(dir).Load()
+	if err != nil {
+		t.Fatalf("Could not load quizzes: %v", err)
+	}
+
+	want := api.QuizInfo{
+		Title:         "Geography",
+		Description:   "Capitals of the world.",
+		Author:        "Jane",
+		Difficulty:    "hard",
+		QuestionCount: 1,
+		Durations:     map[api.QuestionType]time.Duration{api.QuestionTypeText: 10 * time.Second},
+	}
+	if diff := cmp.Diff(want, got["geo"].QuizInfo); diff != "" {
+		t.Errorf("Unexpected quiz info (-want+got):\n%v", diff)
+	}
+
+	// Quizzes without metadata keep loading with only a question count.
+	if diff := cmp.Diff(api.QuizInfo{QuestionCount: 1}, got["plain"].QuizInfo); diff != "" {
+		t.Errorf("Unexpected quiz info without metadata (-want+got):\n%v", diff)
+	}
+}
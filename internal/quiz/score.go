@@ -0,0 +1,205 @@
+package quiz
+
+import (
+	"cmp"
+	"math"
+	"sevenquiz-backend/api"
+	"slices"
+	"strings"
+)
+
+// ValidateAnswer reports if answer is a correct answer to question.
+//
+// Choices are compared regardless of their order so shuffled choices
+// never impact scoring. Categories answers must place every choice in
+// its expected category. Map answers must point within the map radius
+// of the expected point. Text answers are compared with MatchText.
+// Question types without automatic validation always return false and
+// are left to the lobby owner review.
+//
+// Answers matching any of the question accepted answers are correct.
+func ValidateAnswer(question api.Question, answer api.Answer) bool {
+	for _, expected := range question.AcceptedAnswers() {
+		if validateAnswer(question, expected, answer) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateAnswer(question api.Question, expected, answer api.Answer) bool {
+	switch question.Type {
+	case api.QuestionTypeChoices, api.QuestionTypeBoolean:
+		return len(answer.Choices) > 0 && sameChoices(expected.Choices, answer.Choices)
+	case api.QuestionTypeOrder:
+		return len(answer.Order) > 0 && slices.Equal(expected.Order, answer.Order)
+	case api.QuestionTypeCategories:
+		total := placedCount(expected.Categories)
+		return total > 0 && placedChoices(expected.Categories, answer.Categories) == total
+	case api.QuestionTypeMap:
+		return question.Map != nil && distance(expected, answer) <= float64(question.Map.Radius)
+	case api.QuestionTypeText, api.QuestionTypeBlind:
+		return answer.Text != "" && MatchText(question.Match, answer.Text, expected.Text)
+	default:
+		return false
+	}
+}
+
+// ScoreAnswer returns the points earned by answer, between 0 and 1.
+//
+// Answers validated by ValidateAnswer earn the whole point. With partial
+// scoring, choices answers also earn a fraction of the point per correct
+// selection minus one per wrong selection, floored at zero, order
+// answers a fraction per item at its expected position and categories
+// answers a fraction per choice placed in its expected category.
+//
+// Map answers beyond the radius earn a fraction of the point decreasing
+// with the distance up to the map MaxDistance, whatever the scoring.
+//
+// Answers earn the best of their points against each accepted answer.
+func ScoreAnswer(question api.Question, answer api.Answer) float64 {
+	points := 0.0
+	for _, expected := range question.AcceptedAnswers() {
+		points = max(points, scoreAnswer(question, expected, answer))
+	}
+	return points
+}
+
+func scoreAnswer(question api.Question, expected, answer api.Answer) float64 {
+	if validateAnswer(question, expected, answer) {
+		return 1
+	}
+	if question.Type == api.QuestionTypeMap && question.Map != nil {
+		return scorePoint(*question.Map, distance(expected, answer))
+	}
+	if question.Scoring != api.ScoringPartial {
+		return 0
+	}
+
+	switch question.Type {
+	case api.QuestionTypeChoices, api.QuestionTypeBoolean:
+		if len(expected.Choices) == 0 {
+			return 0
+		}
+		selected := slices.Clone(answer.Choices)
+		slices.Sort(selected)
+		hits := 0
+		for _, choice := range slices.Compact(selected) {
+			if slices.Contains(expected.Choices, choice) {
+				hits++
+			} else {
+				hits--
+			}
+		}
+		return max(0, float64(hits)/float64(len(expected.Choices)))
+	case api.QuestionTypeOrder:
+		if len(expected.Order) == 0 {
+			return 0
+		}
+		placed := 0
+		for i, item := range answer.Order {
+			if i < len(expected.Order) && expected.Order[i] == item {
+				placed++
+			}
+		}
+		return float64(placed) / float64(len(expected.Order))
+	case api.QuestionTypeCategories:
+		total := placedCount(expected.Categories)
+		if total == 0 {
+			return 0
+		}
+		return float64(placedChoices(expected.Categories, answer.Categories)) / float64(total)
+	default:
+		return 0
+	}
+}
+
+// roundPoints rounds points to the hundredth, hiding the float noise
+// of summed fractions.
+func roundPoints(points float64) float64 {
+	return math.Round(points*100) / 100
+}
+
+// Leaderboard ranks players by descending score. Tied players share the
+// same rank, the next rank skipping as many places as there are ties
+// (1, 1, 3), and are listed by username so the order is stable.
+func Leaderboard(results map[string]float64) []api.LeaderboardEntry {
+	entries := make([]api.LeaderboardEntry, 0, len(results))
+	for username, score := range results {
+		entries = append(entries, api.LeaderboardEntry{Username: username, Score: score})
+	}
+	slices.SortFunc(entries, func(a, b api.LeaderboardEntry) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Username, b.Username)
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Score == entries[i-1].Score {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+	return entries
+}
+
+func sameChoices(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// placedChoices counts the choices placed in their expected category.
+func placedChoices(expected, placed map[string][]string) int {
+	hits := 0
+	for category, choices := range expected {
+		for _, choice := range choices {
+			if got, ok := categoryOf(placed, choice); ok && got == category {
+				hits++
+			}
+		}
+	}
+	return hits
+}
+
+func placedCount(categories map[string][]string) int {
+	n := 0
+	for _, choices := range categories {
+		n += len(choices)
+	}
+	return n
+}
+
+// categoryOf returns the category choice is placed in. A choice placed
+// in several categories is not considered placed.
+func categoryOf(categories map[string][]string, choice string) (string, bool) {
+	found, n := "", 0
+	for category, choices := range categories {
+		if slices.Contains(choices, choice) {
+			found = category
+			n++
+		}
+	}
+	return found, n == 1
+}
+
+// distance returns the distance between the expected and answered points.
+func distance(expected, answer api.Answer) float64 {
+	return math.Hypot(float64(answer.X-expected.X), float64(answer.Y-expected.Y))
+}
+
+// scorePoint returns the points of an answer at distance d from the
+// expected point, decreasing linearly from the map radius to its max
+// distance.
+func scorePoint(m api.MapOptions, d float64) float64 {
+	radius, maxDistance := float64(m.Radius), float64(m.MaxDistance)
+	switch {
+	case d <= radius:
+		return 1
+	case d >= maxDistance:
+		return 0
+	default:
+		return (maxDistance - d) / (maxDistance - radius)
+	}
+}
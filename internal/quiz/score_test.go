@@ -0,0 +1,266 @@
+package quiz_test
+
+import (
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/quiz"
+	"testing"
+)
+
+func TestValidateAnswer(t *testing.T) {
+	t.Parallel()
+
+	var (
+		text = api.Question{
+			Type:   api.QuestionTypeText,
+			Answer: &api.Answer{Text: "Paris"},
+		}
+		choices = api.Question{
+			Type:    api.QuestionTypeChoices,
+			Choices: []string{"red", "green", "blue", "pink"},
+			Answer:  &api.Answer{Choices: []string{"red", "blue"}},
+		}
+		order = api.Question{
+			Type:       api.QuestionTypeOrder,
+			OrderItems: []api.OrderItem{{Name: "ant"}, {Name: "dog"}},
+			Answer:     &api.Answer{Order: []string{"ant", "dog"}},
+		}
+		boolean = api.Question{
+			Type:   api.QuestionTypeBoolean,
+			Answer: &api.Answer{Choices: []string{"true"}},
+		}
+		categories = api.Question{
+			Type:       api.QuestionTypeCategories,
+			Choices:    []string{"apple", "carrot"},
+			Categories: []string{"fruits", "vegetables"},
+			Answer:     &api.Answer{Categories: map[string][]string{"fruits": {"apple"}, "vegetables": {"carrot"}}},
+		}
+	)
+
+	tests := []struct {
+		name     string
+		question api.Question
+		answer   api.Answer
+		want     bool
+	}{
+		{name: "Text", question: text, answer: api.Answer{Text: "Paris"}, want: true},
+		{name: "Text case and spaces", question: text, answer: api.Answer{Text: " paris "}, want: true},
+		{name: "Wrong text", question: text, answer: api.Answer{Text: "Rome"}, want: false},
+		{name: "Empty text", question: text, answer: api.Answer{}, want: false},
+		{name: "Choices", question: choices, answer: api.Answer{Choices: []string{"red", "blue"}}, want: true},
+		{name: "Choices any order", question: choices, answer: api.Answer{Choices: []string{"blue", "red"}}, want: true},
+		{name: "Missing choice", question: choices, answer: api.Answer{Choices: []string{"red"}}, want: false},
+		{name: "Extra choice", question: choices, answer: api.Answer{Choices: []string{"red", "blue", "pink"}}, want: false},
+		{name: "Order", question: order, answer: api.Answer{Order: []string{"ant", "dog"}}, want: true},
+		{name: "Wrong order", question: order, answer: api.Answer{Order: []string{"dog", "ant"}}, want: false},
+		{name: "Boolean", question: boolean, answer: api.Answer{Choices: []string{"true"}}, want: true},
+		{name: "Wrong boolean", question: boolean, answer: api.Answer{Choices: []string{"false"}}, want: false},
+		{name: "Both booleans", question: boolean, answer: api.Answer{Choices: []string{"true", "false"}}, want: false},
+		{name: "Categories", question: categories, answer: api.Answer{Categories: map[string][]string{"vegetables": {"carrot"}, "fruits": {"apple"}}}, want: true},
+		{name: "Swapped categories", question: categories, answer: api.Answer{Categories: map[string][]string{"fruits": {"carrot"}, "vegetables": {"apple"}}}, want: false},
+		{name: "Missing placement", question: categories, answer: api.Answer{Categories: map[string][]string{"fruits": {"apple"}}}, want: false},
+		{name: "No expected answer", question: api.Question{Type: api.QuestionTypeText}, answer: api.Answer{Text: "Paris"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := quiz.ValidateAnswer(tt.question, tt.answer); got != tt.want {
+				t.Errorf("Unexpected answer validation: got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreAnswer(t *testing.T) {
+	t.Parallel()
+
+	var (
+		choices = api.Question{
+			Type:    api.QuestionTypeChoices,
+			Choices: []string{"red", "green", "blue", "pink"},
+			Answer:  &api.Answer{Choices: []string{"red", "green", "blue"}},
+		}
+		order = api.Question{
+			Type:       api.QuestionTypeOrder,
+			OrderItems: []api.OrderItem{{Name: "ant"}, {Name: "cat"}, {Name: "dog"}, {Name: "cow"}},
+			Answer:     &api.Answer{Order: []string{"ant", "cat", "dog", "cow"}},
+		}
+		boolean = api.Question{
+			Type:   api.QuestionTypeBoolean,
+			Answer: &api.Answer{Choices: []string{"false"}},
+		}
+		categories = api.Question{
+			Type:       api.QuestionTypeCategories,
+			Choices:    []string{"apple", "carrot", "pear", "leek"},
+			Categories: []string{"fruits", "vegetables"},
+			Answer: &api.Answer{Categories: map[string][]string{
+				"fruits":     {"apple", "pear"},
+				"vegetables": {"carrot", "leek"},
+			}},
+		}
+	)
+
+	tests := []struct {
+		name        string
+		question    api.Question
+		answer      api.Answer
+		wantExact   float64
+		wantPartial float64
+	}{
+		{name: "Choices", question: choices, answer: api.Answer{Choices: []string{"blue", "red", "green"}}, wantExact: 1, wantPartial: 1},
+		{name: "Missing choice", question: choices, answer: api.Answer{Choices: []string{"red", "blue"}}, wantExact: 0, wantPartial: 2.0 / 3},
+		{name: "Wrong choice", question: choices, answer: api.Answer{Choices: []string{"red", "blue", "pink"}}, wantExact: 0, wantPartial: 1.0 / 3},
+		{name: "Repeated choice", question: choices, answer: api.Answer{Choices: []string{"red", "red"}}, wantExact: 0, wantPartial: 1.0 / 3},
+		{name: "Mostly wrong choices", question: choices, answer: api.Answer{Choices: []string{"red", "pink", "black"}}, wantExact: 0, wantPartial: 0},
+		{name: "Order", question: order, answer: api.Answer{Order: []string{"ant", "cat", "dog", "cow"}}, wantExact: 1, wantPartial: 1},
+		{name: "Swapped order", question: order, answer: api.Answer{Order: []string{"ant", "cat", "cow", "dog"}}, wantExact: 0, wantPartial: 0.5},
+		{name: "Shifted order", question: order, answer: api.Answer{Order: []string{"cow", "ant", "cat", "dog"}}, wantExact: 0, wantPartial: 0},
+		{name: "Boolean", question: boolean, answer: api.Answer{Choices: []string{"false"}}, wantExact: 1, wantPartial: 1},
+		{name: "Wrong boolean", question: boolean, answer: api.Answer{Choices: []string{"true"}}, wantExact: 0, wantPartial: 0},
+		{name: "Both booleans", question: boolean, answer: api.Answer{Choices: []string{"true", "false"}}, wantExact: 0, wantPartial: 0},
+		{
+			name:     "Categories",
+			question: categories,
+			answer: api.Answer{Categories: map[string][]string{
+				"fruits":     {"pear", "apple"},
+				"vegetables": {"leek", "carrot"},
+			}},
+			wantExact:   1,
+			wantPartial: 1,
+		},
+		{
+			name:     "Partially correct categories",
+			question: categories,
+			answer: api.Answer{Categories: map[string][]string{
+				"fruits":     {"apple", "leek"},
+				"vegetables": {"carrot"},
+			}},
+			wantExact:   0,
+			wantPartial: 0.5,
+		},
+		{
+			name:     "Choice in all categories",
+			question: categories,
+			answer: api.Answer{Categories: map[string][]string{
+				"fruits":     {"apple"},
+				"vegetables": {"apple"},
+			}},
+			wantExact:   0,
+			wantPartial: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			exact, partial := tt.question, tt.question
+			exact.Scoring, partial.Scoring = api.ScoringExact, api.ScoringPartial
+
+			if got := quiz.ScoreAnswer(exact, tt.answer); got != tt.wantExact {
+				t.Errorf("Unexpected exact score: got %g, want %g", got, tt.wantExact)
+			}
+			if got := quiz.ScoreAnswer(partial, tt.answer); got != tt.wantPartial {
+				t.Errorf("Unexpected partial score: got %g, want %g", got, tt.wantPartial)
+			}
+		})
+	}
+}
+
+func TestScoreAnswerMap(t *testing.T) {
+	t.Parallel()
+
+	question := api.Question{
+		Type:   api.QuestionTypeMap,
+		Map:    &api.MapOptions{Width: 800, Height: 600, Radius: 10, MaxDistance: 110},
+		Answer: &api.Answer{X: 400, Y: 300},
+	}
+
+	tests := []struct {
+		name      string
+		answer    api.Answer
+		wantValid bool
+		want      float64
+	}{
+		{name: "Exact hit", answer: api.Answer{X: 400, Y: 300}, wantValid: true, want: 1},
+		{name: "Near miss within radius", answer: api.Answer{X: 406, Y: 308}, wantValid: true, want: 1},
+		{name: "Miss within max distance", answer: api.Answer{X: 400, Y: 360}, wantValid: false, want: 0.5},
+		{name: "Miss at max distance", answer: api.Answer{X: 510, Y: 300}, wantValid: false, want: 0},
+		{name: "Far miss", answer: api.Answer{X: 0, Y: 0}, wantValid: false, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := quiz.ValidateAnswer(question, tt.answer); got != tt.wantValid {
+				t.Errorf("Unexpected answer validation: got %t, want %t", got, tt.wantValid)
+			}
+			if got := quiz.ScoreAnswer(question, tt.answer); got != tt.want {
+				t.Errorf("Unexpected score: got %g, want %g", got, tt.want)
+			}
+		})
+	}
+
+	// Without max distance, misses beyond the radius earn nothing.
+	strict := question.Clone()
+	strict.Map.MaxDistance = 0
+	if got := quiz.ScoreAnswer(strict, api.Answer{X: 400, Y: 311}); got != 0 {
+		t.Errorf("Unexpected score beyond the radius: got %g, want 0", got)
+	}
+}
+
+func TestScoreAnswerVariants(t *testing.T) {
+	t.Parallel()
+
+	var (
+		text = api.Question{
+			Type:    api.QuestionTypeText,
+			Answer:  &api.Answer{Text: "Paris"},
+			Answers: []api.Answer{{Text: "Lutece"}},
+		}
+		country = api.Question{
+			Type:    api.QuestionTypeText,
+			Answer:  &api.Answer{Text: "United States"},
+			Answers: []api.Answer{{Text: "usa"}, {Text: "us"}},
+		}
+		order = api.Question{
+			Type:       api.QuestionTypeOrder,
+			Scoring:    api.ScoringPartial,
+			OrderItems: []api.OrderItem{{Name: "ant"}, {Name: "cat"}, {Name: "dog"}},
+			Answer:     &api.Answer{Order: []string{"ant", "cat", "dog"}},
+			Answers:    []api.Answer{{Order: []string{"cat", "ant", "dog"}}},
+		}
+	)
+
+	tests := []struct {
+		name      string
+		question  api.Question
+		answer    api.Answer
+		wantValid bool
+		want      float64
+	}{
+		{name: "Text answer", question: text, answer: api.Answer{Text: "paris"}, wantValid: true, want: 1},
+		{name: "Text variant", question: text, answer: api.Answer{Text: "Lutèce"}, wantValid: true, want: 1},
+		{name: "Wrong text", question: text, answer: api.Answer{Text: "Rome"}, wantValid: false, want: 0},
+		{name: "Text alternative", question: country, answer: api.Answer{Text: "USA"}, wantValid: true, want: 1},
+		{name: "No text alternative", question: country, answer: api.Answer{Text: "UK"}, wantValid: false, want: 0},
+		{name: "Order answer", question: order, answer: api.Answer{Order: []string{"ant", "cat", "dog"}}, wantValid: true, want: 1},
+		{name: "Order variant", question: order, answer: api.Answer{Order: []string{"cat", "ant", "dog"}}, wantValid: true, want: 1},
+		{name: "Best partial variant", question: order, answer: api.Answer{Order: []string{"cat", "dog", "ant"}}, wantValid: false, want: 1.0 / 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := quiz.ValidateAnswer(tt.question, tt.answer); got != tt.wantValid {
+				t.Errorf("Unexpected answer validation: got %t, want %t", got, tt.wantValid)
+			}
+			if got := quiz.ScoreAnswer(tt.question, tt.answer); got != tt.want {
+				t.Errorf("Unexpected score: got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package quiz
+
+import (
+	"math/rand/v2"
+	"sevenquiz-backend/api"
+	"slices"
+)
+
+// ShuffleQuestions returns a copy of questions shuffled with seed.
+// The same seed always produces the same order.
+func ShuffleQuestions(questions []api.Question, seed int64) []api.Question {
+	shuffled := slices.Clone(questions)
+	r := rand.New(rand.NewPCG(uint64(seed), 0)) //nolint:gosec
+	r.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
+
+// ShuffleChoices returns a copy of question with its choices shuffled.
+// The order only depends on seed and the question ID so all players,
+// spectators and late joiners see the same order for a question.
+//
+// Answers reference choices by value, the correct answer is unchanged.
+func ShuffleChoices(question api.Question, seed int64) api.Question {
+	question.Choices = slices.Clone(question.Choices)
+	r := rand.New(rand.NewPCG(uint64(seed), uint64(question.ID))) //nolint:gosec
+	r.Shuffle(len(question.Choices), func(i, j int) {
+		question.Choices[i], question.Choices[j] = question.Choices[j], question.Choices[i]
+	})
+	return question
+}
@@ -0,0 +1,75 @@
+package quiz_test
+
+import (
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/quiz"
+	"slices"
+	"testing"
+)
+
+func questionTitles(questions []api.Question) []string {
+	titles := make([]string, 0, len(questions))
+	for _, question := range questions {
+		titles = append(titles, question.Title)
+	}
+	return titles
+}
+
+func TestShuffleQuestions(t *testing.T) {
+	t.Parallel()
+
+	questions := []api.Question{
+		{Title: "q1"}, {Title: "q2"}, {Title: "q3"}, {Title: "q4"}, {Title: "q5"},
+	}
+	original := questionTitles(questions)
+
+	shuffled := quiz.ShuffleQuestions(questions, 42)
+	got := questionTitles(shuffled)
+
+	if slices.Equal(original, got) {
+		t.Errorf("Questions were not shuffled: %v", got)
+	}
+	if !slices.Equal(original, questionTitles(questions)) {
+		t.Error("Original questions were modified")
+	}
+	if sorted := slices.Sorted(slices.Values(got)); !slices.Equal(original, sorted) {
+		t.Errorf("Shuffled questions are not a permutation: %v", got)
+	}
+	if again := questionTitles(quiz.ShuffleQuestions(questions, 42)); !slices.Equal(got, again) {
+		t.Errorf("Same seed produced different orders: %v, %v", got, again)
+	}
+}
+
+func TestShuffleChoices(t *testing.T) {
+	t.Parallel()
+
+	question := api.Question{
+		ID:      2,
+		Type:    api.QuestionTypeChoices,
+		Choices: []string{"Audi", "Renault", "BMW", "Fiat"},
+		Answer:  &api.Answer{Choices: []string{"Audi", "BMW"}},
+	}
+
+	shuffled := quiz.ShuffleChoices(question, 1)
+
+	if slices.Equal(question.Choices, shuffled.Choices) {
+		t.Errorf("Choices were not shuffled: %v", shuffled.Choices)
+	}
+	if !slices.Equal([]string{"Audi", "Renault", "BMW", "Fiat"}, question.Choices) {
+		t.Error("Original choices were modified")
+	}
+	if again := quiz.ShuffleChoices(question, 1); !slices.Equal(shuffled.Choices, again.Choices) {
+		t.Errorf("Same seed and question produced different orders: %v, %v", shuffled.Choices, again.Choices)
+	}
+
+	// Picking the correct choices among the shuffled ones still validates.
+	answer := api.Answer{}
+	for _, choice := range shuffled.Choices {
+		if choice == "BMW" || choice == "Audi" {
+			answer.Choices = append(answer.Choices, choice)
+		}
+	}
+	if !quiz.ValidateAnswer(shuffled, answer) {
+		t.Errorf("Correct answer to shuffled choices was not validated: %v", answer.Choices)
+	}
+}
@@ -0,0 +1,25 @@
+package quiz
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracer starts the lobby spans. It is a no-op until a tracer provider
+// is registered with otel.SetTracerProvider.
+var tracer = otel.Tracer("sevenquiz-backend/internal/quiz")
+
+// Span attribute keys describing a lobby.
+const (
+	AttributeLobbyID    = attribute.Key("lobby.id")
+	AttributeLobbyState = attribute.Key("lobby.state")
+)
+
+// SpanAttributes returns the attributes identifying the lobby and its
+// current state in spans.
+func (l *Lobby) SpanAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		AttributeLobbyID.String(l.ID()),
+		AttributeLobbyState.String(l.State().String()),
+	}
+}
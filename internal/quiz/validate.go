@@ -0,0 +1,253 @@
+package quiz
+
+import (
+	"errors"
+	"fmt"
+	"sevenquiz-backend/api"
+	"slices"
+)
+
+// Bounds of questions lists, preventing enormous questions.
+const (
+	maxQuestionChoices    = 50
+	maxQuestionOrderItems = 50
+	maxQuestionCategories = 20
+	maxQuestionAnswers    = 20
+	maxQuestionMedias     = 20
+)
+
+// QuizError reports an invalid quiz skipped during loading.
+type QuizError struct {
+	Quiz string
+	Err  error
+}
+
+func (e *QuizError) Error() string {
+	return fmt.Sprintf("quiz %s: %v", e.Quiz, e.Err)
+}
+
+func (e *QuizError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateQuiz checks the quiz durations and all quiz questions are well
+// formed and returns the joined errors of each invalid one.
+func ValidateQuiz(quiz api.Quiz) error {
+	errs := make([]error, 0, len(quiz.Questions))
+	for typ, d := range quiz.Durations {
+		if !typ.IsValid() {
+			errs = append(errs, fmt.Errorf("duration of unknown type %q", typ))
+		} else if d <= 0 {
+			errs = append(errs, fmt.Errorf("duration of %s questions must be positive", typ))
+		}
+	}
+	for i, question := range quiz.Questions {
+		if err := ValidateQuestion(question); err != nil {
+			errs = append(errs, fmt.Errorf("question %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateQuestion checks a question has a title, a known type and
+// the fields required by its type, for its answer and each variant.
+func ValidateQuestion(question api.Question) error {
+	if question.Title == "" {
+		return errors.New("missing title")
+	}
+	if !question.Type.IsValid() {
+		return fmt.Errorf("unknown type %q", question.Type)
+	}
+	if question.Answer == nil {
+		return errors.New("missing answer")
+	}
+	if !question.Scoring.IsValid() {
+		return fmt.Errorf("unknown scoring %q", question.Scoring)
+	}
+	if !question.Match.IsValid() {
+		return fmt.Errorf("unknown text match %q", question.Match)
+	}
+
+	if len(question.Medias) > maxQuestionMedias {
+		return fmt.Errorf("too many medias, maximum is %d", maxQuestionMedias)
+	}
+	if len(question.Choices) > maxQuestionChoices {
+		return fmt.Errorf("too many choices, maximum is %d", maxQuestionChoices)
+	}
+	if len(question.OrderItems) > maxQuestionOrderItems {
+		return fmt.Errorf("too many order items, maximum is %d", maxQuestionOrderItems)
+	}
+	if len(question.Categories) > maxQuestionCategories {
+		return fmt.Errorf("too many categories, maximum is %d", maxQuestionCategories)
+	}
+	if len(question.Answers) > maxQuestionAnswers {
+		return fmt.Errorf("too many answer variants, maximum is %d", maxQuestionAnswers)
+	}
+
+	for i, answer := range question.AcceptedAnswers() {
+		if err := validateQuestionAnswer(question, answer); err != nil {
+			if i > 0 {
+				return fmt.Errorf("answer variant %d: %w", i, err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateQuestionAnswer checks the fields required by the question type
+// for an accepted answer.
+func validateQuestionAnswer(question api.Question, answer api.Answer) error {
+	switch question.Type {
+	case api.QuestionTypeChoices:
+		if len(question.Choices) == 0 {
+			return errors.New("missing choices")
+		}
+		if len(answer.Choices) == 0 {
+			return errors.New("missing answer choices")
+		}
+		for _, choice := range answer.Choices {
+			if !slices.Contains(question.Choices, choice) {
+				return fmt.Errorf("answer choice %q is not a question choice", choice)
+			}
+		}
+	case api.QuestionTypeBoolean:
+		if len(question.Choices) > 0 && !sameChoices(question.Choices, api.BooleanChoices()) {
+			return fmt.Errorf("boolean choices are fixed to %q", api.BooleanChoices())
+		}
+		if len(answer.Choices) != 1 || !slices.Contains(api.BooleanChoices(), answer.Choices[0]) {
+			return fmt.Errorf("boolean answer must be a single choice of %q", api.BooleanChoices())
+		}
+	case api.QuestionTypeOrder:
+		if len(question.OrderItems) == 0 {
+			return errors.New("missing order items")
+		}
+		if len(answer.Order) == 0 {
+			return errors.New("missing answer order")
+		}
+	case api.QuestionTypeCategories:
+		if len(question.Categories) == 0 {
+			return errors.New("missing categories")
+		}
+		if len(question.Choices) == 0 {
+			return errors.New("missing choices")
+		}
+		if err := validateCategories(question, answer.Categories); err != nil {
+			return fmt.Errorf("answer categories: %w", err)
+		}
+		for _, choice := range question.Choices {
+			if _, ok := categoryOf(answer.Categories, choice); !ok {
+				return fmt.Errorf("answer categories: choice %q is not placed", choice)
+			}
+		}
+	case api.QuestionTypeMap:
+		m := question.Map
+		if m == nil || m.Width <= 0 || m.Height <= 0 {
+			return errors.New("missing map size")
+		}
+		if m.Radius < 0 || m.MaxDistance < 0 {
+			return errors.New("map distances must not be negative")
+		}
+		if _, err := validatePoint(*m, answer); err != nil {
+			return fmt.Errorf("answer %w", err)
+		}
+	case api.QuestionTypeText, api.QuestionTypeBlind:
+		if answer.Text == "" {
+			return errors.New("missing answer text")
+		}
+	}
+
+	return nil
+}
+
+// ValidateAnswerInput checks a submitted answer is bounded by its question
+// options, so that a crafted answer fitting in the read limit is not
+// costly to score. Choices and order answers must hold distinct options
+// of the question, at most as many as it has, and order answers must be
+// a permutation of all the order items for partial scoring to hold.
+// Categories answers must place choices of the question in its
+// categories, each at most once. Map answers must point within the map.
+// The answer field at fault is returned along the error.
+func ValidateAnswerInput(question api.Question, answer api.Answer) (string, error) {
+	switch question.Type {
+	case api.QuestionTypeChoices, api.QuestionTypeBoolean:
+		options := question.Choices
+		if question.Type == api.QuestionTypeBoolean && len(options) == 0 {
+			options = api.BooleanChoices()
+		}
+		if err := validateAnswerOptions(answer.Choices, options); err != nil {
+			return "choices", err
+		}
+	case api.QuestionTypeOrder:
+		options := make([]string, 0, len(question.OrderItems))
+		for _, item := range question.OrderItems {
+			options = append(options, item.Name)
+		}
+		if err := validateAnswerOptions(answer.Order, options); err != nil {
+			return "order", err
+		}
+		for _, option := range options {
+			if !slices.Contains(answer.Order, option) {
+				return "order", fmt.Errorf("missing entry %q", option)
+			}
+		}
+	case api.QuestionTypeCategories:
+		if err := validateCategories(question, answer.Categories); err != nil {
+			return "categories", err
+		}
+	case api.QuestionTypeMap:
+		if question.Map != nil {
+			return validatePoint(*question.Map, answer)
+		}
+	}
+	return "", nil
+}
+
+func validateAnswerOptions(selected, options []string) error {
+	if len(selected) > len(options) {
+		return fmt.Errorf("too many entries, maximum is %d", len(options))
+	}
+	for i, s := range selected {
+		if !slices.Contains(options, s) {
+			return fmt.Errorf("unknown entry %q", s)
+		}
+		if slices.Contains(selected[:i], s) {
+			return fmt.Errorf("duplicate entry %q", s)
+		}
+	}
+	return nil
+}
+
+// validateCategories checks categories only place choices of question in
+// its categories, each choice at most once.
+func validateCategories(question api.Question, categories map[string][]string) error {
+	placed := make(map[string]bool, len(question.Choices))
+	for category, choices := range categories {
+		if !slices.Contains(question.Categories, category) {
+			return fmt.Errorf("unknown category %q", category)
+		}
+		for _, choice := range choices {
+			if !slices.Contains(question.Choices, choice) {
+				return fmt.Errorf("unknown choice %q", choice)
+			}
+			if placed[choice] {
+				return fmt.Errorf("choice %q placed twice", choice)
+			}
+			placed[choice] = true
+		}
+	}
+	return nil
+}
+
+// validatePoint checks the answer point is within the map, returning
+// the coordinate out of it.
+func validatePoint(m api.MapOptions, answer api.Answer) (string, error) {
+	if answer.X < 0 || answer.X > m.Width {
+		return "x", fmt.Errorf("x %d is out of the map width %d", answer.X, m.Width)
+	}
+	if answer.Y < 0 || answer.Y > m.Height {
+		return "y", fmt.Errorf("y %d is out of the map height %d", answer.Y, m.Height)
+	}
+	return "", nil
+}
@@ -0,0 +1,392 @@
+package quiz_test
+
+import (
+	"errors"
+	"sevenquiz-backend/api"
+	"sevenquiz-backend/internal/quiz"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestValidateQuiz(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		quiz    api.Quiz
+		wantErr bool
+	}{
+		{
+			name: "Valid quiz",
+			quiz: api.Quiz{
+				Name: "valid",
+				Questions: []api.Question{
+					{Title: "Capital of France ?", Type: api.QuestionTypeText, Answer: &api.Answer{Text: "Paris"}},
+					{
+						Title:   "Primary colors ?",
+						Type:    api.QuestionTypeChoices,
+						Choices: []string{"red", "green", "blue", "pink"},
+						Answer:  &api.Answer{Choices: []string{"red", "green", "blue"}},
+					},
+					{
+						Title:      "Order by size",
+						Type:       api.QuestionTypeOrder,
+						OrderItems: []api.OrderItem{{Name: "ant"}, {Name: "dog"}},
+						Answer:     &api.Answer{Order: []string{"ant", "dog"}},
+					},
+					{Title: "Paris is in France", Type: api.QuestionTypeBoolean, Answer: &api.Answer{Choices: []string{"true"}}},
+					{
+						Title:   "Rome is in France",
+						Type:    api.QuestionTypeBoolean,
+						Choices: []string{"false", "true"},
+						Answer:  &api.Answer{Choices: []string{"false"}},
+					},
+					{
+						Title:      "Fruits or vegetables ?",
+						Type:       api.QuestionTypeCategories,
+						Choices:    []string{"apple", "carrot", "pear"},
+						Categories: []string{"fruits", "vegetables"},
+						Answer: &api.Answer{Categories: map[string][]string{
+							"fruits":     {"apple", "pear"},
+							"vegetables": {"carrot"},
+						}},
+					},
+					{
+						Title:  "Where is Paris ?",
+						Type:   api.QuestionTypeMap,
+						Map:    &api.MapOptions{Width: 800, Height: 600, Radius: 10, MaxDistance: 50},
+						Answer: &api.Answer{X: 420, Y: 180},
+					},
+				},
+			},
+		},
+		{
+			name: "Missing answer",
+			quiz: api.Quiz{
+				Name: "missing",
+				Questions: []api.Question{
+					{Title: "Capital of France ?", Type: api.QuestionTypeText},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown type",
+			quiz: api.Quiz{
+				Name: "unknown",
+				Questions: []api.Question{
+					{Title: "Capital of France ?", Type: "txet", Answer: &api.Answer{Text: "Paris"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Missing title",
+			quiz: api.Quiz{
+				Name: "untitled",
+				Questions: []api.Question{
+					{Type: api.QuestionTypeText, Answer: &api.Answer{Text: "Paris"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown scoring",
+			quiz: api.Quiz{
+				Name: "scoring",
+				Questions: []api.Question{
+					{Title: "Capital of France ?", Type: api.QuestionTypeText, Answer: &api.Answer{Text: "Paris"}, Scoring: "half"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Duration of unknown type",
+			quiz: api.Quiz{
+				Name:     "durations",
+				QuizInfo: api.QuizInfo{Durations: map[api.QuestionType]time.Duration{"txet": time.Minute}},
+				Questions: []api.Question{
+					{Title: "Capital of France ?", Type: api.QuestionTypeText, Answer: &api.Answer{Text: "Paris"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative duration",
+			quiz: api.Quiz{
+				Name:     "durations",
+				QuizInfo: api.QuizInfo{Durations: map[api.QuestionType]time.Duration{api.QuestionTypeText: -time.Minute}},
+				Questions: []api.Question{
+					{Title: "Capital of France ?", Type: api.QuestionTypeText, Answer: &api.Answer{Text: "Paris"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Answer not in choices",
+			quiz: api.Quiz{
+				Name: "choices",
+				Questions: []api.Question{
+					{
+						Title:   "Primary colors ?",
+						Type:    api.QuestionTypeChoices,
+						Choices: []string{"red", "green"},
+						Answer:  &api.Answer{Choices: []string{"blue"}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Boolean answer not a boolean",
+			quiz: api.Quiz{
+				Name: "boolean",
+				Questions: []api.Question{
+					{Title: "Paris is in France", Type: api.QuestionTypeBoolean, Answer: &api.Answer{Choices: []string{"yes"}}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Boolean with both answers",
+			quiz: api.Quiz{
+				Name: "boolean",
+				Questions: []api.Question{
+					{Title: "Paris is in France", Type: api.QuestionTypeBoolean, Answer: &api.Answer{Choices: []string{"true", "false"}}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Categories choice not placed",
+			quiz: api.Quiz{
+				Name: "categories",
+				Questions: []api.Question{
+					{
+						Title:      "Fruits or vegetables ?",
+						Type:       api.QuestionTypeCategories,
+						Choices:    []string{"apple", "carrot"},
+						Categories: []string{"fruits", "vegetables"},
+						Answer:     &api.Answer{Categories: map[string][]string{"fruits": {"apple"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Categories unknown category",
+			quiz: api.Quiz{
+				Name: "categories",
+				Questions: []api.Question{
+					{
+						Title:      "Fruits or vegetables ?",
+						Type:       api.QuestionTypeCategories,
+						Choices:    []string{"apple"},
+						Categories: []string{"fruits", "vegetables"},
+						Answer:     &api.Answer{Categories: map[string][]string{"nuts": {"apple"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Answer variant not in choices",
+			quiz: api.Quiz{
+				Name: "variants",
+				Questions: []api.Question{
+					{
+						Title:   "A primary color ?",
+						Type:    api.QuestionTypeChoices,
+						Choices: []string{"red", "green", "blue"},
+						Answer:  &api.Answer{Choices: []string{"red"}},
+						Answers: []api.Answer{{Choices: []string{"blue"}}, {Choices: []string{"pink"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Map without size",
+			quiz: api.Quiz{
+				Name: "map",
+				Questions: []api.Question{
+					{Title: "Where is Paris ?", Type: api.QuestionTypeMap, Answer: &api.Answer{X: 420, Y: 180}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Map answer out of the map",
+			quiz: api.Quiz{
+				Name: "map",
+				Questions: []api.Question{
+					{
+						Title:  "Where is Paris ?",
+						Type:   api.QuestionTypeMap,
+						Map:    &api.MapOptions{Width: 800, Height: 600},
+						Answer: &api.Answer{X: 420, Y: 700},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Boolean with custom choices",
+			quiz: api.Quiz{
+				Name: "boolean",
+				Questions: []api.Question{
+					{
+						Title:   "Paris is in France",
+						Type:    api.QuestionTypeBoolean,
+						Choices: []string{"yes", "no"},
+						Answer:  &api.Answer{Choices: []string{"yes"}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := quiz.ValidateQuiz(tt.quiz)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("Unexpected validation result: got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoaderSkipsInvalidQuizzes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	mustWriteQuestions(t, dir, "valid", "Title: Capital of France ?\nType: text\nAnswer:\n  Text: Paris\n")
+	mustWriteQuestions(t, dir, "noanswer", "Title: Capital of France ?\nType: text\n")
+	mustWriteQuestions(t, dir, "malformed", "Title: [invalid\n")
+
+	quizzes, err := quiz.NewDirLoader(dir).Load()
+	if err == nil {
+		t.Fatal("Expected errors for invalid quizzes")
+	}
+	if _, ok := quizzes["valid"]; !ok || len(quizzes) != 1 {
+		t.Errorf("Unexpected loaded quizzes: %+v", quizzes)
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error }) //nolint:errorlint
+	if !ok {
+		t.Fatalf("Expected joined errors, got %T", err)
+	}
+
+	invalid := map[string]bool{}
+	for _, err := range joined.Unwrap() {
+		quizErr := &quiz.QuizError{}
+		if !errors.As(err, &quizErr) {
+			t.Fatalf("Unexpected error type %T: %v", err, err)
+		}
+		invalid[quizErr.Quiz] = true
+	}
+	if !invalid["noanswer"] || !invalid["malformed"] || len(invalid) != 2 {
+		t.Errorf("Unexpected invalid quizzes reported: %v", invalid)
+	}
+}
+
+func TestValidateQuestionBounds(t *testing.T) {
+	t.Parallel()
+
+	choices := make([]string, 100)
+	for i := range choices {
+		choices[i] = strconv.Itoa(i)
+	}
+
+	err := quiz.ValidateQuestion(api.Question{
+		Title:   "Pick a number",
+		Type:    api.QuestionTypeChoices,
+		Choices: choices,
+		Answer:  &api.Answer{Choices: choices[:1]},
+	})
+	if err == nil {
+		t.Error("Question with too many choices was not rejected")
+	}
+}
+
+func TestValidateAnswerInput(t *testing.T) {
+	t.Parallel()
+
+	var (
+		choices = api.Question{
+			Type:    api.QuestionTypeChoices,
+			Choices: []string{"red", "green", "blue"},
+		}
+		order = api.Question{
+			Type:       api.QuestionTypeOrder,
+			OrderItems: []api.OrderItem{{Name: "ant"}, {Name: "dog"}},
+		}
+		boolean = api.Question{
+			Type: api.QuestionTypeBoolean,
+		}
+		text = api.Question{
+			Type: api.QuestionTypeText,
+		}
+		categories = api.Question{
+			Type:       api.QuestionTypeCategories,
+			Choices:    []string{"apple", "carrot"},
+			Categories: []string{"fruits", "vegetables"},
+		}
+		point = api.Question{
+			Type: api.QuestionTypeMap,
+			Map:  &api.MapOptions{Width: 800, Height: 600},
+		}
+	)
+
+	longOrder := make([]string, 1000)
+	for i := range longOrder {
+		longOrder[i] = "ant"
+	}
+
+	tests := []struct {
+		name      string
+		question  api.Question
+		answer    api.Answer
+		wantField string
+	}{
+		{name: "Choices", question: choices, answer: api.Answer{Choices: []string{"red", "blue"}}},
+		{name: "All choices", question: choices, answer: api.Answer{Choices: []string{"blue", "green", "red"}}},
+		{name: "Duplicate choice", question: choices, answer: api.Answer{Choices: []string{"red", "red"}}, wantField: "choices"},
+		{name: "Extra choice", question: choices, answer: api.Answer{Choices: []string{"red", "pink"}}, wantField: "choices"},
+		{name: "Too many choices", question: choices, answer: api.Answer{Choices: []string{"red", "green", "blue", "red"}}, wantField: "choices"},
+		{name: "Order permutation", question: order, answer: api.Answer{Order: []string{"dog", "ant"}}},
+		{name: "Missing order item", question: order, answer: api.Answer{Order: []string{"dog"}}, wantField: "order"},
+		{name: "Empty order", question: order, answer: api.Answer{}, wantField: "order"},
+		{name: "Over-long order", question: order, answer: api.Answer{Order: longOrder}, wantField: "order"},
+		{name: "Duplicate order item", question: order, answer: api.Answer{Order: []string{"ant", "ant"}}, wantField: "order"},
+		{name: "Unknown order item", question: order, answer: api.Answer{Order: []string{"cat"}}, wantField: "order"},
+		{name: "Boolean", question: boolean, answer: api.Answer{Choices: []string{"true"}}},
+		{name: "Both booleans twice", question: boolean, answer: api.Answer{Choices: []string{"true", "false", "true"}}, wantField: "choices"},
+		{name: "Text", question: text, answer: api.Answer{Text: "Paris"}},
+		{name: "Categories", question: categories, answer: api.Answer{Categories: map[string][]string{"fruits": {"apple", "carrot"}}}},
+		{name: "Unknown category", question: categories, answer: api.Answer{Categories: map[string][]string{"nuts": {"apple"}}}, wantField: "categories"},
+		{name: "Unknown categorized choice", question: categories, answer: api.Answer{Categories: map[string][]string{"fruits": {"pear"}}}, wantField: "categories"},
+		{name: "Map point", question: point, answer: api.Answer{X: 800, Y: 0}},
+		{name: "Map point out of width", question: point, answer: api.Answer{X: 801, Y: 10}, wantField: "x"},
+		{name: "Map point out of height", question: point, answer: api.Answer{X: 10, Y: -1}, wantField: "y"},
+		{name: "Choice in two categories", question: categories, answer: api.Answer{Categories: map[string][]string{"fruits": {"apple"}, "vegetables": {"apple"}}}, wantField: "categories"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			field, err := quiz.ValidateAnswerInput(tt.question, tt.answer)
+			if got, want := err != nil, tt.wantField != ""; got != want {
+				t.Fatalf("Unexpected answer input error: %v", err)
+			}
+			if field != tt.wantField {
+				t.Errorf("Unexpected answer input field: got %q, want %q", field, tt.wantField)
+			}
+		})
+	}
+}
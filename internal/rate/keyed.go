@@ -0,0 +1,85 @@
+package rate
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// KeyedLimiter holds a Limiter per key, such as a client IP, so that
+// a key exhausting its limit does not affect the others.
+//
+// Limiters idle for a whole window hold no state and are evicted to
+// bound memory.
+type KeyedLimiter struct {
+	window    time.Duration
+	limit     int
+	limiters  map[string]*keyedEntry
+	lastSweep time.Time
+	mu        sync.Mutex
+	clock     Clock
+}
+
+type keyedEntry struct {
+	limiter  *Limiter
+	lastUsed time.Time
+}
+
+func NewKeyedLimiter(window time.Duration, limit int) *KeyedLimiter {
+	return NewKeyedLimiterWithClock(window, limit, clock.New())
+}
+
+func NewKeyedLimiterWithClock(window time.Duration, limit int, clock Clock) *KeyedLimiter {
+	return &KeyedLimiter{
+		window:    window,
+		limit:     limit,
+		limiters:  map[string]*keyedEntry{},
+		lastSweep: clock.Now(),
+		clock:     clock,
+	}
+}
+
+// Get returns the limiter of key, created on first use. The limiter
+// should not be kept as it may be evicted once idle.
+func (k *KeyedLimiter) Get(key string) *Limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.clock.Now()
+	if now.Sub(k.lastSweep) >= k.window {
+		k.sweep(now)
+	}
+
+	e, ok := k.limiters[key]
+	if !ok {
+		e = &keyedEntry{limiter: NewLimiterWithClock(k.window, k.limit, k.clock)}
+		k.limiters[key] = e
+	}
+	e.lastUsed = now
+
+	return e.limiter
+}
+
+// Allow checks if a request of key is allowed to be processed.
+func (k *KeyedLimiter) Allow(key string) bool {
+	return k.Get(key).Allow()
+}
+
+// Len returns the number of limiters held.
+func (k *KeyedLimiter) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.limiters)
+}
+
+// sweep evicts the limiters unused for a window with no request left
+// in their window.
+func (k *KeyedLimiter) sweep(now time.Time) {
+	for key, e := range k.limiters {
+		if now.Sub(e.lastUsed) >= k.window && e.limiter.Slots() == k.limit {
+			delete(k.limiters, key)
+		}
+	}
+	k.lastSweep = now
+}
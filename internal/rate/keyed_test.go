@@ -0,0 +1,54 @@
+package rate_test
+
+import (
+	"sevenquiz-backend/internal/rate"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+func TestKeyedLimiter_Isolation(t *testing.T) {
+	t.Parallel()
+
+	clock := clock.NewMock()
+	limiters := rate.NewKeyedLimiterWithClock(time.Minute, 2, clock)
+
+	for range 2 {
+		if !limiters.Allow("1.1.1.1") {
+			t.Fatal("Request within limit was not allowed")
+		}
+	}
+	if limiters.Allow("1.1.1.1") {
+		t.Error("Request over limit was allowed")
+	}
+	if !limiters.Allow("2.2.2.2") {
+		t.Error("Request of another key was not allowed")
+	}
+}
+
+func TestKeyedLimiter_Eviction(t *testing.T) {
+	t.Parallel()
+
+	clock := clock.NewMock()
+	limiters := rate.NewKeyedLimiterWithClock(time.Minute, 2, clock)
+
+	limiters.Allow("1.1.1.1")
+	limiters.Allow("2.2.2.2")
+	if got, want := limiters.Len(), 2; got != want {
+		t.Fatalf("Unexpected limiters: got %d, want %d", got, want)
+	}
+
+	// Only 2.2.2.2 stays active within the next window.
+	clock.Add(50 * time.Second)
+	limiters.Allow("2.2.2.2")
+	clock.Add(20 * time.Second)
+	limiters.Get("3.3.3.3")
+
+	if got, want := limiters.Len(), 2; got != want {
+		t.Errorf("Unexpected limiters after eviction: got %d, want %d", got, want)
+	}
+	if got, want := limiters.Get("2.2.2.2").Slots(), 1; got != want {
+		t.Errorf("Active limiter lost its history: got %d slots, want %d", got, want)
+	}
+}
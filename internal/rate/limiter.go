@@ -71,6 +71,21 @@ func (l *Limiter) Slots() int {
 	return l.limit - len(l.slide(now))
 }
 
+// RetryAfter returns how long until a slot is available, zero if one
+// already is.
+func (l *Limiter) RetryAfter() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	history := l.slide(now)
+	if len(history) < l.limit || len(history) == 0 {
+		return 0
+	}
+
+	return history[0].Add(l.window).Sub(now)
+}
+
 func (l *Limiter) Wait(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -1,19 +1,21 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"errors"
-	"io"
 	"io/fs"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"sevenquiz-backend/api"
 	"sevenquiz-backend/internal/config"
+	errs "sevenquiz-backend/internal/errors"
 	"sevenquiz-backend/internal/handlers"
 	mws "sevenquiz-backend/internal/middlewares"
 	"sevenquiz-backend/internal/quiz"
@@ -22,92 +24,69 @@ import (
 	"github.com/coder/websocket"
 	"github.com/rs/cors"
 	sloghttp "github.com/samber/slog-http"
-	"gopkg.in/yaml.v3"
 )
 
 //go:embed quizzes
 var quizzes embed.FS
 
-func init() {
-	logger := slog.New(handlers.ContextHandler{
-		Handler: slog.NewJSONHandler(os.Stdout, nil),
-		Keys: []any{
-			mws.LobbyIDKey,
-			mws.LobbyStateKey,
-			mws.LobbyUsernameKey,
-			mws.LobbyRequestKey,
-		},
-	})
-	slog.SetDefault(logger)
-}
-
 func main() {
 	cfg, err := config.LoadConfig("") // TODO: config flags
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	quizzesFS, err := fs.Sub(quizzes, "quizzes")
+	slog.SetDefault(handlers.NewLogger(os.Stdout, cfg.Log,
+		mws.LobbyIDKey,
+		mws.LobbyStateKey,
+		mws.LobbyUsernameKey,
+		mws.LobbyRequestKey,
+		errs.RequestIDKey,
+	))
+
+	quizzesFS, err := newQuizzesFS(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	quizzes := map[string]api.Quiz{}
-
-	root := "."
-	depth := 0
-
-	err = fs.WalkDir(quizzesFS, root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if path == root {
-			return nil
-		}
-		if d.IsDir() && strings.Count(path, "/") <= depth {
-			path := d.Name() + "/questions.yml"
-			f, err := quizzesFS.Open(path)
-			if err != nil {
-				return err
-			}
-			quiz := api.Quiz{Name: d.Name()}
-			dec := yaml.NewDecoder(f)
-			for {
-				var q api.Question
-				if err := dec.Decode(&q); err != nil {
-					if errors.Is(err, io.EOF) {
-						break
-					}
-					quiz.Questions = []api.Question{}
-					return err
-				}
-				quiz.Questions = append(quiz.Questions, q)
-			}
-			quizzes[quiz.Name] = quiz
-		}
-		return nil
+	loader := quiz.NewFSLoader(quizzesFS).WithLimits(quiz.LoaderLimits{
+		MaxQuizzes:          cfg.Quizzes.MaxQuizzes,
+		MaxQuestionsPerQuiz: cfg.Quizzes.MaxQuestionsPerQuiz,
 	})
-	if err != nil {
+
+	quizzes, err := quiz.NewQuizStore(loader)
+	if quizzes == nil {
 		log.Fatal(err)
 	}
+	logQuizzesLoad(quizzes, err)
+
+	go reloadQuizzesOnSignal(quizzes)
 
 	var (
 		lobbies    = quiz.NewLobbiesCache()
+		drain      = &mws.Drain{}
 		acceptOpts = websocket.AcceptOptions{
 			OriginPatterns: cfg.CORS.AllowedOrigins,
+			Subprotocols:   []string{api.Subprotocol},
 		}
 		corsOpts = cors.Options{
 			AllowedOrigins: cfg.CORS.AllowedOrigins,
+			AllowedHeaders: []string{"Origin", "Accept", "Content-Type", "X-Requested-With", "Idempotency-Key", "Authorization"},
 		}
 
 		defaultMws = []mws.Middleware{
 			cors.New(corsOpts).Handler,
+			mws.NewClientIP(cfg.TrustProxy),
+			mws.Locale,
 			sloghttp.NewWithConfig(slog.Default(), sloghttp.Config{
 				WithUserAgent: true,
 				WithRequestID: true,
 			}),
 		}
 		lobbyMws = append(defaultMws, mws.Subprotocols, mws.NewLobby(lobbies))
+		adminMws = append(defaultMws, mws.NewAdmin(cfg.AdminToken))
+
+		// Drained ahead of the rate limits, not to use them up.
+		createLobbyMws = append(defaultMws, mws.NewDrain(drain))
 
 		createLobbyHandler = handlers.CreateLobbyHandler(cfg, lobbies, quizzes)
 		lobbyHandler       = handlers.LobbyHandler{
@@ -117,12 +96,38 @@ func main() {
 		}
 	)
 
+	if cfg.Lobby.Compression {
+		lobbyHandler.AcceptOptions.CompressionMode = websocket.CompressionContextTakeover
+	}
 	if cfg.RequestsRateLimit > 0 {
-		lobbyHandler.Limiter = rate.NewLimiter(time.Second, cfg.RequestsRateLimit)
+		lobbyHandler.Limiters = rate.NewKeyedLimiter(time.Second, cfg.RequestsRateLimit)
+	}
+	// Clients over their own limit do not use up the global one.
+	if cfg.CreateLobbyIPRateLimit > 0 {
+		limiters := rate.NewKeyedLimiter(time.Second, cfg.CreateLobbyIPRateLimit)
+		createLobbyMws = append(createLobbyMws, mws.NewIPRateLimit(limiters))
+	}
+	if cfg.CreateLobbyRateLimit > 0 {
+		limiter := rate.NewLimiter(time.Second, cfg.CreateLobbyRateLimit)
+		createLobbyMws = append(createLobbyMws, mws.NewRateLimit(limiter))
 	}
 
-	http.Handle("POST /lobby", mws.Chain(createLobbyHandler, defaultMws...))
+	http.Handle("POST /lobby", mws.Chain(createLobbyHandler, createLobbyMws...))
 	http.Handle("GET /lobby/{id}", mws.Chain(lobbyHandler, lobbyMws...))
+	http.Handle("GET /lobby/{id}/status", mws.Chain(handlers.LobbyStatusHandler(lobbies), defaultMws...))
+	if cfg.Lobby.HTTPAnswers {
+		http.Handle("POST /lobby/{id}/answer", mws.Chain(handlers.AnswerHandler(cfg, lobbies), defaultMws...))
+	}
+	http.Handle("GET /lobby/{id}/results", mws.Chain(handlers.LobbyResultsHandler(lobbies), defaultMws...))
+	http.Handle("GET /media/{quiz}/{file...}", mws.Chain(handlers.MediaHandler(quizzesFS), defaultMws...))
+	http.Handle("GET /quizzes", mws.Chain(handlers.QuizzesHandler(quizzes), defaultMws...))
+	http.Handle("GET /quizzes/{name}", mws.Chain(handlers.QuizHandler(quizzes), defaultMws...))
+	http.Handle("GET /admin/lobbies", mws.Chain(handlers.AdminLobbiesHandler(lobbies), adminMws...))
+	http.Handle("GET /admin/lobbies/{id}", mws.Chain(handlers.AdminLobbyHandler(lobbies), adminMws...))
+	http.Handle("DELETE /admin/lobbies/{id}", mws.Chain(handlers.AdminDeleteLobbyHandler(lobbies), adminMws...))
+	http.Handle("POST /admin/drain", mws.Chain(handlers.AdminDrainHandler(drain, true), adminMws...))
+	http.Handle("DELETE /admin/drain", mws.Chain(handlers.AdminDrainHandler(drain, false), adminMws...))
+	http.Handle("GET /readyz", handlers.ReadyzHandler(drain))
 
 	srv := http.Server{
 		Addr:         ":8080",
@@ -131,9 +136,95 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 	}
 
+	go drainOnSignal(drain)
+	go shutdownWhenDrained(&srv, drain, lobbies)
+
 	slog.Info("starting server", slog.String("addr", srv.Addr))
 
 	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
 }
+
+// newQuizzesFS returns the configured quizzes directory filesystem,
+// or the embedded quizzes if none is set.
+func newQuizzesFS(cfg config.Config) (fs.FS, error) {
+	if cfg.Quizzes.Dir != "" {
+		return os.DirFS(cfg.Quizzes.Dir), nil
+	}
+	return fs.Sub(quizzes, "quizzes")
+}
+
+// reloadQuizzesOnSignal reloads quizzes on SIGHUP.
+// Only new lobbies will see the reloaded quizzes.
+func reloadQuizzesOnSignal(quizzes *quiz.QuizStore) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	for range sig {
+		logQuizzesLoad(quizzes, quizzes.Reload())
+	}
+}
+
+// drainOnSignal toggles the drain on SIGUSR1.
+func drainOnSignal(drain *mws.Drain) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+
+	for range sig {
+		slog.Info("drain toggled", slog.Bool("draining", drain.Toggle()))
+	}
+}
+
+// shutdownWhenDrained shuts the server down once draining with no lobby
+// left, for the process to exit.
+func shutdownWhenDrained(srv *http.Server, drain *mws.Drain, lobbies quiz.LobbyRepository) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !drain.Draining() || hasLobbies(lobbies) {
+			continue
+		}
+
+		slog.Info("drained, shutting down")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Error("server shutdown", slog.Any("error", err))
+		}
+		cancel()
+		return
+	}
+}
+
+func hasLobbies(lobbies quiz.LobbyRepository) bool {
+	for range lobbies.All() {
+		return true
+	}
+	return false
+}
+
+// logQuizzesLoad logs a summary of loaded quizzes and each quiz skipped
+// because of a load error.
+func logQuizzesLoad(quizzes *quiz.QuizStore, err error) {
+	var invalid []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok { //nolint:errorlint
+		invalid = joined.Unwrap()
+	} else if err != nil {
+		invalid = []error{err}
+	}
+
+	for _, err := range invalid {
+		quizErr := &quiz.QuizError{}
+		if errors.As(err, &quizErr) {
+			slog.Error("invalid quiz", slog.String("quiz", quizErr.Quiz), slog.Any("error", quizErr.Err))
+		} else {
+			slog.Error("quizzes load", slog.Any("error", err))
+		}
+	}
+
+	slog.Info("quizzes loaded",
+		slog.Int("loaded", len(quizzes.All())),
+		slog.Int("invalid", len(invalid)))
+}